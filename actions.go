@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Action - действие, которое можно назначить клавише: имя и аргументы.
+// В файле настроек действие без аргументов записывается строкой, а с
+// аргументами - массивом: ["send_text", "ls\n"].
+type Action struct {
+	Name string
+	Args []string
+}
+
+// actionArity задает допустимое число аргументов каждого действия
+// (-1 - без ограничения сверху).
+var actionArity = map[string][2]int{
+	"none":              {0, 0}, // Отменяет привязку по умолчанию
+	"copy":              {0, 0},
+	"paste":             {0, 0},
+	"paste_selection":   {0, 0}, // Вставить первичное выделение
+	"hints_open":        {0, 0},
+	"hints_copy":        {0, 0},
+	"hints_paste":       {0, 0},
+	"search":            {0, 0}, // Поиск по экрану и истории прокрутки
+	"vi_mode":           {0, 0}, // Выделение и копирование с клавиатуры
+	"next_theme":        {0, 0},
+	"font_size_up":      {0, 0},
+	"font_size_down":    {0, 0},
+	"font_size_reset":   {0, 0},
+	"scroll_line_up":    {0, 0},
+	"scroll_line_down":  {0, 0},
+	"scroll_page_up":    {0, 0},
+	"scroll_page_down":  {0, 0},
+	"scroll_to_top":     {0, 0},
+	"scroll_to_bottom":  {0, 0},
+	"prev_prompt":       {0, 0}, // Прокрутить к предыдущему приглашению оболочки (OSC 133)
+	"next_prompt":       {0, 0},
+	"select_output":     {0, 0}, // Выделить вывод последней команды
+	"copy_output":       {0, 0}, // Скопировать вывод последней команды
+	"toggle_fullscreen": {0, 0},
+	"new_window":        {0, 0},
+	"close_window":      {0, 0},
+	"new_tab":           {0, 0},
+	"close_tab":         {0, 0},
+	"next_tab":          {0, 0},
+	"prev_tab":          {0, 0},
+	"move_tab_forward":  {0, 0},
+	"move_tab_backward": {0, 0},
+	"split_horizontal":  {0, 0}, // Новая панель справа
+	"split_vertical":    {0, 0}, // Новая панель снизу
+	"close_pane":        {0, 0},
+	"focus_left":        {0, 0},
+	"focus_right":       {0, 0},
+	"focus_up":          {0, 0},
+	"focus_down":        {0, 0},
+	"zoom_pane":         {0, 0},  // Развернуть панель на всю вкладку и обратно
+	"send_text":         {1, 1},  // Отправить текст программе как есть
+	"send_escape":       {1, 1},  // Отправить ESC и аргумент: ["send_escape", "[A"]
+	"spawn":             {1, -1}, // Запустить программу: ["spawn", "firefox", "--new-window"]
+}
+
+// parseAction разбирает действие из значения файла настроек.
+func parseAction(v any) (Action, error) {
+	var a Action
+	switch v := v.(type) {
+	case string:
+		a.Name = v
+	case []any:
+		if len(v) == 0 {
+			return Action{}, errors.New("empty action")
+		}
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return Action{}, errors.New("action must be a string or an array of strings")
+			}
+			if i == 0 {
+				a.Name = s
+			} else {
+				a.Args = append(a.Args, s)
+			}
+		}
+	default:
+		return Action{}, errors.New("action must be a string or an array of strings")
+	}
+
+	arity, ok := actionArity[a.Name]
+	if !ok {
+		return Action{}, fmt.Errorf("unknown action %q", a.Name)
+	}
+	if n := len(a.Args); n < arity[0] || arity[1] >= 0 && n > arity[1] {
+		if arity[0] == arity[1] {
+			return Action{}, fmt.Errorf("action %q takes %d argument(s), got %d", a.Name, arity[0], n)
+		}
+		return Action{}, fmt.Errorf("action %q takes at least %d argument(s), got %d", a.Name, arity[0], n)
+	}
+	return a, nil
+}
+
+// String записывает действие в формате файла настроек.
+func (a Action) String() string {
+	if len(a.Args) == 0 {
+		return strconv.Quote(a.Name)
+	}
+	items := []string{strconv.Quote(a.Name)}
+	for _, arg := range a.Args {
+		items = append(items, strconv.Quote(arg))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
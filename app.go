@@ -0,0 +1,364 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Границы размера шрифта для font_size_up и font_size_down.
+const (
+	minFontSize = 4
+	maxFontSize = 500
+)
+
+// App связывает окно с сеткой, вкладками и настройками и обрабатывает ввод
+// с клавиатуры и мыши. Все методы вызываются из главного потока.
+type App struct {
+	id      int          // Номер для удаленного управления
+	window  *glfw.Window // Окно сетки, получающее ввод
+	windows *Windows     // Все окна процесса
+	grid    *TermGrid
+	mouse   *Mouse
+	tabs    []*Tab
+	active  int // Активная вкладка в tabs
+	cfg     Config
+	opts    Options // Параметры командной строки: каталог, заголовок, --hold
+	themes  []Theme // Цветовые схемы для next_theme
+	theme   int     // Текущая схема в themes
+	palette Palette // Цвета по умолчанию для всех вкладок
+	title   string  // Заголовок окна
+
+	dragging *Layout // Разделение, линию которого тянет мышь
+
+	baseFontSize int // Размер шрифта из настроек для font_size_reset
+}
+
+// NewApp создает приложение для окна сетки grid с первыми вкладками,
+// которые открывает tabs, и подключает обработчики клавиатуры и мыши к окну.
+func NewApp(windows *Windows, grid *TermGrid, cfg Config, opts Options, tabs func(app *App) error) (*App, error) {
+	app := &App{id: windows.newID(), window: grid.window, windows: windows, grid: grid, mouse: NewMouse(), opts: opts}
+	app.ApplyConfig(cfg)
+	if err := tabs(app); err != nil {
+		app.Close()
+		return nil, err
+	}
+	app.window.SetCharCallback(app.onChar)
+	app.window.SetKeyCallback(app.onKey)
+	app.window.SetMouseButtonCallback(app.onMouseButton)
+	app.window.SetCursorPosCallback(app.onCursorPos)
+	app.window.SetScrollCallback(app.onScroll)
+	return app, nil
+}
+
+// ApplyConfig применяет настройки к сетке и вкладкам, не перезапуская
+// программы в них.
+func (app *App) ApplyConfig(cfg Config) {
+	app.cfg = cfg
+	app.mouse.opener = cfg.LinkOpener
+	if err := app.grid.ApplyConfig(cfg); err != nil {
+		log.Println("failed to apply config:", err)
+	}
+	app.baseFontSize = app.grid.font.size
+	app.palette = cfg.Theme.Palette()
+	app.themes, _ = LoadThemes(themeDir())
+	app.theme = max(findTheme(app.themes, cfg.Theme.Name), 0)
+	for _, tab := range app.tabs {
+		for _, p := range tab.layout.Panes() {
+			app.configureTerm(p.session.term)
+		}
+	}
+	app.resize()
+}
+
+// configureTerm применяет к модели терминала панели настройки окна.
+func (app *App) configureTerm(term *Terminal) {
+	term.SetMaxHistory(app.cfg.Scrollback)
+	term.SetDefaultPalette(app.palette)
+	term.SetClipboardPolicy(app.cfg.Clipboard)
+	term.SetWordSeparators(app.cfg.WordSeparators)
+}
+
+// Close отключает окно от программ во всех панелях: локальные программы
+// завершаются, а программы на сервере продолжают работать.
+func (app *App) Close() {
+	for _, tab := range app.tabs {
+		for _, p := range tab.layout.Panes() {
+			p.session.Detach()
+		}
+	}
+}
+
+// Render забирает снимки экранов видимых панелей, подготовленные
+// горутинами чтения, и рисует их.
+func (app *App) Render() {
+	tab := app.tab()
+	for _, p := range tab.layout.Panes() {
+		if !tab.zoomed || p == tab.focus {
+			app.grid.Update(&p.view, p.session.term)
+		}
+	}
+	app.grid.Render()
+}
+
+// onChar обрабатывает ввод символов.
+func (app *App) onChar(w *glfw.Window, char rune) {
+	pane := app.tab().focus
+	if len(pane.prompts) > 0 {
+		// Ответ на вопрос о доступе к буферу обмена: 'y' разрешает, остальное запрещает.
+		if char == 'y' || char == 'Y' {
+			pane.session.applyClipboardRequest(pane.prompts[0])
+		}
+		pane.prompts = pane.prompts[1:]
+		return
+	}
+	if app.grid.hints.Active {
+		// Набор метки подсказки.
+		action := app.grid.hints.Action
+		if hint, ok := app.grid.hints.Type(char); ok {
+			pane.session.applyHint(hint, action, app.cfg.LinkOpener)
+		}
+		return
+	}
+	if app.grid.search.Active {
+		app.searchChar(char)
+		return
+	}
+	if app.grid.vi.Active {
+		app.viChar(char)
+		return
+	}
+	// Печатаемые символы отправляются оболочке в UTF-8.
+	pane.session.term.ScrollToBottom()
+	pane.session.Write([]byte(string(char)))
+}
+
+// onKey обрабатывает нажатия клавиш: сначала привязки к действиям, затем
+// специальные клавиши терминала.
+func (app *App) onKey(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	pane := app.tab().focus
+	if len(pane.prompts) > 0 {
+		// Пока показан вопрос, Enter и Escape отклоняют запрос, а остальные
+		// клавиши обрабатываются в onChar.
+		if action == glfw.Press && (key == glfw.KeyEnter || key == glfw.KeyEscape) {
+			pane.prompts = pane.prompts[1:]
+		}
+		return
+	}
+	if app.grid.hints.Active {
+		// Escape выходит из режима подсказок, метки набираются в onChar.
+		if action == glfw.Press && key == glfw.KeyEscape {
+			app.grid.hints.Cancel()
+		}
+		return
+	}
+	if action != glfw.Press && action != glfw.Repeat {
+		return
+	}
+	// Строку поиска и команды режима vi набирают в onChar, а здесь
+	// обрабатываются клавиши без символов. Остальные клавиши работают
+	// только как привязки, чтобы не попасть в программу.
+	if app.grid.search.Active && app.searchKey(key, mods) {
+		return
+	}
+	if app.grid.vi.Active && !app.grid.search.Active && app.viKey(key, mods) {
+		return
+	}
+
+	term := pane.session.term
+	if a, ok := lookupKeyBinding(app.cfg.KeyBindings, key, mods, term.AltScreen()); ok {
+		app.runAction(a)
+		return
+	}
+	if app.grid.search.Active || app.grid.vi.Active {
+		return
+	}
+	if seq := keySequence(key, mods, term.Mode(1)); seq != nil {
+		// Специальные клавиши преобразуются в управляющие последовательности.
+		term.ScrollToBottom()
+		pane.session.Write(seq)
+	}
+}
+
+// onMouseButton обрабатывает кнопки мыши. Щелчок по строке вкладок
+// переключает вкладку, щелчок по панели переводит на нее фокус, а линии
+// между панелями можно тянуть. Остальное уходит в отчеты о мыши для
+// приложений, включивших отслеживание мыши, в панели с фокусом.
+func (app *App) onMouseButton(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	x, y := w.GetCursorPos()
+	if tab := app.grid.TabAt(x, y); tab >= 0 {
+		if button == glfw.MouseButtonLeft && action == glfw.Press {
+			app.SelectTab(tab)
+		}
+		return
+	}
+	if app.PaneButton(button, action, x, y) {
+		return
+	}
+	session := app.tab().focus.session
+	if seq := app.mouse.Button(session.term, app.grid, button, action, mods, x, y); seq != nil {
+		session.Write(seq)
+	}
+}
+
+// onCursorPos обрабатывает перемещение мыши.
+func (app *App) onCursorPos(w *glfw.Window, x, y float64) {
+	if app.PaneMove(x, y) {
+		return
+	}
+	session := app.tab().focus.session
+	if seq := app.mouse.Move(session.term, app.grid, currentMods(w), x, y); seq != nil {
+		session.Write(seq)
+	}
+}
+
+// onScroll обрабатывает колесо мыши.
+func (app *App) onScroll(w *glfw.Window, xoff, yoff float64) {
+	x, y := w.GetCursorPos()
+	session := app.tab().focus.session
+	if seq := app.mouse.Scroll(session.term, app.grid, currentMods(w), x, y, xoff, yoff); seq != nil {
+		session.Write(seq)
+	}
+}
+
+// runAction выполняет действие, назначенное клавише.
+func (app *App) runAction(a Action) {
+	pane, grid := app.tab().focus, app.grid
+	session, term := pane.session, pane.session.term
+	switch a.Name {
+	case "copy":
+		if text := term.SelectionText(); text != "" {
+			glfw.SetClipboardString(text)
+		}
+	case "paste":
+		session.Paste(glfw.GetClipboardString())
+	case "paste_selection":
+		session.Paste(getPrimarySelection())
+	case "hints_open":
+		grid.StartHints(HintOpen)
+	case "hints_copy":
+		grid.StartHints(HintCopy)
+	case "hints_paste":
+		grid.StartHints(HintPaste)
+	case "search":
+		app.StartSearch()
+	case "vi_mode":
+		if app.grid.vi.Active {
+			app.closeVi()
+		} else {
+			app.StartVi()
+		}
+	case "next_theme":
+		app.setTheme((app.theme + 1) % len(app.themes))
+	case "font_size_up":
+		app.setFontSize(grid.font.size + 1)
+	case "font_size_down":
+		app.setFontSize(grid.font.size - 1)
+	case "font_size_reset":
+		app.setFontSize(app.baseFontSize)
+	case "scroll_line_up":
+		term.ScrollView(1)
+	case "scroll_line_down":
+		term.ScrollView(-1)
+	case "scroll_page_up":
+		term.ScrollView(pane.view.Rows - 1)
+	case "scroll_page_down":
+		term.ScrollView(-(pane.view.Rows - 1))
+	case "scroll_to_top":
+		term.ScrollToTop()
+	case "scroll_to_bottom":
+		term.ScrollToBottom()
+	case "prev_prompt":
+		term.ScrollToPrompt(-1)
+	case "next_prompt":
+		term.ScrollToPrompt(1)
+	case "select_output":
+		if term.SelectLastOutput() {
+			setPrimarySelection(term.SelectionText())
+		}
+	case "copy_output":
+		if text := term.LastOutput(); text != "" {
+			glfw.SetClipboardString(text)
+		}
+	case "toggle_fullscreen":
+		grid.ToggleFullscreen()
+	case "new_window":
+		app.windows.Open(app.cfg.Shell)
+	case "close_window":
+		app.window.SetShouldClose(true)
+	case "new_tab":
+		if err := app.NewTab(app.cfg.Shell, app.paneDir(pane)); err != nil {
+			log.Println(err)
+		}
+	case "close_tab":
+		app.CloseTab(app.active)
+	case "next_tab":
+		app.SelectTab((app.active + 1) % len(app.tabs))
+	case "prev_tab":
+		app.SelectTab((app.active + len(app.tabs) - 1) % len(app.tabs))
+	case "move_tab_forward":
+		app.MoveTab(1)
+	case "move_tab_backward":
+		app.MoveTab(-1)
+	case "split_horizontal":
+		app.SplitPane(SplitHorizontal)
+	case "split_vertical":
+		app.SplitPane(SplitVertical)
+	case "close_pane":
+		app.ClosePane(app.tab(), pane)
+	case "focus_left":
+		app.FocusPane(-1, 0)
+	case "focus_right":
+		app.FocusPane(1, 0)
+	case "focus_up":
+		app.FocusPane(0, -1)
+	case "focus_down":
+		app.FocusPane(0, 1)
+	case "zoom_pane":
+		app.ZoomPane()
+	case "send_text":
+		term.ScrollToBottom()
+		session.Write([]byte(a.Args[0]))
+	case "send_escape":
+		term.ScrollToBottom()
+		session.Write([]byte("\x1b" + a.Args[0]))
+	case "spawn":
+		cmd := exec.Command(a.Args[0], a.Args[1:]...)
+		if err := cmd.Start(); err != nil {
+			log.Println("failed to spawn command:", err)
+			return
+		}
+		go cmd.Wait()
+	}
+}
+
+// setTheme переключает все панели окна на цветовую схему themes[i].
+func (app *App) setTheme(i int) {
+	app.theme = i
+	app.palette = app.themes[i].Palette()
+	for _, tab := range app.tabs {
+		for _, p := range tab.layout.Panes() {
+			p.session.term.SetDefaultPalette(app.palette)
+		}
+	}
+}
+
+// setFontSize меняет размер шрифта и подгоняет под него сетку.
+func (app *App) setFontSize(size int) {
+	if size < minFontSize || size > maxFontSize || size == app.grid.font.size {
+		return
+	}
+	if err := app.grid.SetFontSize(size, app.cfg.ResizeOnZoom); err != nil {
+		log.Println(err)
+		return
+	}
+	app.resize()
+}
+
+// resize заново раскладывает панели всех вкладок по сетке.
+func (app *App) resize() {
+	for _, tab := range app.tabs {
+		app.arrange(tab)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// BindingMode ограничивает привязку состоянием терминала.
+type BindingMode int
+
+const (
+	BindAlways     BindingMode = iota // В любом режиме
+	BindMainScreen                    // Только на основном экране
+	BindAltScreen                     // Только на альтернативном экране (vim, less)
+)
+
+// bindingModeNames - имена режимов в таблицах [keybindings.<режим>].
+var bindingModeNames = map[string]BindingMode{"mainscreen": BindMainScreen, "altscreen": BindAltScreen}
+
+// KeyBinding связывает сочетание клавиш с действием.
+type KeyBinding struct {
+	Key    glfw.Key
+	Mods   glfw.ModifierKey
+	Mode   BindingMode
+	Action Action
+}
+
+const ctrlShift = glfw.ModControl | glfw.ModShift
+
+// defaultKeyBindings - привязки, действующие без файла конфигурации.
+var defaultKeyBindings = []KeyBinding{
+	{glfw.KeyC, ctrlShift, BindAlways, Action{Name: "copy"}},
+	{glfw.KeyV, ctrlShift, BindAlways, Action{Name: "paste"}},
+	{glfw.KeyInsert, glfw.ModShift, BindAlways, Action{Name: "paste_selection"}},
+	{glfw.KeyE, ctrlShift, BindAlways, Action{Name: "hints_open"}},
+	{glfw.KeyY, ctrlShift, BindAlways, Action{Name: "hints_copy"}},
+	{glfw.KeyP, ctrlShift, BindAlways, Action{Name: "hints_paste"}},
+	{glfw.KeyF, ctrlShift, BindAlways, Action{Name: "search"}},
+	{glfw.KeySpace, ctrlShift, BindAlways, Action{Name: "vi_mode"}},
+	{glfw.KeyM, ctrlShift, BindAlways, Action{Name: "next_theme"}},
+	{glfw.KeyF11, 0, BindAlways, Action{Name: "toggle_fullscreen"}},
+	{glfw.KeyEqual, glfw.ModControl, BindAlways, Action{Name: "font_size_up"}},
+	{glfw.KeyEqual, ctrlShift, BindAlways, Action{Name: "font_size_up"}}, // Ctrl++
+	{glfw.KeyMinus, glfw.ModControl, BindAlways, Action{Name: "font_size_down"}},
+	{glfw.Key0, glfw.ModControl, BindAlways, Action{Name: "font_size_reset"}},
+	{glfw.KeyN, ctrlShift, BindAlways, Action{Name: "new_window"}},
+	{glfw.KeyT, ctrlShift, BindAlways, Action{Name: "new_tab"}},
+	{glfw.KeyW, ctrlShift, BindAlways, Action{Name: "close_tab"}},
+	{glfw.KeyRight, ctrlShift, BindAlways, Action{Name: "next_tab"}},
+	{glfw.KeyLeft, ctrlShift, BindAlways, Action{Name: "prev_tab"}},
+	{glfw.KeyTab, glfw.ModControl, BindAlways, Action{Name: "next_tab"}},
+	{glfw.KeyTab, ctrlShift, BindAlways, Action{Name: "prev_tab"}},
+	{glfw.KeyPeriod, ctrlShift, BindAlways, Action{Name: "move_tab_forward"}},
+	{glfw.KeyComma, ctrlShift, BindAlways, Action{Name: "move_tab_backward"}},
+	{glfw.KeyBackslash, ctrlShift, BindAlways, Action{Name: "split_horizontal"}},
+	{glfw.KeyMinus, ctrlShift, BindAlways, Action{Name: "split_vertical"}},
+	{glfw.KeyX, ctrlShift, BindAlways, Action{Name: "close_pane"}},
+	{glfw.KeyH, ctrlShift, BindAlways, Action{Name: "focus_left"}},
+	{glfw.KeyL, ctrlShift, BindAlways, Action{Name: "focus_right"}},
+	{glfw.KeyK, ctrlShift, BindAlways, Action{Name: "focus_up"}},
+	{glfw.KeyJ, ctrlShift, BindAlways, Action{Name: "focus_down"}},
+	{glfw.KeyZ, ctrlShift, BindAlways, Action{Name: "zoom_pane"}},
+	// На альтернативном экране истории нет, и эти клавиши нужны программе
+	{glfw.KeyPageUp, glfw.ModShift, BindMainScreen, Action{Name: "scroll_page_up"}},
+	{glfw.KeyPageDown, glfw.ModShift, BindMainScreen, Action{Name: "scroll_page_down"}},
+	{glfw.KeyHome, glfw.ModShift, BindMainScreen, Action{Name: "scroll_to_top"}},
+	{glfw.KeyEnd, glfw.ModShift, BindMainScreen, Action{Name: "scroll_to_bottom"}},
+	{glfw.KeyUp, ctrlShift, BindMainScreen, Action{Name: "scroll_line_up"}},
+	{glfw.KeyDown, ctrlShift, BindMainScreen, Action{Name: "scroll_line_down"}},
+	{glfw.KeyPageUp, ctrlShift, BindMainScreen, Action{Name: "prev_prompt"}},
+	{glfw.KeyPageDown, ctrlShift, BindMainScreen, Action{Name: "next_prompt"}},
+	{glfw.KeyG, ctrlShift, BindMainScreen, Action{Name: "copy_output"}},
+}
+
+// keyNames - имена клавиш в описании сочетаний, кроме букв, цифр и F1-F25.
+var keyNames = map[string]glfw.Key{
+	"escape": glfw.KeyEscape, "esc": glfw.KeyEscape, "enter": glfw.KeyEnter,
+	"return": glfw.KeyEnter, "tab": glfw.KeyTab, "backspace": glfw.KeyBackspace,
+	"insert": glfw.KeyInsert, "delete": glfw.KeyDelete, "home": glfw.KeyHome,
+	"end": glfw.KeyEnd, "pageup": glfw.KeyPageUp, "pagedown": glfw.KeyPageDown,
+	"up": glfw.KeyUp, "down": glfw.KeyDown, "left": glfw.KeyLeft, "right": glfw.KeyRight,
+	"space": glfw.KeySpace, "minus": glfw.KeyMinus, "-": glfw.KeyMinus,
+	"equal": glfw.KeyEqual, "=": glfw.KeyEqual, "comma": glfw.KeyComma, ",": glfw.KeyComma,
+	"period": glfw.KeyPeriod, ".": glfw.KeyPeriod, "slash": glfw.KeySlash, "/": glfw.KeySlash,
+	"semicolon": glfw.KeySemicolon, ";": glfw.KeySemicolon, "apostrophe": glfw.KeyApostrophe,
+	"'": glfw.KeyApostrophe, "grave": glfw.KeyGraveAccent, "`": glfw.KeyGraveAccent,
+	"backslash": glfw.KeyBackslash, "\\": glfw.KeyBackslash,
+	"leftbracket": glfw.KeyLeftBracket, "[": glfw.KeyLeftBracket,
+	"rightbracket": glfw.KeyRightBracket, "]": glfw.KeyRightBracket,
+}
+
+// parseKeyCombo разбирает сочетание клавиш вида "ctrl+shift+c".
+func parseKeyCombo(s string) (glfw.Key, glfw.ModifierKey, error) {
+	parts := strings.Split(strings.ToLower(s), "+")
+	if strings.HasSuffix(s, "++") {
+		// Клавиша "+" записывается как "ctrl++"
+		parts = append(parts[:len(parts)-2], "equal")
+	}
+
+	var mods glfw.ModifierKey
+	for _, mod := range parts[:len(parts)-1] {
+		switch mod {
+		case "ctrl", "control":
+			mods |= glfw.ModControl
+		case "shift":
+			mods |= glfw.ModShift
+		case "alt":
+			mods |= glfw.ModAlt
+		case "super":
+			mods |= glfw.ModSuper
+		default:
+			return 0, 0, fmt.Errorf("unknown modifier %q in %q", mod, s)
+		}
+	}
+
+	name := parts[len(parts)-1]
+	switch {
+	case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+		return glfw.KeyA + glfw.Key(name[0]-'a'), mods, nil
+	case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+		return glfw.Key0 + glfw.Key(name[0]-'0'), mods, nil
+	}
+	var n int
+	if _, err := fmt.Sscanf(name, "f%d", &n); err == nil && n >= 1 && n <= 25 && name == fmt.Sprintf("f%d", n) {
+		return glfw.KeyF1 + glfw.Key(n-1), mods, nil
+	}
+	if key, ok := keyNames[name]; ok {
+		return key, mods, nil
+	}
+	return 0, 0, fmt.Errorf("unknown key %q in %q", name, s)
+}
+
+// formatKeyCombo записывает сочетание клавиш в виде, который понимает
+// parseKeyCombo.
+func formatKeyCombo(key glfw.Key, mods glfw.ModifierKey) string {
+	var parts []string
+	for _, m := range []struct {
+		mod  glfw.ModifierKey
+		name string
+	}{{glfw.ModControl, "ctrl"}, {glfw.ModShift, "shift"}, {glfw.ModAlt, "alt"}, {glfw.ModSuper, "super"}} {
+		if mods&m.mod != 0 {
+			parts = append(parts, m.name)
+		}
+	}
+
+	var name string
+	switch {
+	case key >= glfw.KeyA && key <= glfw.KeyZ:
+		name = string(rune('a' + key - glfw.KeyA))
+	case key >= glfw.Key0 && key <= glfw.Key9:
+		name = string(rune('0' + key - glfw.Key0))
+	case key >= glfw.KeyF1 && key <= glfw.KeyF25:
+		name = fmt.Sprintf("f%d", key-glfw.KeyF1+1)
+	default:
+		// Словесное имя предпочтительнее знака: "minus", а не "-"
+		for n, k := range keyNames {
+			if k == key && (len(n) > len(name) || len(n) == len(name) && n < name) {
+				name = n
+			}
+		}
+	}
+	return strings.Join(append(parts, name), "+")
+}
+
+// parseBindingKey разбирает ключ таблицы привязок: сочетание клавиш,
+// перед которым может стоять режим, например "altscreen.ctrl+f".
+func parseBindingKey(s string) (glfw.Key, glfw.ModifierKey, BindingMode, error) {
+	mode := BindAlways
+	if name, combo, ok := strings.Cut(s, "."); ok {
+		if m, ok := bindingModeNames[name]; ok {
+			mode, s = m, combo
+		}
+	}
+	key, mods, err := parseKeyCombo(s)
+	return key, mods, mode, err
+}
+
+// lookupKeyBinding возвращает действие для нажатой клавиши. Учитываются
+// только Ctrl, Shift, Alt и Super, чтобы Caps Lock и Num Lock не мешали.
+// Привязка для текущего экрана важнее привязки для любого режима.
+func lookupKeyBinding(bindings []KeyBinding, key glfw.Key, mods glfw.ModifierKey, altScreen bool) (Action, bool) {
+	mods &= glfw.ModControl | glfw.ModShift | glfw.ModAlt | glfw.ModSuper
+	screen := BindMainScreen
+	if altScreen {
+		screen = BindAltScreen
+	}
+
+	var found *KeyBinding
+	for i := range bindings {
+		b := &bindings[i]
+		if b.Key != key || b.Mods != mods || b.Mode != BindAlways && b.Mode != screen {
+			continue
+		}
+		if found == nil || found.Mode == BindAlways && b.Mode == screen {
+			found = b
+		}
+	}
+	if found == nil {
+		return Action{}, false
+	}
+	return found.Action, found.Action.Name != "none"
+}
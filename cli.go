@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// version - версия bareterm; при сборке задается через
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// Options - параметры командной строки.
+type Options struct {
+	Command     []string // Программа и аргументы после -e
+	Dir         string   // Рабочий каталог программы
+	Title       string   // Заголовок окна, пока программа не задала свой
+	Class       string   // Класс окна (WM_CLASS)
+	Config      string   // Путь к файлу настроек
+	Overrides   []string // Настройки key=value из -o
+	Hold        bool     // Не закрывать окно после завершения программы
+	Attach      bool     // Запускать программы на сервере bareterm и подключаться к его сессиям
+	Server      bool     // Работать сервером сессий без окна
+	PrintConfig bool
+	Version     bool
+}
+
+// stringList - флаг, который можно указать несколько раз.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// parseArgs разбирает аргументы командной строки (без имени программы).
+// Все аргументы после -e относятся к запускаемой программе.
+func parseArgs(args []string, output io.Writer) (Options, error) {
+	var opts Options
+	for i, arg := range args {
+		if arg == "-e" || arg == "--e" {
+			if i+1 >= len(args) {
+				return Options{}, errors.New("-e requires a command")
+			}
+			opts.Command = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("bareterm", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintln(output, "usage: bareterm [options] [-e command [args...]]")
+		fmt.Fprintln(output, "       bareterm msg [options] command [args...]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.Dir, "working-directory", "", "start the command in `dir`")
+	fs.StringVar(&opts.Title, "title", "", "window `title` until the program sets its own")
+	fs.StringVar(&opts.Class, "class", "bareterm", "window `class` (WM_CLASS)")
+	fs.StringVar(&opts.Config, "config", "", "read settings from `file` instead of "+configPath())
+	fs.Var((*stringList)(&opts.Overrides), "o", "override a setting, e.g. -o font.size=14 (`key=value`, repeatable)")
+	fs.BoolVar(&opts.Hold, "hold", false, "keep the window open after the command exits")
+	fs.BoolVar(&opts.Attach, "attach", false, "run programs in the session server and attach to its sessions")
+	fs.BoolVar(&opts.Server, "server", false, "run the session server without a window")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective settings and exit")
+	fs.BoolVar(&opts.Version, "version", false, "print the version and exit")
+	if err := fs.Parse(args); err != nil {
+		return Options{}, err
+	}
+	if fs.NArg() > 0 {
+		return Options{}, fmt.Errorf("unexpected argument %q (use -e to run a command)", fs.Arg(0))
+	}
+	return opts, nil
+}
+
+// parseOverrides переводит настройки -o key=value в записи TOML. Значение
+// разбирается как в файле настроек, а если это не удается - считается
+// строкой, поэтому -o font.family=Hack работает без кавычек.
+func parseOverrides(overrides []string) ([]tomlEntry, error) {
+	var entries []tomlEntry
+	for _, o := range overrides {
+		key, value, ok := strings.Cut(o, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid option %q: expected key=value", o)
+		}
+		v, err := tomlParseValue(strings.TrimSpace(value))
+		if err != nil {
+			v = value
+		}
+		entries = append(entries, tomlEntry{Key: key, tomlValue: tomlValue{Value: v}})
+	}
+	return entries, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Маркеры режима bracketed paste (режим 2004).
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// SelectionText возвращает выделенный текст. Мягко перенесенные строки
+// склеиваются, пробелы в конце строк отбрасываются.
+func (t *Terminal) SelectionText() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.selectionRange()
+	if !ok {
+		return ""
+	}
+	return t.rangeText(r)
+}
+
+// Text возвращает текст экрана, а со scrollback - вместе с историей
+// прокрутки. Строки склеиваются так же, как при копировании выделения.
+func (t *Terminal) Text(scrollback bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := SelectionRange{
+		Start: Point{Line: len(t.history)},
+		End:   Point{Line: len(t.history) + t.rows - 1, Col: t.cols - 1},
+	}
+	if scrollback {
+		r.Start.Line = 0
+	}
+	return strings.TrimRight(t.rangeText(r), "\n")
+}
+
+// rangeText возвращает текст диапазона. Вызывается под мьютексом.
+func (t *Terminal) rangeText(r SelectionRange) string {
+	var b strings.Builder
+	for line := r.Start.Line; line <= r.End.Line; line++ {
+		l := t.lineAt(line)
+		if l == nil {
+			break
+		}
+		from, to := 0, len(l.Cells)-1
+		if r.Block {
+			from, to = min(r.Start.Col, r.End.Col), max(r.Start.Col, r.End.Col)
+		} else {
+			if line == r.Start.Line {
+				from = r.Start.Col
+			}
+			if line == r.End.Line {
+				to = r.End.Col
+			}
+		}
+
+		var text strings.Builder
+		for col := from; col <= to && col < len(l.Cells); col++ {
+			c := l.Cells[col]
+			switch {
+			case c.Attr&AttrWideSpacer != 0:
+			case c.Char == 0:
+				text.WriteByte(' ')
+			default:
+				text.WriteRune(c.Char)
+			}
+		}
+
+		wrapped := l.Wrapped && !r.Block && line != r.End.Line
+		if wrapped {
+			b.WriteString(text.String())
+		} else {
+			b.WriteString(strings.TrimRight(text.String(), " \t"))
+			if line != r.End.Line {
+				b.WriteByte('\n')
+			}
+		}
+	}
+	return b.String()
+}
+
+// pasteData готовит вставляемый текст для отправки дочернему процессу:
+// переводы строк заменяются на CR, как при вводе с клавиатуры, а в режиме
+// bracketed paste текст оборачивается маркерами. Маркеры внутри самого
+// текста удаляются, чтобы вставка не могла завершиться досрочно и выполнить
+// остаток как команды.
+func pasteData(text string, bracketed bool) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+	if !bracketed {
+		return []byte(text)
+	}
+	for strings.Contains(text, pasteEnd) || strings.Contains(text, pasteStart) {
+		text = strings.ReplaceAll(text, pasteEnd, "")
+		text = strings.ReplaceAll(text, pasteStart, "")
+	}
+	return []byte(pasteStart + text + pasteEnd)
+}
+
+// Paste вставляет текст в дочерний процесс с учетом режима bracketed paste.
+func (s *Session) Paste(text string) {
+	if text == "" {
+		return
+	}
+	s.term.ScrollToBottom()
+	s.Write(pasteData(text, s.term.Mode(2004)))
+}
+
+// applyClipboardRequest выполняет запрос OSC 52. Вызывается только из
+// главного потока, как того требует GLFW.
+func (s *Session) applyClipboardRequest(req ClipboardRequest) {
+	switch {
+	case req.Read && req.Primary:
+		s.Write(osc52Reply(req, getPrimarySelection()))
+	case req.Read:
+		s.Write(osc52Reply(req, glfw.GetClipboardString()))
+	case req.Primary:
+		setPrimarySelection(req.Text)
+	default:
+		glfw.SetClipboardString(req.Text)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !((linux || freebsd || netbsd || openbsd) && !wayland)
+
+package main
+
+// primarySelection заменяет первичное выделение на платформах, где его нет:
+// текст доступен только внутри bareterm.
+var primarySelection string
+
+func setPrimarySelection(text string) {
+	primarySelection = text
+}
+
+func getPrimarySelection() string {
+	return primarySelection
+}
@@ -0,0 +1,15 @@
+//go:build (linux || freebsd || netbsd || openbsd) && !wayland
+
+package main
+
+import "github.com/go-gl/glfw/v3.3/glfw"
+
+// setPrimarySelection помещает текст в первичное выделение X11.
+func setPrimarySelection(text string) {
+	glfw.SetX11SelectionString(text)
+}
+
+// getPrimarySelection возвращает содержимое первичного выделения X11.
+func getPrimarySelection() string {
+	return glfw.GetX11SelectionString()
+}
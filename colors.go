@@ -0,0 +1,68 @@
+package main
+
+// Color описывает цвет ячейки: цвет по умолчанию, индекс палитры или RGB.
+// Старший байт хранит вид цвета, младшие три байта - его значение.
+type Color uint32
+
+const (
+	colorDefault Color = 0       // Цвет по умолчанию (Foreground или Background палитры)
+	colorIndexed Color = 1 << 24 // Индекс в 256-цветной палитре
+	colorRGB     Color = 2 << 24 // Цвет в формате 0xRRGGBB
+	colorKind    Color = 0xFF << 24
+)
+
+// IndexedColor возвращает цвет из палитры с заданным индексом.
+func IndexedColor(index uint8) Color {
+	return colorIndexed | Color(index)
+}
+
+// RGBColor возвращает цвет, заданный компонентами RGB.
+func RGBColor(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// IsDefault сообщает, является ли цвет цветом по умолчанию.
+func (c Color) IsDefault() bool {
+	return c&colorKind == colorDefault
+}
+
+// Index возвращает индекс палитры и true, если цвет индексный.
+func (c Color) Index() (uint8, bool) {
+	return uint8(c), c&colorKind == colorIndexed
+}
+
+// RGBA переводит RGB-цвет в компоненты OpenGL.
+func (c Color) RGBA() [4]float32 {
+	return [4]float32{
+		float32(c>>16&0xFF) / 255,
+		float32(c>>8&0xFF) / 255,
+		float32(c&0xFF) / 255,
+		1,
+	}
+}
+
+// ansiColors - стандартные 16 цветов xterm.
+var ansiColors = [16][3]uint8{
+	{0x00, 0x00, 0x00}, {0xCD, 0x00, 0x00}, {0x00, 0xCD, 0x00}, {0xCD, 0xCD, 0x00},
+	{0x00, 0x00, 0xEE}, {0xCD, 0x00, 0xCD}, {0x00, 0xCD, 0xCD}, {0xE5, 0xE5, 0xE5},
+	{0x7F, 0x7F, 0x7F}, {0xFF, 0x00, 0x00}, {0x00, 0xFF, 0x00}, {0xFF, 0xFF, 0x00},
+	{0x5C, 0x5C, 0xFF}, {0xFF, 0x00, 0xFF}, {0x00, 0xFF, 0xFF}, {0xFF, 0xFF, 0xFF},
+}
+
+// xtermPalette строит стандартную 256-цветную палитру xterm:
+// 16 базовых цветов, куб 6x6x6 и 24 оттенка серого.
+func xtermPalette() [256]Color {
+	var palette [256]Color
+	for i, c := range ansiColors {
+		palette[i] = RGBColor(c[0], c[1], c[2])
+	}
+	levels := [6]uint8{0x00, 0x5F, 0x87, 0xAF, 0xD7, 0xFF}
+	for i := 0; i < 216; i++ {
+		palette[16+i] = RGBColor(levels[i/36], levels[i/6%6], levels[i%6])
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + i*10)
+		palette[232+i] = RGBColor(v, v, v)
+	}
+	return palette
+}
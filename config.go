@@ -0,0 +1,427 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config - настройки bareterm из файла ~/.config/bareterm/bareterm.toml:
+//
+//	[window]
+//	width = 800          # Размер окна в пикселях
+//	height = 600
+//	columns = 40         # Размер сетки в символах
+//	rows = 20
+//	padding = 0          # Отступ от краев окна в пикселях
+//	resize_on_zoom = false   # Менять размер окна при смене размера шрифта,
+//	                         # сохраняя число строк и столбцов
+//	title_format = "{title}" # Заголовок окна и вкладок: {title} - заголовок
+//	                         # программы, {cwd} - ее рабочий каталог
+//
+//	[font]
+//	family = "DejaVuSansMono"
+//	size = 0             # 0 - по высоте ячейки
+//
+//	[colors]
+//	theme = "xterm"
+//	background = "#1c1c1c"   # Цвета темы можно переопределить
+//
+//	[shell]
+//	program = "/bin/bash"    # По умолчанию $SHELL
+//	args = ["-l"]
+//
+//	[scrollback]
+//	lines = 10000
+//
+//	[cursor]
+//	style = "block"      # block, underline или bar
+//	blink = false
+//
+//	[selection]
+//	word_separators = " \t,│`|:\"'()[]{}<>"   # Границы слова для двойного щелчка
+//
+//	[clipboard]
+//	read = "deny"        # Доступ программ к буферу обмена через OSC 52:
+//	write = "allow"      # allow, ask (спросить) или deny
+//	max_size = 524288    # Наибольший размер записываемого текста в байтах,
+//	                     # не больше 786426: строка OSC ограничена 1 МиБ
+//
+//	[hints]              # Шаблоны режима подсказок: имя = регулярное выражение.
+//	url = 'https?://\S+'    # url и path открываются, остальное копируется;
+//	path = ""            # пустое выражение убирает встроенный шаблон
+//	ticket = '[A-Z]+-\d+'
+//
+//	[links]
+//	opener = ["xdg-open"]    # Открывает ссылки и пути по Ctrl+щелчку и из
+//	                         # подсказок, получая их последним аргументом
+//
+//	[notifications]
+//	enabled = true       # Уведомления рабочего стола от программ (OSC 9/777/99)
+//	command = ["herbe"]  # Запускается с заголовком и текстом, если
+//	                     # D-Bus недоступна
+//
+//	[keybindings]
+//	"ctrl+shift+c" = "copy"
+//	"ctrl+alt+l" = ["send_text", "ls\n"]
+//	"altscreen.shift+pageup" = "none"   # Только на альтернативном экране
+type Config struct {
+	Width, Height  int
+	Columns, Rows  int
+	Padding        int
+	ResizeOnZoom   bool
+	TitleFormat    string // Шаблон заголовка с {title} и {cwd}
+	FontFamily     string
+	FontSize       int
+	Theme          Theme // Тема с переопределенными цветами
+	Shell          []string
+	Scrollback     int
+	CursorShape    CursorShape
+	CursorBlink    bool
+	WordSeparators string          // Границы слова для выделения
+	Clipboard      ClipboardPolicy // Права программ на доступ к буферу обмена
+	LinkOpener     []string        // Команда открытия ссылок
+	HintPatterns   []HintPattern   // Шаблоны режима подсказок по порядку
+	Notifications  bool            // Показывать уведомления программ
+	NotifyCommand  []string        // Команда для уведомлений без D-Bus
+	KeyBindings    []KeyBinding    // Привязки пользователя, затем привязки по умолчанию
+}
+
+// defaultConfig возвращает настройки по умолчанию.
+func defaultConfig() Config {
+	return Config{
+		Width:          800,
+		Height:         600,
+		Columns:        40,
+		Rows:           20,
+		TitleFormat:    "{title}",
+		FontFamily:     "DejaVuSansMono",
+		Theme:          xtermTheme(),
+		Scrollback:     10000,
+		CursorShape:    CursorBlock,
+		WordSeparators: defaultWordSeparators,
+		Clipboard:      defaultClipboardPolicy,
+		LinkOpener:     []string{"xdg-open"},
+		HintPatterns:   defaultHintPatterns,
+		Notifications:  true,
+		KeyBindings:    defaultKeyBindings,
+	}
+}
+
+// configPath возвращает путь к файлу настроек по умолчанию.
+func configPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bareterm", "bareterm.toml")
+}
+
+// LoadConfig читает настройки из файла и применяет поверх них настройки
+// командной строки. Если файла нет, за основу берутся настройки по умолчанию.
+func LoadConfig(path string, overrides []tomlEntry) (Config, error) {
+	themes, err := LoadThemes(themeDir())
+	if err != nil {
+		// Тема с ошибкой не мешает остальным настройкам
+		log.Println("failed to load themes:", err)
+	}
+
+	var entries []tomlEntry
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Config{}, fmt.Errorf("failed to read config: %v", err)
+		}
+		if entries, err = parseTOML(data); err != nil {
+			return Config{}, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return parseConfig(path, append(entries, overrides...), themes)
+}
+
+// parseConfig проверяет записи файла настроек path и строит по ним
+// настройки. Ошибки содержат номер строки или ключ из командной строки.
+func parseConfig(path string, entries []tomlEntry, themes []Theme) (Config, error) {
+	var err error
+	cfg := defaultConfig()
+	var colors []tomlEntry
+	var bindings []KeyBinding
+	var program string
+	var args []string
+	for _, e := range entries {
+		table, key, _ := strings.Cut(e.Key, ".")
+		switch {
+		case e.Key == "window.width":
+			err = e.intValue(&cfg.Width, 1, 1<<15)
+		case e.Key == "window.height":
+			err = e.intValue(&cfg.Height, 1, 1<<15)
+		case e.Key == "window.columns":
+			err = e.intValue(&cfg.Columns, 2, 1000)
+		case e.Key == "window.rows":
+			err = e.intValue(&cfg.Rows, 2, 1000)
+		case e.Key == "window.padding":
+			err = e.intValue(&cfg.Padding, 0, 1000)
+		case e.Key == "window.resize_on_zoom":
+			err = e.boolValue(&cfg.ResizeOnZoom)
+		case e.Key == "window.title_format":
+			err = e.stringValue(&cfg.TitleFormat)
+		case e.Key == "font.family":
+			err = e.stringValue(&cfg.FontFamily)
+		case e.Key == "font.size":
+			err = e.intValue(&cfg.FontSize, 0, 500)
+		case e.Key == "colors.theme":
+			var name string
+			if err = e.stringValue(&name); err == nil {
+				i := findTheme(themes, name)
+				if i < 0 {
+					err = fmt.Errorf("unknown theme %q", name)
+				} else {
+					cfg.Theme = themes[i]
+				}
+			}
+		case table == "colors":
+			colors = append(colors, e) // Применяются поверх темы
+		case e.Key == "shell.program":
+			err = e.stringValue(&program)
+		case e.Key == "shell.args":
+			err = e.stringsValue(&args)
+		case e.Key == "scrollback.lines":
+			err = e.intValue(&cfg.Scrollback, 0, 1000000)
+		case e.Key == "cursor.style":
+			var style string
+			if err = e.stringValue(&style); err == nil {
+				cfg.CursorShape, err = parseCursorShape(style)
+			}
+		case e.Key == "cursor.blink":
+			err = e.boolValue(&cfg.CursorBlink)
+		case e.Key == "selection.word_separators":
+			err = e.stringValue(&cfg.WordSeparators)
+		case e.Key == "clipboard.read":
+			err = e.clipboardValue(&cfg.Clipboard.Read)
+		case e.Key == "clipboard.write":
+			err = e.clipboardValue(&cfg.Clipboard.Write)
+		case e.Key == "clipboard.max_size":
+			err = e.intValue(&cfg.Clipboard.MaxSize, 0, maxClipboardSize)
+		case table == "hints":
+			var expr string
+			if err = e.stringValue(&expr); err == nil {
+				// Шаблоны по умолчанию общие для всех настроек
+				cfg.HintPatterns = slices.Clone(cfg.HintPatterns)
+				cfg.HintPatterns, err = setHintPattern(cfg.HintPatterns, key, expr)
+			}
+		case e.Key == "links.opener":
+			var opener []string
+			if err = e.stringsValue(&opener); err == nil {
+				if len(opener) == 0 {
+					err = errors.New("expected a command")
+				} else {
+					cfg.LinkOpener = opener
+				}
+			}
+		case e.Key == "notifications.enabled":
+			err = e.boolValue(&cfg.Notifications)
+		case e.Key == "notifications.command":
+			err = e.stringsValue(&cfg.NotifyCommand)
+		case table == "keybindings":
+			var b KeyBinding
+			if b.Key, b.Mods, b.Mode, err = parseBindingKey(key); err == nil {
+				b.Action, err = parseAction(e.Value)
+			}
+			// Привязка из -o заменяет привязку из файла
+			bindings = slices.DeleteFunc(bindings, func(old KeyBinding) bool {
+				return old.Key == b.Key && old.Mods == b.Mods && old.Mode == b.Mode
+			})
+			bindings = append(bindings, b)
+		default:
+			err = fmt.Errorf("unknown key %q", e.Key)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %v", e.position(path), err)
+		}
+	}
+
+	if program != "" {
+		cfg.Shell = append([]string{program}, args...)
+	} else if len(args) > 0 {
+		return Config{}, fmt.Errorf("%s: shell.args requires shell.program", path)
+	}
+	for _, e := range colors {
+		var value string
+		if err := e.stringValue(&value); err != nil {
+			return Config{}, fmt.Errorf("%s: %v", e.position(path), err)
+		}
+		_, key, _ := strings.Cut(e.Key, ".")
+		if err := cfg.Theme.setColor(key, value); err != nil {
+			return Config{}, fmt.Errorf("%s: %v", e.position(path), err)
+		}
+	}
+	// Привязки пользователя проверяются раньше привязок по умолчанию
+	cfg.KeyBindings = append(bindings, defaultKeyBindings...)
+	return cfg, nil
+}
+
+// parseCursorShape разбирает форму курсора из настроек.
+func parseCursorShape(s string) (CursorShape, error) {
+	switch s {
+	case "block":
+		return CursorBlock, nil
+	case "underline":
+		return CursorUnderline, nil
+	case "bar":
+		return CursorBar, nil
+	}
+	return 0, fmt.Errorf("unknown cursor style %q", s)
+}
+
+// position описывает, откуда взята запись: строка файла path или параметр -o.
+func (e *tomlEntry) position(path string) string {
+	if e.Line == 0 {
+		return "-o " + e.Key
+	}
+	return fmt.Sprintf("%s: line %d", path, e.Line)
+}
+
+func (v *tomlValue) intValue(dst *int, lo, hi int) error {
+	n, ok := v.Value.(int64)
+	if !ok {
+		return errors.New("expected an integer")
+	}
+	if n < int64(lo) || n > int64(hi) {
+		return fmt.Errorf("value %d is out of range %d-%d", n, lo, hi)
+	}
+	*dst = int(n)
+	return nil
+}
+
+func (v *tomlValue) stringValue(dst *string) error {
+	s, ok := v.Value.(string)
+	if !ok {
+		return errors.New("expected a string")
+	}
+	*dst = s
+	return nil
+}
+
+func (v *tomlValue) boolValue(dst *bool) error {
+	b, ok := v.Value.(bool)
+	if !ok {
+		return errors.New("expected true or false")
+	}
+	*dst = b
+	return nil
+}
+
+func (v *tomlValue) clipboardValue(dst *ClipboardAccess) error {
+	var s string
+	if err := v.stringValue(&s); err != nil {
+		return err
+	}
+	access, err := parseClipboardAccess(s)
+	if err == nil {
+		*dst = access
+	}
+	return err
+}
+
+func (v *tomlValue) stringsValue(dst *[]string) error {
+	items, ok := v.Value.([]any)
+	if !ok {
+		return errors.New("expected an array of strings")
+	}
+	*dst = (*dst)[:0]
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return errors.New("expected an array of strings")
+		}
+		*dst = append(*dst, s)
+	}
+	return nil
+}
+
+// WriteTOML записывает действующие настройки в формате файла настроек.
+func (c *Config) WriteTOML(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[window]\nwidth = %d\nheight = %d\ncolumns = %d\nrows = %d\npadding = %d\nresize_on_zoom = %t\ntitle_format = %s\n\n",
+		c.Width, c.Height, c.Columns, c.Rows, c.Padding, c.ResizeOnZoom, strconv.Quote(c.TitleFormat))
+	fmt.Fprintf(&b, "[font]\nfamily = %s\nsize = %d\n\n", strconv.Quote(c.FontFamily), c.FontSize)
+
+	th := &c.Theme
+	fmt.Fprintf(&b, "[colors]\ntheme = %s\n", strconv.Quote(th.Name))
+	for _, color := range []struct {
+		key   string
+		value Color
+	}{
+		{"foreground", th.Foreground}, {"background", th.Background}, {"cursor", th.Cursor},
+		{"selection_background", th.SelectionBG}, {"selection_foreground", th.SelectionFG},
+	} {
+		if !color.value.IsDefault() {
+			fmt.Fprintf(&b, "%s = \"%s\"\n", color.key, color.value.hex())
+		}
+	}
+	for i, color := range th.ANSI {
+		fmt.Fprintf(&b, "color%d = \"%s\"\n", i, color.hex())
+	}
+
+	b.WriteString("\n[shell]\n")
+	if len(c.Shell) > 0 {
+		fmt.Fprintf(&b, "program = %s\n", strconv.Quote(c.Shell[0]))
+		fmt.Fprintf(&b, "args = %s\n", tomlStrings(c.Shell[1:]))
+	} else {
+		b.WriteString("# program = $SHELL\n")
+	}
+
+	fmt.Fprintf(&b, "\n[scrollback]\nlines = %d\n\n", c.Scrollback)
+	fmt.Fprintf(&b, "[cursor]\nstyle = %q\nblink = %t\n\n", [...]string{"block", "underline", "bar"}[c.CursorShape], c.CursorBlink)
+	fmt.Fprintf(&b, "[selection]\nword_separators = %s\n\n", strconv.Quote(c.WordSeparators))
+	fmt.Fprintf(&b, "[clipboard]\nread = %q\nwrite = %q\nmax_size = %d\n\n", c.Clipboard.Read, c.Clipboard.Write, c.Clipboard.MaxSize)
+	b.WriteString("[hints]\n")
+	for _, p := range c.HintPatterns {
+		fmt.Fprintf(&b, "%s = %s\n", strconv.Quote(p.Name), strconv.Quote(p.Regexp.String()))
+	}
+	for _, p := range defaultHintPatterns {
+		if !slices.ContainsFunc(c.HintPatterns, func(q HintPattern) bool { return q.Name == p.Name }) {
+			fmt.Fprintf(&b, "%s = \"\"\n", strconv.Quote(p.Name))
+		}
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "[links]\nopener = %s\n\n", tomlStrings(c.LinkOpener))
+	fmt.Fprintf(&b, "[notifications]\nenabled = %t\n", c.Notifications)
+	if len(c.NotifyCommand) > 0 {
+		fmt.Fprintf(&b, "command = %s\n", tomlStrings(c.NotifyCommand))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("[keybindings]\n")
+	seen := make(map[string]bool)
+	for _, kb := range c.KeyBindings {
+		combo := formatKeyCombo(kb.Key, kb.Mods)
+		for name, mode := range bindingModeNames {
+			if kb.Mode == mode {
+				combo = name + "." + combo
+			}
+		}
+		if !seen[combo] {
+			seen[combo] = true
+			fmt.Fprintf(&b, "%s = %s\n", strconv.Quote(combo), kb.Action)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// tomlStrings записывает массив строк TOML.
+func tomlStrings(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
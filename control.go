@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// controlSocketEnv - переменная окружения с путем к сокету удаленного
+// управления. Ее получают программы, запущенные в окнах.
+const controlSocketEnv = "BARETERM_SOCKET"
+
+// ControlRequest - команда удаленного управления. Сокет принимает команды в
+// JSON, по одной в строке, и на каждую отвечает одной строкой
+// ControlResponse. Панель 0 означает панель с фокусом в активном окне.
+type ControlRequest struct {
+	Cmd        string   `json:"cmd"`
+	Window     int      `json:"window,omitempty"`
+	Pane       int      `json:"pane,omitempty"`
+	Text       string   `json:"text,omitempty"`       // send_text
+	Scrollback bool     `json:"scrollback,omitempty"` // get_text: вместе с историей
+	Title      string   `json:"title,omitempty"`      // set_title: пустой возвращает заголовок программы
+	Size       int      `json:"size,omitempty"`       // set_font_size: новый размер
+	Delta      int      `json:"delta,omitempty"`      // set_font_size: изменение размера
+	Theme      string   `json:"theme,omitempty"`      // set_theme
+	Command    []string `json:"command,omitempty"`    // new_tab: пустая - оболочка
+	Cwd        string   `json:"cwd,omitempty"`        // new_tab: пустой - каталог панели
+	Events     []string `json:"events,omitempty"`     // subscribe: пустой - все события
+}
+
+// ControlResponse - ответ на команду.
+type ControlResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// ControlEvent - событие для подписчиков: смена заголовка (title), звонок
+// (bell) или завершение программы панели (command_finished).
+type ControlEvent struct {
+	Event   string `json:"event"`
+	Window  int    `json:"window"`
+	Tab     int    `json:"tab"`
+	Pane    int    `json:"pane"`
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Описания окон, вкладок и панелей для команды list.
+type (
+	controlWindow struct {
+		ID      int          `json:"id"`
+		Focused bool         `json:"focused"`
+		Tabs    []controlTab `json:"tabs"`
+	}
+	controlTab struct {
+		ID     int           `json:"id"`
+		Active bool          `json:"active"`
+		Panes  []controlPane `json:"panes"`
+	}
+	controlPane struct {
+		ID      int    `json:"id"`
+		Title   string `json:"title"`
+		Cwd     string `json:"cwd"`
+		Focused bool   `json:"focused"`
+		Rows    int    `json:"rows"`
+		Cols    int    `json:"cols"`
+	}
+)
+
+// Control - сокет удаленного управления окнами процесса. Команды
+// выполняются в главном потоке через Windows.Do.
+type Control struct {
+	windows  *Windows
+	listener net.Listener
+	path     string
+
+	mu          sync.Mutex
+	subscribers map[chan ControlEvent]bool
+}
+
+// NewControl открывает сокет удаленного управления рядом с сокетом сервера
+// сессий и начинает принимать соединения.
+func NewControl(windows *Windows) (*Control, error) {
+	path := filepath.Join(filepath.Dir(socketPath()), "control-"+strconv.Itoa(os.Getpid())+".sock")
+	if err := makeSocketDir(); err != nil {
+		return nil, err
+	}
+	os.Remove(path) // Сокет мог остаться от процесса с тем же номером
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
+	}
+	c := &Control{
+		windows:     windows,
+		listener:    l,
+		path:        path,
+		subscribers: make(map[chan ControlEvent]bool),
+	}
+	go c.serve()
+	return c, nil
+}
+
+// Path возвращает путь к сокету.
+func (c *Control) Path() string {
+	return c.path
+}
+
+// Close закрывает сокет.
+func (c *Control) Close() error {
+	return c.listener.Close()
+}
+
+func (c *Control) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("failed to accept control connection:", err)
+			}
+			return
+		}
+		go c.serveConn(conn)
+	}
+}
+
+// serveConn выполняет команды одного соединения. После subscribe
+// соединение только получает события.
+func (c *Control) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req ControlRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			enc.Encode(ControlResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+		if req.Cmd == "subscribe" {
+			c.subscribe(conn, enc, req.Events)
+			return
+		}
+		var resp ControlResponse
+		c.windows.Do(func() {
+			resp = c.windows.handle(req)
+		})
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// subscribe передает события соединению, пока оно не закроется.
+func (c *Control) subscribe(conn net.Conn, enc *json.Encoder, events []string) {
+	ch := make(chan ControlEvent, 64)
+	c.mu.Lock()
+	c.subscribers[ch] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscribers, ch)
+		c.mu.Unlock()
+	}()
+
+	if err := enc.Encode(ControlResponse{OK: true}); err != nil {
+		return
+	}
+	// Подписчик ничего не присылает; чтение замечает закрытие соединения
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case event := <-ch:
+			if len(events) > 0 && !slices.Contains(events, event.Event) {
+				continue
+			}
+			if err := enc.Encode(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Publish рассылает событие подписчикам. Подписчик, который не успевает
+// читать, пропускает события.
+func (c *Control) Publish(event ControlEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// handle выполняет команду удаленного управления. Вызывается из главного
+// потока.
+func (w *Windows) handle(req ControlRequest) ControlResponse {
+	if req.Cmd == "list" {
+		return ControlResponse{OK: true, Data: w.list()}
+	}
+	app, pane := w.target(req)
+	if pane == nil {
+		return ControlResponse{Error: "no such window or pane"}
+	}
+	switch req.Cmd {
+	case "send_text":
+		pane.session.term.ScrollToBottom()
+		if _, err := pane.session.Write([]byte(req.Text)); err != nil {
+			return ControlResponse{Error: err.Error()}
+		}
+	case "get_text":
+		return ControlResponse{OK: true, Data: pane.session.term.Text(req.Scrollback)}
+	case "set_title":
+		pane.title = req.Title
+	case "set_font_size":
+		size := req.Size
+		if size == 0 {
+			size = app.grid.font.size + req.Delta
+		}
+		if size < minFontSize || size > maxFontSize {
+			return ControlResponse{Error: fmt.Sprintf("font size must be between %d and %d", minFontSize, maxFontSize)}
+		}
+		app.setFontSize(size)
+	case "set_theme":
+		i := findTheme(app.themes, req.Theme)
+		if i < 0 {
+			return ControlResponse{Error: fmt.Sprintf("unknown theme %q", req.Theme)}
+		}
+		app.setTheme(i)
+	case "new_tab":
+		command := req.Command
+		if len(command) == 0 {
+			command = app.cfg.Shell
+		}
+		dir := req.Cwd
+		if dir == "" {
+			dir = app.paneDir(pane)
+		}
+		if err := app.NewTab(command, dir); err != nil {
+			return ControlResponse{Error: err.Error()}
+		}
+		return ControlResponse{OK: true, Data: app.tab().focus.id}
+	default:
+		return ControlResponse{Error: fmt.Sprintf("unknown command %q", req.Cmd)}
+	}
+	return ControlResponse{OK: true}
+}
+
+// target находит окно и панель команды: панель по номеру, панель с
+// фокусом окна по номеру или панель с фокусом в окне с фокусом ввода.
+func (w *Windows) target(req ControlRequest) (*App, *Pane) {
+	for _, app := range w.apps {
+		if req.Pane != 0 {
+			for _, tab := range app.tabs {
+				for _, p := range tab.layout.Panes() {
+					if p.id == req.Pane {
+						return app, p
+					}
+				}
+			}
+			continue
+		}
+		if req.Window == app.id || req.Window == 0 && app.window.GetAttrib(glfw.Focused) == glfw.True {
+			return app, app.tab().focus
+		}
+	}
+	if req.Pane == 0 && req.Window == 0 && len(w.apps) > 0 {
+		app := w.apps[0]
+		return app, app.tab().focus
+	}
+	return nil, nil
+}
+
+// list описывает окна, вкладки и панели.
+func (w *Windows) list() []controlWindow {
+	windows := make([]controlWindow, 0, len(w.apps))
+	for _, app := range w.apps {
+		cw := controlWindow{ID: app.id, Focused: app.window.GetAttrib(glfw.Focused) == glfw.True}
+		for i, tab := range app.tabs {
+			ct := controlTab{ID: tab.id, Active: i == app.active}
+			for _, p := range tab.layout.Panes() {
+				ct.Panes = append(ct.Panes, controlPane{
+					ID:      p.id,
+					Title:   p.Title(app.cfg.TitleFormat),
+					Cwd:     p.session.Cwd(),
+					Focused: p == tab.focus,
+					Rows:    p.view.Rows,
+					Cols:    p.view.Cols,
+				})
+			}
+			cw.Tabs = append(cw.Tabs, ct)
+		}
+		windows = append(windows, cw)
+	}
+	return windows
+}
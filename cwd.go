@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// localHostname - имя этой машины для проверки адресов file://.
+var localHostname = sync.OnceValue(func() string {
+	name, _ := os.Hostname()
+	return name
+})
+
+// parseOSC7 разбирает адрес OSC 7 вида file://host/path. Каталог на другой
+// машине (например, из ssh) здесь не открыть, поэтому принимаются только
+// пустое имя, localhost и имя этой машины.
+func parseOSC7(arg string) (string, bool) {
+	rest, ok := strings.CutPrefix(arg, "file://")
+	if !ok {
+		return "", false
+	}
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return "", false
+	}
+	host, path := rest[:i], rest[i:]
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i] // Порт не нужен
+	}
+	if checkFileHost(host) != nil {
+		return "", false
+	}
+	// Оболочки не всегда кодируют путь, поэтому ошибка кодирования
+	// оставляет путь как есть
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return filepath.Clean(path), true
+}
+
+// cwdOSC обрабатывает OSC 7: программа сообщает свой рабочий каталог.
+func (t *Terminal) cwdOSC(arg string) {
+	if path, ok := parseOSC7(arg); ok {
+		t.cwd = path
+	}
+}
+
+// Cwd возвращает рабочий каталог, сообщенный программой через OSC 7, или
+// пустую строку.
+func (t *Terminal) Cwd() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cwd
+}
+
+// osc7 формирует OSC 7 для каталога path.
+func osc7(path string) string {
+	return "\x1b]7;" + (&url.URL{Scheme: "file", Path: path}).String() + "\x1b\\"
+}
+
+// shortPath заменяет домашний каталог в начале пути на ~.
+func shortPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(path, home+"/"); ok {
+		return "~/" + rest
+	}
+	return path
+}
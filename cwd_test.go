@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOSC7(t *testing.T) {
+	for _, tt := range []struct {
+		arg  string
+		want string
+		ok   bool
+	}{
+		{"file:///home/user", "/home/user", true},
+		{"file://localhost/tmp/", "/tmp", true},
+		{"file://" + localHostname() + "/srv", "/srv", true},
+		{"file://" + localHostname() + ":22/srv", "/srv", true},
+		{"file:///tmp/a%20b", "/tmp/a b", true},
+		{"file://elsewhere.example/tmp", "", false},
+		{"file://host", "", false},
+		{"/tmp", "", false},
+	} {
+		got, ok := parseOSC7(tt.arg)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseOSC7(%q) = %q, %t, want %q, %t", tt.arg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// Каталог, который сообщает shell/bareterm.bash, разбирается без искажений.
+func TestParseOSC7Bash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	dir := filepath.Join(t.TempDir(), "a b", "ü%20x")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", "--norc", "-ic", `. shell/bareterm.bash; __bareterm_urlencode "$1"; printf %s "$REPLY"`, "bash", dir)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to run bash: %v", err)
+	}
+	if got, ok := parseOSC7("file://" + string(out)); !ok || got != dir {
+		t.Errorf("parseOSC7(%q) = %q, %t, want %q", out, got, ok, dir)
+	}
+}
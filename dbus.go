@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dbusTimeout ограничивает ожидание ответа на вызов метода D-Bus.
+const dbusTimeout = 5 * time.Second
+
+// maxDBusMessage ограничивает размер сообщения от шины.
+const maxDBusMessage = 1 << 20
+
+// Типы сообщений D-Bus.
+const (
+	dbusMethodCall   byte = 1
+	dbusMethodReturn byte = 2
+	dbusError        byte = 3
+)
+
+// Поля заголовка сообщения D-Bus.
+const (
+	dbusFieldPath        byte = 1
+	dbusFieldInterface   byte = 2
+	dbusFieldMember      byte = 3
+	dbusFieldErrorName   byte = 4
+	dbusFieldReplySerial byte = 5
+	dbusFieldDestination byte = 6
+	dbusFieldSignature   byte = 8
+)
+
+// dbusConn - соединение с сессионной шиной D-Bus. Реализована только часть
+// протокола, нужная для вызова методов: аутентификация EXTERNAL и
+// аргументы из строк, чисел, массивов строк и словаря a{sv} с байтами.
+type dbusConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dialSessionBus подключается к сессионной шине из
+// $DBUS_SESSION_BUS_ADDRESS, а если адрес не задан - к
+// $XDG_RUNTIME_DIR/bus, и регистрируется на ней вызовом Hello.
+func dialSessionBus() (*dbusConn, error) {
+	addrs := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); addrs == "" && dir != "" {
+		addrs = "unix:path=" + dir + "/bus"
+	}
+	if addrs == "" {
+		return nil, errors.New("no session bus address")
+	}
+	var err error
+	for _, addr := range strings.Split(addrs, ";") {
+		var conn net.Conn
+		if conn, err = dialDBusAddress(addr); err != nil {
+			continue
+		}
+		c := &dbusConn{conn: conn, r: bufio.NewReader(conn)}
+		if err = c.auth(); err == nil {
+			if err = c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err == nil {
+				return c, nil
+			}
+		}
+		conn.Close()
+	}
+	return nil, fmt.Errorf("failed to connect to session bus: %v", err)
+}
+
+// dialDBusAddress подключается по адресу D-Bus вида unix:path=... или
+// unix:abstract=...
+func dialDBusAddress(addr string) (net.Conn, error) {
+	transport, params, _ := strings.Cut(addr, ":")
+	if transport != "unix" {
+		return nil, fmt.Errorf("unsupported bus transport %q", transport)
+	}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(param, "=")
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bus address %q", addr)
+		}
+		switch key {
+		case "path":
+			return net.DialTimeout("unix", value, dbusTimeout)
+		case "abstract":
+			return net.DialTimeout("unix", "@"+value, dbusTimeout)
+		}
+	}
+	return nil, fmt.Errorf("unsupported bus address %q", addr)
+}
+
+// auth проходит аутентификацию EXTERNAL: шина сверяет переданный номер
+// пользователя с владельцем сокета.
+func (c *dbusConn) auth() error {
+	c.conn.SetDeadline(time.Now().Add(dbusTimeout))
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return fmt.Errorf("failed to authenticate: %v", err)
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %v", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("authentication rejected: %s", strings.TrimSpace(line))
+	}
+	if _, err := io.WriteString(c.conn, "BEGIN\r\n"); err != nil {
+		return fmt.Errorf("failed to authenticate: %v", err)
+	}
+	return nil
+}
+
+// Close закрывает соединение с шиной.
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+// Call вызывает метод member интерфейса iface объекта path у dest с
+// аргументами args по сигнатуре sig и ждет ответа. Результат метода не
+// разбирается.
+func (c *dbusConn) Call(dest, path, iface, member, sig string, args ...any) error {
+	c.serial++
+	msg, err := c.methodCall(dest, path, iface, member, sig, args)
+	if err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Now().Add(dbusTimeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to call %s: %v", member, err)
+	}
+	for {
+		typ, reply, body, err := c.readMessage()
+		if err != nil {
+			return fmt.Errorf("failed to call %s: %v", member, err)
+		}
+		if reply != c.serial {
+			continue // Сигналы и ответы на чужие вызовы
+		}
+		switch typ {
+		case dbusMethodReturn:
+			return nil
+		case dbusError:
+			return fmt.Errorf("%s failed: %s", member, body)
+		}
+	}
+}
+
+// methodCall кодирует сообщение вызова метода.
+func (c *dbusConn) methodCall(dest, path, iface, member, sig string, args []any) ([]byte, error) {
+	var body dbusEncoder
+	for _, arg := range args {
+		if err := body.value(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	var e dbusEncoder
+	e.buf = append(e.buf, 'l', dbusMethodCall, 0, 1)
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(c.serial)
+	fields := []struct {
+		code      byte
+		sig, text string
+	}{
+		{dbusFieldPath, "o", path},
+		{dbusFieldInterface, "s", iface},
+		{dbusFieldMember, "s", member},
+		{dbusFieldDestination, "s", dest},
+		{dbusFieldSignature, "g", sig},
+	}
+	size, start := e.arrayStart(8)
+	for _, f := range fields {
+		if f.sig == "g" && f.text == "" {
+			continue // Метод без аргументов
+		}
+		e.align(8)
+		e.buf = append(e.buf, f.code)
+		e.signature(f.sig)
+		if f.sig == "g" {
+			e.signature(f.text)
+		} else {
+			e.string(f.text)
+		}
+	}
+	e.arrayEnd(size, start)
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+// readMessage читает сообщение шины и возвращает его тип, номер вызова,
+// на который оно отвечает, и для ошибок - имя и текст ошибки.
+func (c *dbusConn) readMessage() (typ byte, reply uint32, text string, err error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(c.r, fixed[:]); err != nil {
+		return 0, 0, "", err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	switch fixed[0] {
+	case 'l':
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return 0, 0, "", fmt.Errorf("invalid byte order %q", fixed[0])
+	}
+	bodyLen, fieldsLen := order.Uint32(fixed[4:]), order.Uint32(fixed[12:])
+	if bodyLen > maxDBusMessage || fieldsLen > maxDBusMessage {
+		return 0, 0, "", errors.New("message too large")
+	}
+	// Поля заголовка дополняются до границы 8 байт
+	rest := make([]byte, (fieldsLen+7)&^7+bodyLen)
+	if _, err := io.ReadFull(c.r, rest); err != nil {
+		return 0, 0, "", err
+	}
+	d := dbusDecoder{buf: rest[:fieldsLen], order: order}
+	var name, sig string
+	for d.pos < len(d.buf) && d.err == nil {
+		d.align(8)
+		code := d.byte()
+		switch d.signature() {
+		case "s", "o":
+			s := d.string()
+			if code == dbusFieldErrorName {
+				name = s
+			}
+		case "g":
+			s := d.signature()
+			if code == dbusFieldSignature {
+				sig = s
+			}
+		case "u":
+			n := d.uint32()
+			if code == dbusFieldReplySerial {
+				reply = n
+			}
+		default:
+			d.err = errors.New("unsupported header field")
+		}
+	}
+	if d.err != nil {
+		return 0, 0, "", d.err
+	}
+	text = name
+	if fixed[1] == dbusError && strings.HasPrefix(sig, "s") {
+		body := dbusDecoder{buf: rest[(fieldsLen+7)&^7:], order: order}
+		if s := body.string(); body.err == nil {
+			text += ": " + s
+		}
+	}
+	return fixed[1], reply, text, nil
+}
+
+// dbusEncoder кодирует значения D-Bus в порядке байтов little endian.
+// Выравнивание отсчитывается от начала буфера, поэтому тело сообщения
+// кодируется отдельным кодировщиком.
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(append(e.buf, s...), 0)
+}
+
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+}
+
+// arrayStart начинает массив с элементами, выровненными по n байт, и
+// возвращает для arrayEnd место длины и начало элементов.
+func (e *dbusEncoder) arrayStart(n int) (size, start int) {
+	e.uint32(0)
+	size = len(e.buf) - 4
+	e.align(n)
+	return size, len(e.buf)
+}
+
+// arrayEnd записывает длину массива: выравнивание перед первым элементом
+// в нее не входит.
+func (e *dbusEncoder) arrayEnd(size, start int) {
+	binary.LittleEndian.PutUint32(e.buf[size:], uint32(len(e.buf)-start))
+}
+
+// value кодирует аргумент метода: s, u, i, as или a{sv} с байтовыми
+// значениями.
+func (e *dbusEncoder) value(v any) error {
+	switch v := v.(type) {
+	case string:
+		e.string(v)
+	case uint32:
+		e.uint32(v)
+	case int32:
+		e.uint32(uint32(v))
+	case []string:
+		size, start := e.arrayStart(4)
+		for _, s := range v {
+			e.string(s)
+		}
+		e.arrayEnd(size, start)
+	case map[string]byte:
+		size, start := e.arrayStart(8)
+		for key, b := range v {
+			e.align(8)
+			e.string(key)
+			e.signature("y")
+			e.buf = append(e.buf, b)
+		}
+		e.arrayEnd(size, start)
+	default:
+		return fmt.Errorf("unsupported D-Bus argument %T", v)
+	}
+	return nil
+}
+
+// dbusDecoder читает значения D-Bus. Первая ошибка сохраняется в err, и
+// дальнейшие чтения возвращают нулевые значения.
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *dbusDecoder) align(n int) {
+	d.pos = (d.pos + n - 1) / n * n
+}
+
+func (d *dbusDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || d.pos+n > len(d.buf) {
+		d.err = errors.New("truncated message")
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *dbusDecoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *dbusDecoder) uint32() uint32 {
+	d.align(4)
+	if b := d.next(4); b != nil {
+		return d.order.Uint32(b)
+	}
+	return 0
+}
+
+func (d *dbusDecoder) string() string {
+	n := d.uint32()
+	s := d.next(int(n) + 1)
+	if s == nil {
+		return ""
+	}
+	return string(s[:n])
+}
+
+func (d *dbusDecoder) signature() string {
+	n := d.byte()
+	s := d.next(int(n) + 1)
+	if s == nil {
+		return ""
+	}
+	return string(s[:n])
+}
@@ -23,40 +23,113 @@ type Font struct {
 	textures map[rune]uint32 // Кэш текстур для каждого символа
 	size     int             // Размер шрифта
 	path     string          // Путь к файлу шрифта
+	cell     [2]int          // Размер ячейки по метрикам шрифта (ширина, высота)
+	ascent   int             // Расстояние от верха ячейки до базовой линии
+	key      fontKey         // Ключ в кэше шрифтов
+	refs     int             // Число окон, использующих шрифт
 }
 
-// NewFont создает новый экземпляр Font
-func NewFont(fontName string, size int) (*Font, error) {
+// fontKey - имя и размер шрифта в кэше.
+type fontKey struct {
+	name string
+	size int
+}
+
+// fontFile - найденный и разобранный файл шрифта.
+type fontFile struct {
+	path string
+	font *truetype.Font
+}
+
+// Кэши шрифтов общие для всех окон процесса: файлы ищутся и разбираются один
+// раз, а текстуры глифов одного размера создаются один раз и видны во всех
+// окнах, потому что их контексты OpenGL разделяют объекты. Используются
+// только из главного потока.
+var (
+	fonts     = map[fontKey]*Font{}
+	fontFiles = map[string]fontFile{}
+)
+
+// LoadFont возвращает шрифт из кэша или загружает его. Шрифт нужно
+// освободить вызовом Release.
+func LoadFont(fontName string, size int) (*Font, error) {
+	key := fontKey{fontName, size}
+	if f, ok := fonts[key]; ok {
+		f.refs++
+		return f, nil
+	}
+	f, err := NewFont(fontName, size)
+	if err != nil {
+		return nil, err
+	}
+	f.key, f.refs = key, 1
+	fonts[key] = f
+	return f, nil
+}
+
+// Release освобождает шрифт, полученный от LoadFont. Текстуры удаляются,
+// когда шрифт больше не нужен ни одному окну.
+func (f *Font) Release() {
+	f.refs--
+	if f.refs == 0 {
+		delete(fonts, f.key)
+		f.Destroy()
+	}
+}
+
+// parseFontFile ищет и разбирает файл шрифта или берет его из кэша.
+func parseFontFile(fontName string) (fontFile, error) {
+	if file, ok := fontFiles[fontName]; ok {
+		return file, nil
+	}
+
 	// Поиск TTF файла шрифта
 	fontPath, err := findTTFFont(fontName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find font: %v", err)
+		return fontFile{}, fmt.Errorf("failed to find font: %v", err)
 	}
 
 	// Чтение файла шрифта
 	fontBytes, err := ioutil.ReadFile(fontPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read font file: %v", err)
+		return fontFile{}, fmt.Errorf("failed to read font file: %v", err)
 	}
 
 	// Парсинг TTF данных
 	f, err := truetype.Parse(fontBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse font: %v", err)
+		return fontFile{}, fmt.Errorf("failed to parse font: %v", err)
+	}
+	file := fontFile{path: fontPath, font: f}
+	fontFiles[fontName] = file
+	return file, nil
+}
+
+// NewFont создает новый экземпляр Font
+func NewFont(fontName string, size int) (*Font, error) {
+	file, err := parseFontFile(fontName)
+	if err != nil {
+		return nil, err
 	}
 
 	// Создание face для заданного размера шрифта
-	face := truetype.NewFace(f, &truetype.Options{
+	face := truetype.NewFace(file.font, &truetype.Options{
 		Size:    float64(size),
 		DPI:     72,
 		Hinting: font.HintingFull,
 	})
 
+	// Ширина ячейки - ширина 'M' моноширинного шрифта, высота - от верхнего
+	// до нижнего выносного элемента
+	metrics := face.Metrics()
+	advance, _ := face.GlyphAdvance('M')
 	font := &Font{
 		face:     face,
 		textures: make(map[rune]uint32),
 		size:     size,
-		path:     fontPath,
+		path:     file.path,
+		cell:     [2]int{max(advance.Round(), 1), max((metrics.Ascent + metrics.Descent).Ceil(), 1)},
+		ascent:   metrics.Ascent.Ceil(),
 	}
 
 	// Прогрев кэша для часто используемых символов
@@ -99,29 +172,22 @@ func (f *Font) GetCharTexture(char rune) uint32 {
 		return texture
 	}
 
-	// Получение границ глифа
-	bounds, advance, ok := f.face.GlyphBounds(char)
+	// Получение ширины глифа
+	advance, ok := f.face.GlyphAdvance(char)
 	if !ok {
 		fmt.Printf("Warning: Glyph not found for character %c (code %d)\n", char, char)
 		return 0
 	}
 
-	// Вычисление размеров изображения для глифа
-	width := int(advance.Round())
-	height := bounds.Max.Y.Round() - bounds.Min.Y.Round()
-
-	if width <= 0 || height <= 0 {
-		fmt.Printf("Warning: Invalid dimensions for character %c: %dx%d\n", char, width, height)
-		return 0
-	}
-
-	// Создание изображения для глифа
+	// Глиф рисуется в изображение размером с ячейку (широкий символ - шире)
+	// на общей базовой линии, чтобы символы строки стояли ровно
+	width, height := max(advance.Round(), f.cell[0]), f.cell[1]
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	d := &font.Drawer{
 		Dst:  img,
 		Src:  image.White,
 		Face: f.face,
-		Dot:  fixed.Point26_6{X: -bounds.Min.X, Y: -bounds.Min.Y},
+		Dot:  fixed.P(0, f.ascent),
 	}
 	d.DrawString(string(char))
 
@@ -151,11 +217,17 @@ func (f *Font) WarmupCache(chars string) {
 	}
 }
 
+// CellSize возвращает размер ячейки сетки для этого шрифта в пикселях.
+func (f *Font) CellSize() (width, height int) {
+	return f.cell[0], f.cell[1]
+}
+
 // Destroy освобождает ресурсы, связанные с шрифтом
 func (f *Font) Destroy() {
 	for _, texture := range f.textures {
 		gl.DeleteTextures(1, &texture)
 	}
+	clear(f.textures)
 }
 
 func getFontDirs() []string {
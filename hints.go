@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// hintAlphabet - буквы для меток подсказок, начиная с самых удобных.
+const hintAlphabet = "asdfjklgheruiowmcvntyqpxbz"
+
+// HintAction определяет, что делать с выбранной подсказкой.
+type HintAction int
+
+const (
+	HintOpen  HintAction = iota // Открыть командой открытия ссылок
+	HintCopy                    // Скопировать в буфер обмена
+	HintPaste                   // Вставить в терминал
+)
+
+// HintPattern - именованное регулярное выражение для поиска подсказок.
+type HintPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// defaultHintPatterns перечисляет, что ищется в режиме подсказок, если
+// настройки не меняют шаблоны. Порядок важен: совпадение, пересекающееся с
+// найденным ранее, отбрасывается.
+var defaultHintPatterns = []HintPattern{
+	{"url", regexp.MustCompile(`(?:https?|ftp|file|git|ssh)://[^\s<>"'` + "`" + `]+[^\s<>"'` + "`" + `.,;:!?)\]}]`)},
+	{"path", regexp.MustCompile(`(?:~|\.{1,2})?(?:/[\w.\-+@]+)+(?::\d+(?::\d+)?)?|[\w.\-+@]+(?:/[\w.\-+@]+)*\.\w+:\d+(?::\d+)?`)},
+	{"hash", regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)},
+}
+
+// setHintPattern заменяет шаблон с именем name в patterns или добавляет
+// его в конец. Пустое выражение убирает шаблон. Выражение не должно
+// совпадать с пустой строкой: у такой подсказки не было бы ячеек.
+func setHintPattern(patterns []HintPattern, name, expr string) ([]HintPattern, error) {
+	i := slices.IndexFunc(patterns, func(p HintPattern) bool { return p.Name == name })
+	if expr == "" {
+		if i >= 0 {
+			patterns = slices.Delete(patterns, i, i+1)
+		}
+		return patterns, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hint pattern: %v", err)
+	}
+	if re.MatchString("") {
+		return nil, fmt.Errorf("hint pattern %q matches an empty string", expr)
+	}
+	if i >= 0 {
+		patterns[i].Regexp = re
+	} else {
+		patterns = append(patterns, HintPattern{Name: name, Regexp: re})
+	}
+	return patterns, nil
+}
+
+// hintLineSuffix - номер строки и столбца после пути к файлу.
+var hintLineSuffix = regexp.MustCompile(`(?::\d+)+$`)
+
+// Hint - найденная на экране подсказка.
+type Hint struct {
+	Label   string // Метка, которую нужно набрать
+	Pattern string // Имя шаблона, которым найдена подсказка
+	Text    string
+	Start   [2]int // Первая ячейка (строка, столбец)
+	End     [2]int // Последняя ячейка (строка, столбец)
+}
+
+// Contains сообщает, покрывает ли подсказка ячейку видимой области.
+func (h *Hint) Contains(row, col int) bool {
+	if row < h.Start[0] || row > h.End[0] {
+		return false
+	}
+	if row == h.Start[0] && col < h.Start[1] {
+		return false
+	}
+	return row != h.End[0] || col <= h.End[1]
+}
+
+// HintMode - режим выбора подсказки с клавиатуры.
+type HintMode struct {
+	Active bool
+	Action HintAction
+	Hints  []Hint
+	typed  string // Уже набранная часть метки
+}
+
+// hintCell связывает байт текста логической строки с ячейкой экрана.
+type hintCell struct {
+	offset   int
+	row, col int
+}
+
+// findHints ищет подсказки на видимом экране. Мягко перенесенные строки
+// склеиваются, поэтому подсказка может занимать несколько строк экрана.
+func findHints(lines []Line, patterns []HintPattern) []Hint {
+	var hints []Hint
+	for row := 0; row < len(lines); {
+		var text strings.Builder
+		var cells []hintCell
+		for {
+			line := lines[row]
+			for col, c := range line.Cells {
+				if c.Attr&AttrWideSpacer != 0 {
+					continue
+				}
+				cells = append(cells, hintCell{offset: text.Len(), row: row, col: col})
+				if c.Char == 0 {
+					text.WriteByte(' ')
+				} else {
+					text.WriteRune(c.Char)
+				}
+			}
+			row++
+			if !line.Wrapped || row >= len(lines) {
+				break
+			}
+		}
+
+		hints = appendHints(hints, text.String(), cells, patterns)
+	}
+
+	for i, label := range hintLabels(len(hints)) {
+		hints[i].Label = label
+	}
+	return hints
+}
+
+// appendHints добавляет совпадения шаблонов в одной логической строке.
+func appendHints(hints []Hint, text string, cells []hintCell, patterns []HintPattern) []Hint {
+	cellAt := func(offset int) hintCell {
+		i := sort.Search(len(cells), func(i int) bool { return cells[i].offset > offset })
+		return cells[i-1]
+	}
+
+	var taken [][2]int
+	first := len(hints)
+	for _, p := range patterns {
+	matches:
+		for _, m := range p.Regexp.FindAllStringIndex(text, -1) {
+			for _, t := range taken {
+				if m[0] < t[1] && t[0] < m[1] {
+					continue matches
+				}
+			}
+			taken = append(taken, [2]int{m[0], m[1]})
+			start, end := cellAt(m[0]), cellAt(m[1]-1)
+			hints = append(hints, Hint{
+				Pattern: p.Name,
+				Text:    text[m[0]:m[1]],
+				Start:   [2]int{start.row, start.col},
+				End:     [2]int{end.row, end.col},
+			})
+		}
+	}
+
+	// Подсказки нумеруются в порядке появления на экране
+	added := hints[first:]
+	sort.Slice(added, func(i, j int) bool {
+		a, b := added[i].Start, added[j].Start
+		return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+	})
+	return hints
+}
+
+// hintLabels создает n меток одинаковой длины, чтобы ни одна не была
+// началом другой.
+func hintLabels(n int) []string {
+	length := 1
+	for total := len(hintAlphabet); total < n; total *= len(hintAlphabet) {
+		length++
+	}
+	labels := make([]string, n)
+	for i := range labels {
+		label := make([]byte, length)
+		for j, v := length-1, i; j >= 0; j-- {
+			label[j] = hintAlphabet[v%len(hintAlphabet)]
+			v /= len(hintAlphabet)
+		}
+		labels[i] = string(label)
+	}
+	return labels
+}
+
+// Start включает режим подсказок для видимого экрана с шаблонами patterns.
+func (m *HintMode) Start(lines []Line, action HintAction, patterns []HintPattern) {
+	*m = HintMode{Action: action, Hints: findHints(lines, patterns)}
+	m.Active = len(m.Hints) > 0
+}
+
+// Cancel выключает режим подсказок.
+func (m *HintMode) Cancel() {
+	*m = HintMode{}
+}
+
+// Type обрабатывает набранный символ. Когда метка набрана целиком, режим
+// выключается и возвращается выбранная подсказка.
+func (m *HintMode) Type(char rune) (Hint, bool) {
+	m.typed += strings.ToLower(string(char))
+	matched := false
+	for _, h := range m.Hints {
+		if h.Label == m.typed {
+			m.Cancel()
+			return h, true
+		}
+		if strings.HasPrefix(h.Label, m.typed) {
+			matched = true
+		}
+	}
+	if !matched {
+		m.Cancel() // Такой метки нет
+	}
+	return Hint{}, false
+}
+
+// Visible сообщает, показывается ли подсказка с учетом набранной части метки.
+func (m *HintMode) Visible(h *Hint) bool {
+	return strings.HasPrefix(h.Label, m.typed)
+}
+
+// expandPath раскрывает ~ в начале пути и дополняет относительный путь
+// рабочим каталогом программы cwd: программа открытия запускается в
+// каталоге bareterm, а не программы.
+func expandPath(path, cwd string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) && cwd != "" {
+		return filepath.Join(cwd, path)
+	}
+	return path
+}
+
+// applyHint выполняет действие режима подсказок с выбранной подсказкой.
+// Ссылки и пути открываются командой opener. Вызывается из главного потока.
+func (s *Session) applyHint(h Hint, action HintAction, opener []string) {
+	switch action {
+	case HintCopy:
+		glfw.SetClipboardString(h.Text)
+	case HintPaste:
+		s.Paste(h.Text)
+	case HintOpen:
+		var err error
+		switch h.Pattern {
+		case "url":
+			err = openURI(opener, h.Text)
+		case "path":
+			// Номер строки и столбца после пути программе открытия не нужен
+			path := hintLineSuffix.ReplaceAllString(h.Text, "")
+			err = runOpener(opener, expandPath(path, s.Cwd()))
+		default:
+			glfw.SetClipboardString(h.Text)
+		}
+		if err != nil {
+			log.Println("failed to open hint:", err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetHintPattern(t *testing.T) {
+	patterns := slices.Clone(defaultHintPatterns)
+	var err error
+	if patterns, err = setHintPattern(patterns, "ticket", `[A-Z]+-\d+`); err != nil {
+		t.Fatal(err)
+	}
+	if patterns, err = setHintPattern(patterns, "path", ""); err != nil {
+		t.Fatal(err)
+	}
+	if patterns, err = setHintPattern(patterns, "url", `https?://\S+`); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range patterns {
+		names = append(names, p.Name)
+	}
+	if want := []string{"url", "hash", "ticket"}; !slices.Equal(names, want) {
+		t.Errorf("patterns = %v, want %v", names, want)
+	}
+	if defaultHintPatterns[0].Regexp.String() == `https?://\S+` {
+		t.Error("default patterns were changed")
+	}
+
+	for _, expr := range []string{"(", "a*", "x|"} {
+		if _, err := setHintPattern(patterns, "bad", expr); err == nil {
+			t.Errorf("pattern %q was accepted", expr)
+		}
+	}
+}
+
+func TestFindHintsWithPatterns(t *testing.T) {
+	term := NewTerminal(2, 40)
+	term.Write([]byte("see BUG-12 and ./main.go:40"))
+	patterns, err := setHintPattern(slices.Clone(defaultHintPatterns), "ticket", `[A-Z]+-\d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := findHints(term.lines, patterns)
+	if len(hints) != 2 {
+		t.Fatalf("hints = %+v, want two", hints)
+	}
+	if h := hints[0]; h.Pattern != "ticket" || h.Text != "BUG-12" || h.Start != [2]int{0, 4} || h.End != [2]int{0, 9} {
+		t.Errorf("first hint = %+v", h)
+	}
+	if h := hints[1]; h.Pattern != "path" || h.Text != "./main.go:40" {
+		t.Errorf("second hint = %+v", h)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	for _, tt := range []struct {
+		path, cwd, want string
+	}{
+		{"~", "/src", "/home/user"},
+		{"~/notes.txt", "/src", "/home/user/notes.txt"},
+		{"./x.go", "/src/app", "/src/app/x.go"},
+		{"../lib/y.go", "/src/app", "/src/lib/y.go"},
+		{"pkg/z.go", "/src", "/src/pkg/z.go"},
+		{"/etc/hosts", "/src", "/etc/hosts"},
+		{"./x.go", "", "./x.go"},
+	} {
+		if got := expandPath(tt.path, tt.cwd); got != tt.want {
+			t.Errorf("expandPath(%q, %q) = %q, want %q", tt.path, tt.cwd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "github.com/go-gl/glfw/v3.3/glfw"
+
+// keySequence возвращает байты, которые нужно отправить дочернему процессу
+// при нажатии специальной клавиши. Печатаемые символы приходят через
+// CharCallback и здесь не обрабатываются.
+func keySequence(key glfw.Key, mods glfw.ModifierKey, appCursor bool) []byte {
+	// Ctrl+буква отправляет соответствующий управляющий символ
+	if mods&glfw.ModControl != 0 && key >= glfw.KeyA && key <= glfw.KeyZ {
+		return []byte{byte(key-glfw.KeyA) + 1}
+	}
+
+	switch key {
+	case glfw.KeyEnter, glfw.KeyKPEnter:
+		return []byte{'\r'}
+	case glfw.KeyBackspace:
+		return []byte{0x7F}
+	case glfw.KeyEscape:
+		return []byte{0x1B}
+	case glfw.KeyTab:
+		if mods&glfw.ModShift != 0 {
+			return []byte("\x1b[Z")
+		}
+		return []byte{'\t'}
+	case glfw.KeyUp:
+		return cursorKey('A', appCursor)
+	case glfw.KeyDown:
+		return cursorKey('B', appCursor)
+	case glfw.KeyRight:
+		return cursorKey('C', appCursor)
+	case glfw.KeyLeft:
+		return cursorKey('D', appCursor)
+	case glfw.KeyHome:
+		return cursorKey('H', appCursor)
+	case glfw.KeyEnd:
+		return cursorKey('F', appCursor)
+	case glfw.KeyInsert:
+		return []byte("\x1b[2~")
+	case glfw.KeyDelete:
+		return []byte("\x1b[3~")
+	case glfw.KeyPageUp:
+		return []byte("\x1b[5~")
+	case glfw.KeyPageDown:
+		return []byte("\x1b[6~")
+	}
+	return nil
+}
+
+// cursorKey формирует последовательность клавиши курсора с учетом режима
+// DECCKM (режим 1): ESC O x в режиме приложения, иначе CSI x.
+func cursorKey(final byte, appCursor bool) []byte {
+	if appCursor {
+		return []byte{0x1B, 'O', final}
+	}
+	return []byte{0x1B, '[', final}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// maxHyperlinks ограничивает таблицу ссылок OSC 8. Заполненная таблица
+// сжимается до ссылок, оставшихся на экране и в истории; если места все
+// равно нет, новые ссылки перестают отмечаться, а текст выводится как обычно.
+const maxHyperlinks = 1 << 16
+
+// Hyperlink - ссылка OSC 8, на которую ссылаются ячейки по номеру.
+type Hyperlink struct {
+	ID  string // Параметр id=, объединяющий разорванные части одной ссылки
+	URI string
+}
+
+// hyperlinkOSC обрабатывает OSC 8 ; params ; URI. Пустой URI завершает ссылку.
+func (t *Terminal) hyperlinkOSC(arg string) {
+	params, uri, ok := strings.Cut(arg, ";")
+	if !ok || uri == "" {
+		t.pen.Link = 0
+		return
+	}
+
+	var id string
+	for _, p := range strings.Split(params, ":") {
+		if v, ok := strings.CutPrefix(p, "id="); ok {
+			id = v
+		}
+	}
+
+	// Ссылки с одинаковыми id и URI получают один номер, чтобы подсвечиваться
+	// вместе. Ссылки без id (например, из ls --hyperlink) объединяются по URI,
+	// иначе каждая заняла бы место в таблице
+	key := id + "\x00" + uri
+	if n, ok := t.linkIDs[key]; ok {
+		t.pen.Link = n
+		return
+	}
+	if len(t.links) >= maxHyperlinks {
+		t.compactLinks()
+	}
+	if len(t.links) >= maxHyperlinks {
+		t.pen.Link = 0
+		return
+	}
+	t.links = append(t.links, Hyperlink{ID: id, URI: uri})
+	t.pen.Link = uint32(len(t.links)) // Номер 0 означает отсутствие ссылки
+	t.linkIDs[key] = t.pen.Link
+}
+
+// compactLinks удаляет из таблицы ссылки, на которые не ссылается ни одна
+// ячейка экранов и истории, и перенумеровывает остальные.
+func (t *Terminal) compactLinks() {
+	renumber := make(map[uint32]uint32)
+	var links []Hyperlink
+	relink := func(n *uint32) {
+		if *n == 0 {
+			return
+		}
+		m, ok := renumber[*n]
+		if !ok {
+			links = append(links, t.links[*n-1])
+			m = uint32(len(links))
+			renumber[*n] = m
+		}
+		*n = m
+	}
+	for _, lines := range [][]Line{t.history, t.primary, t.lines} {
+		for i := range lines {
+			for j := range lines[i].Cells {
+				relink(&lines[i].Cells[j].Link)
+			}
+		}
+	}
+	relink(&t.pen.Link)
+	relink(&t.saved.pen.Link)
+
+	t.links = links
+	clear(t.linkIDs)
+	for i, link := range links {
+		t.linkIDs[link.ID+"\x00"+link.URI] = uint32(i + 1)
+	}
+	t.dirty = true
+}
+
+// Hyperlink возвращает ссылку по номеру из ячейки.
+func (t *Terminal) Hyperlink(n uint32) (Hyperlink, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n == 0 || int(n) > len(t.links) {
+		return Hyperlink{}, false
+	}
+	return t.links[n-1], true
+}
+
+// openURI открывает ссылку командой opener из настроек.
+func openURI(opener []string, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid uri %q: %v", uri, err)
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("uri %q has no scheme", uri)
+	}
+	if u.Scheme == "file" {
+		if err := checkFileHost(u.Host); err != nil {
+			return err
+		}
+	}
+
+	return runOpener(opener, uri)
+}
+
+// runOpener запускает команду opener с аргументом arg и не ждет ее
+// завершения.
+func runOpener(opener []string, arg string) error {
+	cmd := exec.Command(opener[0], append(opener[1:], arg)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %v", opener[0], err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// checkFileHost проверяет, что ссылка file:// указывает на эту машину: файл
+// с другого хоста (например, из ssh-сессии) локально открыть нельзя.
+func checkFileHost(host string) error {
+	if host == "" || host == "localhost" || strings.EqualFold(host, localHostname()) {
+		return nil
+	}
+	return fmt.Errorf("file uri refers to remote host %q", host)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHyperlinksWithoutID(t *testing.T) {
+	term := NewTerminal(4, 20)
+	for i := 0; i < 3; i++ {
+		term.Write([]byte("\x1b]8;;file:///tmp/a\x1b\\a\x1b]8;;\x1b\\ "))
+	}
+	term.Write([]byte("\x1b]8;;file:///tmp/b\x1b\\b\x1b]8;;\x1b\\"))
+	if len(term.links) != 2 {
+		t.Errorf("links = %+v, want one per URI", term.links)
+	}
+	cells := term.lines[0].Cells
+	if cells[0].Link == 0 || cells[0].Link != cells[2].Link || cells[0].Link == cells[6].Link {
+		t.Errorf("link numbers %d %d %d", cells[0].Link, cells[2].Link, cells[6].Link)
+	}
+}
+
+func TestHyperlinkTableCompaction(t *testing.T) {
+	term := NewTerminal(4, 20)
+	term.SetMaxHistory(2)
+	var b strings.Builder
+	for i := 0; i < maxHyperlinks+10; i++ {
+		fmt.Fprintf(&b, "\x1b]8;;https://example.com/%d\x1b\\x\x1b]8;;\x1b\\\r\n", i)
+	}
+	term.Write([]byte(b.String()))
+
+	// Старые ссылки ушли из истории, поэтому новые по-прежнему отмечаются
+	last := fmt.Sprintf("https://example.com/%d", maxHyperlinks+9)
+	link, ok := term.Hyperlink(term.lines[2].Cells[0].Link)
+	if !ok || link.URI != last {
+		t.Errorf("last line links to %+v, want %s", link, last)
+	}
+	if len(term.links) > 16 {
+		t.Errorf("table keeps %d links after compaction", len(term.links))
+	}
+
+	term.Write([]byte("\x1bc"))
+	if len(term.links) != 2 {
+		t.Errorf("links after RIS = %+v, want the ones left in history", term.links)
+	}
+}
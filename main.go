@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 	"runtime"
 
-	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 )
 
@@ -15,6 +18,61 @@ func init() {
 }
 
 func main() {
+	// bareterm msg - клиент удаленного управления, без окна и настроек
+	if len(os.Args) > 1 && os.Args[1] == "msg" {
+		os.Exit(runMsg(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	opts, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bareterm:", err)
+		os.Exit(2)
+	}
+	if opts.Version {
+		fmt.Println("bareterm", version)
+		return
+	}
+
+	// Настройки из ~/.config/bareterm/bareterm.toml (или --config) с
+	// изменениями из -o. Ошибка в файле не мешает запуску: используются
+	// настройки по умолчанию.
+	overrides, err := parseOverrides(opts.Overrides)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	cfgPath := configPath()
+	if opts.Config != "" {
+		cfgPath = opts.Config
+		if _, err := os.Stat(cfgPath); err != nil {
+			log.Fatalln("failed to read config:", err)
+		}
+	}
+	cfg, err := LoadConfig(cfgPath, overrides)
+	if opts.PrintConfig {
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := cfg.WriteTOML(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if err != nil {
+		log.Println("failed to load config:", err)
+		cfg = defaultConfig()
+	}
+
+	// Сервер сессий работает без окна, пока не завершится последняя сессия
+	if opts.Server {
+		if err := runServer(cfg); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	// Инициализация GLFW. Это необходимо сделать перед использованием любых функций GLFW.
 	if err := glfw.Init(); err != nil {
 		log.Fatalln("failed to initialize glfw:", err)
@@ -22,49 +80,94 @@ func main() {
 	// Отложенный вызов Terminate() гарантирует, что GLFW будет корректно завершен при выходе из программы.
 	defer glfw.Terminate()
 
-	// Создание окна с явным указанием названия
-	window, err := glfw.CreateWindow(800, 600, "Bareterm Terminal Emulator", nil, nil)
-	if err != nil {
-		log.Fatalln("failed to create window:", err)
-	}
+	// Класс окна (WM_CLASS) позволяет оконному менеджеру отличать окна bareterm
+	glfw.WindowHintString(glfw.X11ClassName, opts.Class)
+	glfw.WindowHintString(glfw.X11InstanceName, opts.Class)
 
-	// Создание нового экземпляра TermGrid с заданными размерами окна и сетки.
-	grid, err := NewTermGrid(800, 600, 20, 40)
+	// Первое окно с программой из -e или оболочкой. Новые окна открываются
+	// по new_window в том же процессе. Чтение и разбор вывода каждой панели
+	// идут в отдельной горутине, которая будит главный поток через
+	// PostEmptyEvent.
+	windows := NewWindows(cfg, opts)
+	// Сокет удаленного управления; программы в окнах находят его через
+	// переменную окружения
+	if control, err := NewControl(windows); err != nil {
+		log.Println("failed to start remote control:", err)
+	} else {
+		windows.control = control
+		os.Setenv(controlSocketEnv, control.Path())
+		defer control.Close()
+	}
+	command := cfg.Shell
+	if len(opts.Command) > 0 {
+		command = opts.Command
+	}
+	// С --attach без -e окно подключается ко всем сессиям сервера, а если
+	// их нет - запускает оболочку в новой сессии
+	var sessions []int
+	if opts.Attach && len(opts.Command) == 0 {
+		conn, err := dialServer()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		infos, err := listRemoteSessions(conn)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, info := range infos {
+			sessions = append(sessions, info.ID)
+		}
+	}
+	if len(sessions) > 0 {
+		err = windows.attach(sessions)
+	} else {
+		err = windows.open(command)
+	}
 	if err != nil {
-		log.Fatalln("failed to create TermGrid:", err)
+		log.Fatalln("failed to open window:", err)
 	}
-	defer grid.Destroy()
+	defer windows.Close()
 
-	grid.SetText("Hello, TermGrid!")
+	// Изменения файла настроек применяются на лету, без перезапуска оболочки.
+	reload := make(chan struct{}, 1)
+	if watcher, err := WatchFile(cfgPath, func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+		glfw.PostEmptyEvent()
+	}); err != nil {
+		log.Println("failed to watch config:", err)
+	} else {
+		defer watcher.Close()
+	}
 
-	window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
-		if action == glfw.Press || action == glfw.Repeat {
-			if key == glfw.KeyEscape {
-				// Закрытие окна при нажатии Escape.
-				w.SetShouldClose(true)
-			} else if key >= glfw.KeySpace && key <= glfw.KeyGraveAccent {
-				// Добавление символа в сетку при нажатии печатаемых клавиш.
-				grid.AppendChar(rune(key))
-			} else if key == glfw.KeyEnter {
-				// Переход на новую строку при нажатии Enter.
-				grid.NewLine()
-			} else if key == glfw.KeyBackspace {
-				// Удаление последнего символа при нажатии Backspace.
-				grid.Backspace()
+	// Основной цикл приложения с явным рендерингом; процесс завершается
+	// вместе с последним окном
+	for {
+		// Перечитываем настройки после изменения файла; при ошибке остаются прежние
+		select {
+		case <-reload:
+			if c, err := LoadConfig(cfgPath, overrides); err != nil {
+				log.Println("failed to reload config:", err)
+			} else {
+				windows.ApplyConfig(c)
 			}
+		default:
 		}
-	})
-
-	// Основной цикл приложения с явным рендерингом
-	for !window.ShouldClose() {
-		// Очистка экрана
-		gl.Clear(gl.COLOR_BUFFER_BIT)
 
-		// Рендеринг TermGrid
-		grid.Render()
+		// Новые окна, завершение программ, отметки вкладок, буфер обмена,
+		// заголовки и отрисовка всех окон
+		if !windows.Update() {
+			break
+		}
 
-		// Обмен буферов и обработка событий
-		window.SwapBuffers()
-		glfw.PollEvents()
+		// Ожидание событий ввода или нового вывода оболочки, а для мигающего
+		// курсора - не дольше следующего переключения
+		if d := windows.NextBlink(); d > 0 {
+			glfw.WaitEventsTimeout(d.Seconds())
+		} else {
+			glfw.WaitEvents()
+		}
 	}
 }
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Режимы отслеживания мыши xterm (DECSET).
+const (
+	mouseX10        = 9    // Только нажатия кнопок
+	mouseNormal     = 1000 // Нажатия и отпускания
+	mouseButtonMove = 1002 // Плюс перемещение с нажатой кнопкой
+	mouseAnyMove    = 1003 // Плюс любое перемещение
+)
+
+// Кодировки отчетов о мыши (DECSET).
+const (
+	mouseEncUTF8      = 1005 // Координаты в UTF-8
+	mouseEncSGR       = 1006 // CSI < b ; x ; y M/m
+	mouseEncURXVT     = 1015 // CSI b ; x ; y M
+	mouseEncSGRPixels = 1016 // Как SGR, но координаты в пикселях
+)
+
+// Коды кнопок в отчетах xterm.
+const (
+	mouseLeft       = 0
+	mouseMiddle     = 1
+	mouseRight      = 2
+	mouseRelease    = 3  // Отпускание в устаревших кодировках
+	mouseMotion     = 32 // Флаг перемещения
+	mouseWheelUp    = 64
+	mouseWheelDown  = 65
+	mouseWheelLeft  = 66
+	mouseWheelRight = 67
+)
+
+// doubleClickTime - максимальный интервал между щелчками двойного и тройного щелчка.
+const doubleClickTime = 400 * time.Millisecond
+
+var mouseTrackingModes = []int{mouseAnyMove, mouseButtonMove, mouseNormal, mouseX10}
+var mouseEncodingModes = []int{mouseEncSGRPixels, mouseEncSGR, mouseEncURXVT, mouseEncUTF8}
+
+// MouseTracking возвращает активный режим отслеживания мыши (0, если
+// приложение не запрашивало отчеты) и кодировку отчетов (0 - кодировка X10).
+func (t *Terminal) MouseTracking() (mode, encoding int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range mouseTrackingModes {
+		if t.modes[m] {
+			mode = m
+			break
+		}
+	}
+	for _, e := range mouseEncodingModes {
+		if t.modes[e] {
+			encoding = e
+			break
+		}
+	}
+	return mode, encoding
+}
+
+// Mouse преобразует события мыши GLFW в отчеты xterm для дочернего процесса,
+// а если приложение не отслеживает мышь (или зажат Shift) - в выделение текста.
+type Mouse struct {
+	pressed   int       // Удерживаемая кнопка xterm или -1
+	cell      [2]int    // Ячейка последнего отчета о перемещении (строка, столбец)
+	selecting bool      // Левая кнопка зажата и тянет выделение
+	clicks    int       // Номер щелчка в серии: 1, 2 или 3
+	lastClick time.Time // Время последнего щелчка
+	clickCell [2]int    // Ячейка последнего щелчка
+	swallow   int       // Кнопка, отпускание которой не нужно сообщать, или -1
+	opener    []string  // Команда открытия ссылок из настроек
+}
+
+// NewMouse создает обработчик мыши без нажатых кнопок.
+func NewMouse() *Mouse {
+	return &Mouse{pressed: -1, cell: [2]int{-1, -1}, swallow: -1}
+}
+
+// Button формирует отчет о нажатии или отпускании кнопки. Возвращает nil,
+// если событие не нужно передавать приложению: отчеты выключены или зажат
+// Shift, который оставляет мышь для локального выделения текста.
+func (m *Mouse) Button(term *Terminal, grid *TermGrid, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey, x, y float64) []byte {
+	code := -1
+	switch button {
+	case glfw.MouseButtonLeft:
+		code = mouseLeft
+	case glfw.MouseButtonMiddle:
+		code = mouseMiddle
+	case glfw.MouseButtonRight:
+		code = mouseRight
+	}
+	if code < 0 {
+		return nil
+	}
+
+	press := action == glfw.Press
+	if !press && code == m.swallow {
+		m.swallow = -1
+		return nil
+	}
+
+	// Ctrl+щелчок по ссылке OSC 8 открывает ее
+	if code == mouseLeft && press && mods&glfw.ModControl != 0 {
+		row, col := grid.CellAt(x, y)
+		if link, ok := term.Hyperlink(grid.LinkAt(row, col)); ok {
+			if err := openURI(m.opener, link.URI); err != nil {
+				log.Println("failed to open link:", err)
+			}
+			m.swallow = code
+			return nil
+		}
+	}
+
+	if press {
+		m.pressed = code
+	} else if m.pressed == code {
+		m.pressed = -1
+	}
+
+	if code == mouseLeft && !press && m.selecting {
+		// Выделение завершается, даже если Shift уже отпущен
+		m.finishSelection(term)
+		return nil
+	}
+
+	mode, encoding := term.MouseTracking()
+	if mode == 0 || mods&glfw.ModShift != 0 {
+		switch {
+		case code == mouseLeft:
+			m.selectButton(term, grid, press, mods, x, y)
+		case code == mouseMiddle && press:
+			// Средняя кнопка вставляет первичное выделение
+			term.ScrollToBottom()
+			return pasteData(getPrimarySelection(), term.Mode(2004))
+		}
+		return nil
+	}
+	if mode == mouseX10 {
+		if !press {
+			return nil
+		}
+		// В режиме X10 модификаторы не сообщаются
+		mods = 0
+	}
+
+	row, col := grid.CellAt(x, y)
+	m.cell = [2]int{row, col}
+	px, py := grid.PixelAt(x, y)
+	return encodeMouse(encoding, code|mouseModBits(mods), !press, row, col, px, py)
+}
+
+// Move формирует отчет о перемещении мыши для режимов 1002 и 1003.
+func (m *Mouse) Move(term *Terminal, grid *TermGrid, mods glfw.ModifierKey, x, y float64) []byte {
+	grid.SetHoverLink(grid.LinkAt(grid.CellAt(x, y)))
+
+	if m.selecting {
+		m.dragSelection(term, grid, x, y)
+		return nil
+	}
+
+	mode, encoding := term.MouseTracking()
+	if mods&glfw.ModShift != 0 {
+		return nil
+	}
+	if mode != mouseAnyMove && (mode != mouseButtonMove || m.pressed < 0) {
+		return nil
+	}
+
+	row, col := grid.CellAt(x, y)
+	if encoding != mouseEncSGRPixels && m.cell == [2]int{row, col} {
+		return nil // Перемещение внутри одной ячейки не сообщается
+	}
+	m.cell = [2]int{row, col}
+
+	code := m.pressed
+	if code < 0 {
+		code = mouseRelease
+	}
+	px, py := grid.PixelAt(x, y)
+	return encodeMouse(encoding, code|mouseMotion|mouseModBits(mods), false, row, col, px, py)
+}
+
+// Scroll формирует отчеты о прокрутке колесом мыши (кнопки 64-67).
+func (m *Mouse) Scroll(term *Terminal, grid *TermGrid, mods glfw.ModifierKey, x, y, xoff, yoff float64) []byte {
+	mode, encoding := term.MouseTracking()
+	if mode == 0 || mods&glfw.ModShift != 0 {
+		// Колесо прокручивает историю, по три строки на шаг
+		term.ScrollView(int(math.Round(yoff * 3)))
+		return nil
+	}
+	if mode == mouseX10 {
+		return nil
+	}
+
+	code := -1
+	switch {
+	case yoff > 0:
+		code = mouseWheelUp
+	case yoff < 0:
+		code = mouseWheelDown
+	case xoff < 0:
+		code = mouseWheelLeft
+	case xoff > 0:
+		code = mouseWheelRight
+	}
+	if code < 0 {
+		return nil
+	}
+
+	row, col := grid.CellAt(x, y)
+	px, py := grid.PixelAt(x, y)
+	return encodeMouse(encoding, code|mouseModBits(mods), false, row, col, px, py)
+}
+
+// selectButton начинает или завершает выделение левой кнопкой. Двойной
+// щелчок выделяет слово, тройной - строку, Alt - прямоугольник, а Shift
+// расширяет существующее выделение.
+func (m *Mouse) selectButton(term *Terminal, grid *TermGrid, press bool, mods glfw.ModifierKey, x, y float64) {
+	if !press {
+		m.finishSelection(term)
+		return
+	}
+
+	row, col := grid.CellAt(x, y)
+	now := time.Now()
+	if now.Sub(m.lastClick) < doubleClickTime && m.clickCell == [2]int{row, col} {
+		m.clicks = m.clicks%3 + 1
+	} else {
+		m.clicks = 1
+	}
+	m.lastClick = now
+	m.clickCell = [2]int{row, col}
+	m.selecting = true
+
+	if m.clicks == 1 && mods&glfw.ModShift != 0 && term.ExtendSelection(row, col) {
+		return
+	}
+
+	mode := SelectChar
+	switch {
+	case m.clicks == 2:
+		mode = SelectWord
+	case m.clicks == 3:
+		mode = SelectLine
+	case mods&glfw.ModAlt != 0:
+		mode = SelectBlock
+	}
+	term.StartSelection(row, col, mode)
+}
+
+// finishSelection завершает выделение и копирует его в первичное выделение.
+func (m *Mouse) finishSelection(term *Terminal) {
+	m.selecting = false
+	if text := term.SelectionText(); text != "" {
+		setPrimarySelection(text)
+	}
+}
+
+// dragSelection тянет выделение за мышью. Если мышь ушла за верхний или
+// нижний край панели, область просмотра прокручивается.
+func (m *Mouse) dragSelection(term *Terminal, grid *TermGrid, x, y float64) {
+	if row, _ := grid.areaCellAt(x, y); row < grid.view.Row {
+		term.ScrollView(1)
+	} else if row >= grid.view.Row+grid.view.Rows {
+		term.ScrollView(-1)
+	}
+	row, col := grid.CellAt(x, y)
+	term.UpdateSelection(row, col)
+}
+
+// mouseModBits возвращает биты модификаторов для кода кнопки.
+func mouseModBits(mods glfw.ModifierKey) int {
+	bits := 0
+	if mods&glfw.ModShift != 0 {
+		bits |= 4
+	}
+	if mods&glfw.ModAlt != 0 {
+		bits |= 8
+	}
+	if mods&glfw.ModControl != 0 {
+		bits |= 16
+	}
+	return bits
+}
+
+// encodeMouse кодирует отчет о мыши в выбранной кодировке. row и col
+// отсчитываются от нуля, px и py - координаты курсора в пикселях от левого
+// верхнего угла панели.
+func encodeMouse(encoding, code int, release bool, row, col, px, py int) []byte {
+	switch encoding {
+	case mouseEncSGR, mouseEncSGRPixels:
+		final := 'M'
+		if release {
+			final = 'm'
+		}
+		if encoding == mouseEncSGRPixels {
+			col, row = px, py
+		}
+		return []byte(fmt.Sprintf("\x1b[<%d;%d;%d%c", code, col+1, row+1, final))
+	}
+
+	// В остальных кодировках отпускание обозначается кодом 3 без номера кнопки
+	if release {
+		code = code&^3 | mouseRelease
+	}
+	switch encoding {
+	case mouseEncURXVT:
+		return []byte(fmt.Sprintf("\x1b[%d;%d;%dM", code+32, col+1, row+1))
+	case mouseEncUTF8:
+		if col+1+32 > 2047 || row+1+32 > 2047 {
+			return nil
+		}
+		buf := []byte{0x1B, '[', 'M', byte(code + 32)}
+		buf = utf8.AppendRune(buf, rune(col+1+32))
+		return utf8.AppendRune(buf, rune(row+1+32))
+	}
+
+	// Кодировка X10: координаты больше 223 передать нельзя
+	if col+1+32 > 255 || row+1+32 > 255 {
+		return nil
+	}
+	return []byte{0x1B, '[', 'M', byte(code + 32), byte(col + 1 + 32), byte(row + 1 + 32)}
+}
+
+// currentMods возвращает текущие модификаторы клавиатуры. GLFW не передает
+// их в обработчики перемещения и прокрутки, поэтому они опрашиваются явно.
+func currentMods(w *glfw.Window) glfw.ModifierKey {
+	var mods glfw.ModifierKey
+	if w.GetKey(glfw.KeyLeftShift) == glfw.Press || w.GetKey(glfw.KeyRightShift) == glfw.Press {
+		mods |= glfw.ModShift
+	}
+	if w.GetKey(glfw.KeyLeftControl) == glfw.Press || w.GetKey(glfw.KeyRightControl) == glfw.Press {
+		mods |= glfw.ModControl
+	}
+	if w.GetKey(glfw.KeyLeftAlt) == glfw.Press || w.GetKey(glfw.KeyRightAlt) == glfw.Press {
+		mods |= glfw.ModAlt
+	}
+	return mods
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestPixelAt(t *testing.T) {
+	// Окно с отступом 5, строкой вкладок и панелью справа внизу
+	g := &TermGrid{
+		cellSize: [2]float32{10, 20},
+		padding:  5,
+		tabs:     make([]TabInfo, 2),
+		view:     &View{Rect: Rect{Row: 3, Col: 4, Rows: 10, Cols: 20}},
+	}
+	left, top := 5+4*10, 5+20+3*20
+	for _, tt := range []struct {
+		x, y   float64
+		px, py int
+	}{
+		{float64(left), float64(top), 0, 0},
+		{float64(left) + 15.5, float64(top) + 42.9, 15, 42},
+		{0, 0, 0, 0},
+		{1000, 1000, 199, 199},
+	} {
+		if px, py := g.PixelAt(tt.x, tt.y); px != tt.px || py != tt.py {
+			t.Errorf("PixelAt(%v, %v) = %d, %d, want %d, %d", tt.x, tt.y, px, py, tt.px, tt.py)
+		}
+	}
+}
+
+func TestEncodeMouse(t *testing.T) {
+	for _, tt := range []struct {
+		encoding, code int
+		release        bool
+		want           string
+	}{
+		{mouseEncSGR, mouseLeft, false, "\x1b[<0;4;3M"},
+		{mouseEncSGR, mouseLeft, true, "\x1b[<0;4;3m"},
+		{mouseEncSGRPixels, mouseLeft, false, "\x1b[<0;36;26M"},
+		{mouseEncURXVT, mouseLeft, true, "\x1b[35;4;3M"},
+		{0, mouseLeft, false, "\x1b[M\x20\x24\x23"},
+	} {
+		got := string(encodeMouse(tt.encoding, tt.code, tt.release, 2, 3, 35, 25))
+		if got != tt.want {
+			t.Errorf("encoding %d: %q, want %q", tt.encoding, got, tt.want)
+		}
+	}
+}
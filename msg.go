@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runMsg выполняет bareterm msg: отправляет одну команду удаленного
+// управления и печатает ответ. Возвращает код завершения процесса.
+func runMsg(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bareterm msg", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, `usage: bareterm msg [options] command [args...]
+
+commands:
+  list                      list windows, tabs and panes
+  send-text text            send text to the pane as if typed
+  get-text [--scrollback]   print the screen text of the pane
+  set-title [title]         override the pane title (empty restores it)
+  set-font-size N|+N|-N     set or change the font size of the window
+  set-theme name            switch the window theme
+  new-tab [--cwd dir] [command...]
+                            open a tab and print its pane id; the tab starts
+                            in dir or in the working directory of the pane
+  subscribe [event...]      print events: title, bell, command_finished
+
+options:`)
+		fs.PrintDefaults()
+	}
+	path := fs.String("to", os.Getenv(controlSocketEnv), "control socket `path` (default $"+controlSocketEnv+")")
+	var req ControlRequest
+	fs.IntVar(&req.Window, "window", 0, "target window `id` (default: focused window)")
+	fs.IntVar(&req.Pane, "pane", 0, "target pane `id` (default: focused pane)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := parseMsg(fs.Arg(0), fs.Args()[1:], &req); err != nil {
+		fmt.Fprintln(stderr, "bareterm msg:", err)
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(stderr, "bareterm msg: no control socket: run inside bareterm or use --to")
+		return 1
+	}
+	if err := sendMsg(*path, req, stdout); err != nil {
+		fmt.Fprintln(stderr, "bareterm msg:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseMsg заполняет req по команде и ее аргументам.
+func parseMsg(cmd string, args []string, req *ControlRequest) error {
+	nargs := func(min, max int) error {
+		if len(args) < min || max >= 0 && len(args) > max {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		return nil
+	}
+	req.Cmd = strings.ReplaceAll(cmd, "-", "_")
+	switch cmd {
+	case "list":
+		return nargs(0, 0)
+	case "send-text":
+		if err := nargs(1, 1); err != nil {
+			return err
+		}
+		req.Text = args[0]
+	case "get-text":
+		if err := nargs(0, 1); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if args[0] != "--scrollback" {
+				return fmt.Errorf("unexpected argument %q", args[0])
+			}
+			req.Scrollback = true
+		}
+	case "set-title":
+		if err := nargs(0, 1); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			req.Title = args[0]
+		}
+	case "set-font-size":
+		if err := nargs(1, 1); err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid font size %q", args[0])
+		}
+		if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+			req.Delta = n
+		} else {
+			req.Size = n
+		}
+	case "set-theme":
+		if err := nargs(1, 1); err != nil {
+			return err
+		}
+		req.Theme = args[0]
+	case "new-tab":
+		if len(args) > 0 && args[0] == "--cwd" {
+			if len(args) < 2 {
+				return fmt.Errorf("--cwd requires a directory")
+			}
+			req.Cwd, args = args[1], args[2:]
+		}
+		req.Command = args
+	case "subscribe":
+		req.Events = args
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+// sendMsg отправляет команду в сокет path и печатает ответ: текст для
+// get_text, номер панели для new_tab, JSON для list и по событию в строке
+// для subscribe.
+func sendMsg(path string, req ControlRequest, out io.Writer) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	// Один декодер читает и ответ, и следующие за ним события subscribe
+	dec := json.NewDecoder(conn)
+	var resp struct {
+		OK    bool            `json:"ok"`
+		Error string          `json:"error"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := dec.Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if !resp.OK {
+		return errors.New(resp.Error)
+	}
+
+	switch req.Cmd {
+	case "get_text":
+		var text string
+		if err := json.Unmarshal(resp.Data, &text); err != nil {
+			return fmt.Errorf("failed to parse response: %v", err)
+		}
+		fmt.Fprintln(out, text)
+	case "list", "new_tab":
+		fmt.Fprintf(out, "%s\n", resp.Data)
+	case "subscribe":
+		for {
+			var event json.RawMessage
+			if err := dec.Decode(&event); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("failed to read event: %v", err)
+			}
+			fmt.Fprintf(out, "%s\n", event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// Сообщения протокола сервера bareterm. Каждое сообщение - тип, длина
+// содержимого (4 байта, big endian) и содержимое. Соединение начинается с
+// msgList, msgNew или msgAttach; после msgNew и msgAttach клиент передает
+// ввод и размер, а сервер - изменения экрана в виде управляющих
+// последовательностей для модели терминала клиента.
+const (
+	msgList     byte = iota + 1 // Клиент: список сессий
+	msgNew                      // Клиент: запустить программу (muxNew)
+	msgAttach                   // Клиент: подключиться к сессии (muxAttach)
+	msgInput                    // Клиент: ввод для программы
+	msgResize                   // Клиент: новый размер терминала (muxSize)
+	msgKill                     // Клиент: завершить программу
+	msgSessions                 // Сервер: список сессий ([]muxSessionInfo)
+	msgHello                    // Сервер: номер сессии, к которой подключен клиент
+	msgScreen                   // Сервер: изменения экрана
+	msgProcess                  // Сервер: имя процесса переднего плана
+	msgExit                     // Сервер: программа завершилась (текст ошибки)
+	msgError                    // Сервер: запрос не выполнен
+	msgCwd                      // Сервер: рабочий каталог процесса переднего плана
+)
+
+// maxMessageSize ограничивает размер одного сообщения.
+const maxMessageSize = 64 << 20
+
+// muxSize - размер терминала клиента.
+type muxSize struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+// muxNew - запрос на запуск программы в новой сессии.
+type muxNew struct {
+	muxSize
+	Command []string `json:"command"`
+	Dir     string   `json:"dir"`
+}
+
+// muxAttach - запрос на подключение к сессии.
+type muxAttach struct {
+	muxSize
+	ID int `json:"id"`
+}
+
+// muxSessionInfo описывает сессию сервера для списка сессий.
+type muxSessionInfo struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Clients int    `json:"clients"`
+}
+
+// socketPath возвращает путь к сокету сервера bareterm.
+func socketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "bareterm-"+strconv.Itoa(os.Getuid()))
+	} else {
+		dir = filepath.Join(dir, "bareterm")
+	}
+	return filepath.Join(dir, "server.sock")
+}
+
+// makeSocketDir создает каталог сокетов, если его нет, и проверяет, что
+// им можно пользоваться.
+func makeSocketDir() error {
+	dir := filepath.Dir(socketPath())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	return checkSocketDir(dir)
+}
+
+// writeMessage отправляет сообщение одной записью.
+func writeMessage(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5, 5+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(payload)))
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+// writeJSON отправляет сообщение с содержимым в JSON.
+func writeJSON(w io.Writer, typ byte, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, typ, payload)
+}
+
+// readMessage читает одно сообщение.
+func readMessage(r *bufio.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxMessageSize {
+		return 0, nil, fmt.Errorf("message of %d bytes is too large", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// muxModes - режимы DEC, которые клиент должен знать для ввода с клавиатуры,
+// вставки и отчетов о мыши.
+var muxModes = []int{
+	1, 2004,
+	mouseX10, mouseNormal, mouseButtonMove, mouseAnyMove,
+	mouseEncUTF8, mouseEncSGR, mouseEncURXVT, mouseEncSGRPixels,
+}
+
+// muxState - состояние терминала сервера, которое передается клиенту.
+type muxState struct {
+	snap     Snapshot
+	scrolled int    // Сколько строк всего ушло в историю
+	pushed   []Line // Строки, ушедшие в историю после предыдущего состояния
+	alt      bool   // Активен альтернативный экран
+	modes    []bool // Режимы из muxModes
+	title    string
+	cwd      string  // Каталог из OSC 7
+	defaults Palette // Цвета по умолчанию терминала сервера
+}
+
+// muxState копирует в dst экран и строки, ушедшие в историю после того, как
+// в нее ушло since строк. Пока включен синхронизированный вывод, состояние
+// не копируется и возвращается false.
+func (t *Terminal) muxState(dst *muxState, since int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.synchronized() {
+		return false
+	}
+	t.snapshot(&dst.snap)
+	dst.scrolled = t.scrolled
+	n := min(t.scrolled-since, len(t.history))
+	dst.pushed = dst.pushed[:0]
+	for _, line := range t.history[len(t.history)-n:] {
+		dst.pushed = append(dst.pushed, Line{Cells: slices.Clone(line.Cells), Wrapped: line.Wrapped, Mark: line.Mark})
+	}
+	dst.alt = t.primary != nil
+	dst.modes = dst.modes[:0]
+	for _, m := range muxModes {
+		dst.modes = append(dst.modes, t.modes[m])
+	}
+	dst.title = t.title
+	dst.cwd = t.cwd
+	dst.defaults = t.defaultPalette
+	return true
+}
+
+// screenEncoder переводит изменения экрана терминала сервера в управляющие
+// последовательности, которые приводят модель терминала клиента в то же
+// состояние. Строки, ушедшие в историю, прокручиваются и у клиента, поэтому
+// у него остается своя история прокрутки. Первый кадр передает всю историю
+// и экран целиком.
+type screenEncoder struct {
+	state   muxState // Состояние, которое уже передано клиенту
+	next    muxState
+	started bool
+	buf     bytes.Buffer
+	pen     Cell // Цвета, атрибуты и ссылка, установленные в потоке
+}
+
+// Frame возвращает изменения экрана t с прошлого кадра или nil, пока
+// программа задерживает вывод синхронизацией. Номера ссылок OSC 8
+// переводятся в URI через t.Hyperlink.
+func (e *screenEncoder) Frame(t *Terminal) []byte {
+	if !t.muxState(&e.next, e.state.scrolled) {
+		return nil
+	}
+	prev, cur := &e.state, &e.next
+	e.buf.Reset()
+	e.pen = Cell{}
+	e.buf.WriteString("\x1b[0m")
+
+	// После изменения размера клиент сам перенес строки в историю, как и
+	// сервер, поэтому экран просто перерисовывается
+	sized := e.started && cur.snap.Rows == prev.snap.Rows && cur.snap.Cols == prev.snap.Cols
+	var base []Line // Строки экрана клиента; nil - экран нужно перерисовать
+	if sized && cur.alt == prev.alt {
+		base = prev.snap.Lines
+	}
+
+	if !cur.alt && prev.alt {
+		e.buf.WriteString("\x1b[?1049l")
+	}
+	if (sized || !e.started) && !(cur.alt && prev.alt) && len(cur.pushed) > 0 {
+		e.pushLines(t, cur.pushed, cur.snap.Rows, cur.snap.Cols)
+		k := cur.scrolled - prev.scrolled
+		if base != nil && len(cur.pushed) == k && k < len(base) {
+			base = append(slices.Clone(base[k:]), make([]Line, k)...)
+			base[0] = Line{} // Первую строку затирает прокрутка
+		} else {
+			base = nil
+		}
+	} else if cur.scrolled != prev.scrolled {
+		base = nil
+	}
+	if cur.alt && !prev.alt {
+		e.buf.WriteString("\x1b[?1049h")
+	}
+
+	// Измененные строки. Строка с мягким переносом дописывается до конца,
+	// а следующая продолжает ее, чтобы перенос был и у клиента.
+	lines := cur.snap.Lines
+	cont := false
+	for i := range lines {
+		if !cont && base != nil && lineEqual(&base[i], &lines[i]) {
+			continue
+		}
+		if !cont {
+			fmt.Fprintf(&e.buf, "\x1b[%dH", i+1)
+			var old *Line
+			if base != nil {
+				old = &base[i]
+			}
+			e.writeMarks(&lines[i], old)
+		}
+		cont = e.writeLine(t, &lines[i], cur.snap.Cols, cont, i < len(lines)-1)
+	}
+
+	e.setPen(t, Cell{})
+	if !e.started || cur.title != prev.title {
+		e.buf.WriteString("\x1b]2;" + cur.title + "\x1b\\")
+	}
+	if cur.cwd != prev.cwd {
+		e.buf.WriteString(osc7(cur.cwd))
+	}
+	e.writePalette(prev, cur)
+	for i, on := range cur.modes {
+		if !e.started || on != prev.modes[i] {
+			fmt.Fprintf(&e.buf, "\x1b[?%d%c", muxModes[i], modeFinal(on))
+		}
+	}
+	snap := &cur.snap
+	if !e.started || snap.CursorStyle != prev.snap.CursorStyle {
+		fmt.Fprintf(&e.buf, "\x1b[%d q", snap.CursorStyle)
+	}
+	fmt.Fprintf(&e.buf, "\x1b[%d;%dH\x1b[?25%c", snap.Cursor[0]+1, snap.Cursor[1]+1, modeFinal(snap.CursorVisible))
+
+	e.state, e.next = e.next, e.state
+	e.started = true
+	return e.buf.Bytes()
+}
+
+// writePalette передает цвета, которые программа изменила через OSC 4 и
+// 10-19. Цвет, вернувшийся к значению по умолчанию сервера, у клиента
+// сбрасывается к цвету его темы; до первого кадра у клиента цвета темы.
+func (e *screenEncoder) writePalette(prev, cur *muxState) {
+	p, old, def := &cur.snap.Palette, &prev.snap.Palette, &cur.defaults
+	if !e.started {
+		old = def
+	}
+	for i, c := range p.Colors {
+		switch {
+		case c == old.Colors[i]:
+		case c == def.Colors[i]:
+			fmt.Fprintf(&e.buf, "\x1b]104;%d\x1b\\", i)
+		default:
+			fmt.Fprintf(&e.buf, "\x1b]4;%d;%s\x1b\\", i, formatColorSpec(c))
+		}
+	}
+	for _, n := range []int{10, 11, 12, 17, 19} {
+		switch c := *p.dynamicColor(n); {
+		case c == *old.dynamicColor(n):
+		case c == *def.dynamicColor(n):
+			fmt.Fprintf(&e.buf, "\x1b]%d\x1b\\", n+100)
+		default:
+			fmt.Fprintf(&e.buf, "\x1b]%d;%s\x1b\\", n, formatColorSpec(c))
+		}
+	}
+}
+
+// pushLines отправляет строки в историю клиента: каждая строка выводится в
+// первой строке экрана, которая затем уходит вверх переводом строки внизу.
+func (e *screenEncoder) pushLines(t *Terminal, lines []Line, rows, cols int) {
+	e.buf.WriteString("\x1b[r")
+	for i := range lines {
+		e.buf.WriteString("\x1b[H")
+		e.writeMarks(&lines[i], nil)
+		if e.writeLine(t, &lines[i], cols, false, true) {
+			// Пробел переносится на вторую строку и отмечает перенос первой
+			e.buf.WriteByte(' ')
+		}
+		e.setPen(t, Cell{})
+		fmt.Fprintf(&e.buf, "\x1b[%dH\n", rows)
+	}
+}
+
+// writeLine выводит ячейки строки с текущей позиции курсора. Если строка
+// заполнена до конца и перенесена на следующую, а canWrap, курсор остается
+// в ожидании переноса и возвращается true; иначе остаток строки стирается.
+// Строка, которая продолжает перенесенную (cont), выводит хотя бы один
+// символ, чтобы перенос состоялся.
+func (e *screenEncoder) writeLine(t *Terminal, line *Line, cols int, cont, canWrap bool) bool {
+	cells := line.Cells[:min(len(line.Cells), cols)]
+	wrap := canWrap && line.Wrapped && len(cells) == cols
+	if !wrap {
+		// Пустой хвост строки заменяется стиранием
+		keep := 0
+		if cont {
+			keep = 1
+		}
+		for len(cells) > keep && cells[len(cells)-1] == (Cell{}) {
+			cells = cells[:len(cells)-1]
+		}
+	}
+	for _, cell := range cells {
+		if cell.Attr&AttrWideSpacer != 0 {
+			continue // Широкий символ уже занял эту ячейку
+		}
+		e.setPen(t, cell)
+		if cell.Char == 0 {
+			e.buf.WriteByte(' ')
+		} else {
+			e.buf.WriteRune(cell.Char)
+		}
+	}
+	if wrap {
+		return true
+	}
+	if len(cells) < cols {
+		// Стирание цветом по умолчанию; в последнем столбце курсор ждет
+		// переноса, и стирание затерло бы последний символ
+		e.setPen(t, Cell{})
+		e.buf.WriteString("\x1b[K")
+	}
+	return false
+}
+
+// writeMarks передает отметки OSC 133 строки, в начале которой стоит
+// курсор. old - эта строка у клиента (nil - неизвестна): если отметки
+// изменились, старые стираются вместе со строкой, которую writeLine все
+// равно выведет заново.
+func (e *screenEncoder) writeMarks(line, old *Line) {
+	if old != nil && old.Mark == line.Mark {
+		return
+	}
+	if old == nil || old.Mark != 0 {
+		e.buf.WriteString("\x1b[2K")
+	}
+	if line.Mark&MarkOutput != 0 {
+		e.buf.WriteString("\x1b]133;C\x1b\\")
+	}
+	if line.Mark&MarkPrompt != 0 {
+		e.buf.WriteString("\x1b]133;A\x1b\\")
+	}
+	switch {
+	case line.Mark&MarkSuccess != 0:
+		e.buf.WriteString("\x1b]133;D;0\x1b\\")
+	case line.Mark&MarkFailure != 0:
+		e.buf.WriteString("\x1b]133;D;1\x1b\\")
+	}
+}
+
+// setPen переключает цвета, атрибуты и ссылку для следующих символов.
+func (e *screenEncoder) setPen(t *Terminal, cell Cell) {
+	if cell.Link != e.pen.Link {
+		uri := ""
+		if link, ok := t.Hyperlink(cell.Link); ok {
+			uri = link.URI
+		}
+		if uri == "" {
+			e.buf.WriteString("\x1b]8;;\x1b\\")
+		} else {
+			// Номер ссылки сервера становится id, чтобы части одной ссылки
+			// у клиента подсвечивались вместе
+			fmt.Fprintf(&e.buf, "\x1b]8;id=%d;%s\x1b\\", cell.Link, uri)
+		}
+	}
+	// Половины широкого символа отмечает сам вывод символа
+	attr := cell.Attr &^ (AttrWide | AttrWideSpacer)
+	if cell.FG != e.pen.FG || cell.BG != e.pen.BG || attr != e.pen.Attr {
+		e.buf.WriteString("\x1b[0")
+		for i, p := range []int{1, 2, 3, 4, 5, 7, 8, 9} {
+			if attr&(1<<i) != 0 {
+				fmt.Fprintf(&e.buf, ";%d", p)
+			}
+		}
+		writeColorSGR(&e.buf, cell.FG, 38)
+		writeColorSGR(&e.buf, cell.BG, 48)
+		e.buf.WriteByte('m')
+	}
+	e.pen = Cell{FG: cell.FG, BG: cell.BG, Attr: attr, Link: cell.Link}
+}
+
+// writeColorSGR дописывает параметры SGR цвета текста (base 38) или фона
+// (base 48).
+func writeColorSGR(buf *bytes.Buffer, c Color, base int) {
+	switch {
+	case c.IsDefault():
+	case c&colorKind == colorIndexed:
+		fmt.Fprintf(buf, ";%d;5;%d", base, uint8(c))
+	default:
+		fmt.Fprintf(buf, ";%d;2;%d;%d;%d", base, uint8(c>>16), uint8(c>>8), uint8(c))
+	}
+}
+
+// modeFinal возвращает последний символ DECSET (h) или DECRST (l).
+func modeFinal(on bool) byte {
+	if on {
+		return 'h'
+	}
+	return 'l'
+}
+
+// lineEqual сравнивает строки экрана.
+func lineEqual(a, b *Line) bool {
+	return a.Wrapped == b.Wrapped && a.Mark == b.Mark && slices.Equal(a.Cells, b.Cells)
+}
+
+// muxAlerts переводит звонок, запросы OSC 52, уведомления и запросы цветов
+// терминала сервера в последовательности для клиентов: права доступа к
+// буферу обмена проверяет модель терминала клиента, а ответы на чтение
+// буфера и запросы цветов приходят от нее как ввод. Уведомления показывает
+// окно клиента.
+func muxAlerts(bell bool, reqs []ClipboardRequest, notes []Notification, queries []string) []byte {
+	var buf bytes.Buffer
+	if bell {
+		buf.WriteByte('\a')
+	}
+	for _, req := range reqs {
+		target := "c"
+		if req.Primary {
+			target = "p"
+		}
+		data := "?"
+		if !req.Read {
+			data = base64.StdEncoding.EncodeToString([]byte(req.Text))
+		}
+		buf.WriteString("\x1b]52;" + target + ";" + data + "\x1b\\")
+	}
+	for _, n := range notes {
+		buf.WriteString(osc99(n))
+	}
+	for _, q := range queries {
+		buf.WriteString(q)
+	}
+	return buf.Bytes()
+}
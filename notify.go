@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ограничения уведомлений, чтобы программа не могла занять ими память.
+const (
+	maxNotificationText = 1024 // Длина заголовка и текста в байтах
+	maxNotifications    = 16   // Очередь уведомлений для главного потока
+	maxPendingNotes     = 16   // Незавершенные уведомления OSC 99
+)
+
+// Ограничения показа уведомлений: программа, выводящая их в цикле, не
+// должна засыпать ими рабочий стол и запускать процессы без счета.
+const (
+	notifyBurst          = 3                // Уведомлений панели подряд
+	notifyInterval       = time.Second      // Затем одно уведомление за интервал
+	notifyQueue          = 16               // Очередь потока уведомлений
+	notifyCommandTimeout = 10 * time.Second // Время работы команды уведомления
+)
+
+// Notification - уведомление рабочего стола, которое запросила программа
+// через OSC 9, OSC 777 или OSC 99.
+type Notification struct {
+	Title, Body string
+	Urgency     byte // 0 - низкая, 1 - обычная, 2 - срочная
+	Always      bool // Показывать, даже если окно в фокусе
+}
+
+// notifyOSC обрабатывает OSC 9 ; text (iTerm2). Числовые команды вида
+// 9 ; 4 ; ... - это индикатор выполнения ConEmu, а не уведомление.
+func (t *Terminal) notifyOSC(arg string) {
+	if first, _, _ := strings.Cut(arg, ";"); first != "" && strings.Trim(first, "0123456789") == "" {
+		return
+	}
+	t.queueNotification(Notification{Body: arg, Urgency: 1})
+}
+
+// notifyRxvtOSC обрабатывает OSC 777 ; notify ; title ; body (urxvt).
+func (t *Terminal) notifyRxvtOSC(arg string) {
+	parts := strings.SplitN(arg, ";", 3)
+	if parts[0] != "notify" || len(parts) < 2 {
+		return
+	}
+	n := Notification{Title: parts[1], Urgency: 1}
+	if len(parts) == 3 {
+		n.Body = parts[2]
+	}
+	t.queueNotification(n)
+}
+
+// notifyKittyOSC обрабатывает OSC 99 ; metadata ; payload (kitty).
+// Метаданные - пары key=value через двоеточие: i - номер уведомления,
+// d=0 - будут еще части, p - часть (title или body), e=1 - payload в
+// base64, u - срочность, o=always - показывать и в фокусе. Части с одним
+// номером собираются в одно уведомление до части без d=0.
+func (t *Terminal) notifyKittyOSC(arg string) {
+	meta, payload, _ := strings.Cut(arg, ";")
+	keys := make(map[string]string)
+	for _, kv := range strings.Split(meta, ":") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			keys[k] = v
+		}
+	}
+	part := keys["p"]
+	if part == "" {
+		part = "title"
+	}
+	if part != "title" && part != "body" {
+		return // Запросы возможностей, значки и кнопки не поддерживаются
+	}
+	if keys["e"] == "1" {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return
+		}
+		payload = string(data)
+	}
+
+	id := keys["i"]
+	n, ok := t.pendingNotes[id]
+	if !ok {
+		if len(t.pendingNotes) >= maxPendingNotes {
+			clear(t.pendingNotes) // Программа не завершает уведомления
+		}
+		n = &Notification{Urgency: 1}
+	}
+	switch keys["u"] {
+	case "0", "1", "2":
+		n.Urgency = keys["u"][0] - '0'
+	}
+	if o, ok := keys["o"]; ok {
+		n.Always = o == "always"
+	}
+	if part == "title" {
+		n.Title = truncateText(n.Title + payload)
+	} else {
+		n.Body = truncateText(n.Body + payload)
+	}
+
+	if keys["d"] == "0" {
+		if t.pendingNotes == nil {
+			t.pendingNotes = make(map[string]*Notification)
+		}
+		t.pendingNotes[id] = n
+		return
+	}
+	delete(t.pendingNotes, id)
+	t.queueNotification(*n)
+}
+
+// queueNotification ставит уведомление в очередь для главного потока.
+func (t *Terminal) queueNotification(n Notification) {
+	n.Title, n.Body = truncateText(n.Title), truncateText(n.Body)
+	if n.Title == "" && n.Body == "" {
+		return
+	}
+	// Ограничиваем очередь, если главный поток не успевает ее разбирать
+	if len(t.notifications) < maxNotifications {
+		t.notifications = append(t.notifications, n)
+	}
+}
+
+// truncateText обрезает текст уведомления до maxNotificationText байт, не
+// разрезая символы.
+func truncateText(s string) string {
+	if len(s) <= maxNotificationText {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxNotificationText], "")
+}
+
+// TakeNotifications забирает накопленные уведомления.
+func (t *Terminal) TakeNotifications() []Notification {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	notes := t.notifications
+	t.notifications = nil
+	return notes
+}
+
+// osc99 формирует OSC 99 для уведомления n: заголовок и текст в base64
+// передаются двумя частями, поэтому их содержимое не ограничено.
+func osc99(n Notification) string {
+	always := ""
+	if n.Always {
+		always = ":o=always"
+	}
+	return fmt.Sprintf("\x1b]99;i=bareterm:d=0:e=1:p=title:u=%d%s;%s\x1b\\\x1b]99;i=bareterm:e=1:p=body;%s\x1b\\",
+		n.Urgency, always, base64.StdEncoding.EncodeToString([]byte(n.Title)), base64.StdEncoding.EncodeToString([]byte(n.Body)))
+}
+
+// notifyLimit ограничивает частоту уведомлений одной панели: подряд
+// показываются notifyBurst уведомлений, затем одно за notifyInterval.
+type notifyLimit struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow сообщает, можно ли показать уведомление в момент now.
+func (l *notifyLimit) Allow(now time.Time) bool {
+	l.tokens = min(l.tokens+float64(now.Sub(l.last))/float64(notifyInterval), notifyBurst)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// notifyJob - уведомление в очереди потока уведомлений.
+type notifyJob struct {
+	n       Notification
+	command []string
+}
+
+// Notifier показывает уведомления через сервис
+// org.freedesktop.Notifications сессионной шины D-Bus. Уведомления
+// показываются по одному в отдельной горутине. Соединение открывается при
+// первом уведомлении и заново после ошибки.
+type Notifier struct {
+	queue chan notifyJob
+	mu    sync.Mutex
+	bus   *dbusConn
+}
+
+// NewNotifier запускает горутину показа уведомлений.
+func NewNotifier() *Notifier {
+	nt := &Notifier{queue: make(chan notifyJob, notifyQueue)}
+	go func() {
+		for job := range nt.queue {
+			nt.Notify(job.n, job.command)
+		}
+	}()
+	return nt
+}
+
+// Post ставит уведомление в очередь показа. Если очередь заполнена,
+// уведомление пропускается. Не блокирует главный поток.
+func (nt *Notifier) Post(n Notification, command []string) {
+	select {
+	case nt.queue <- notifyJob{n, command}:
+	default:
+	}
+}
+
+// Notify показывает уведомление n и ждет ответа шины. Если D-Bus
+// недоступна, а command задана, запускается command с заголовком и текстом
+// уведомления в аргументах.
+func (nt *Notifier) Notify(n Notification, command []string) {
+	err := nt.notifyDBus(n)
+	if err == nil {
+		return
+	}
+	if len(command) == 0 {
+		log.Println(err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:], n.Title, n.Body)...)
+	if err := cmd.Run(); err != nil {
+		log.Println("failed to run notification command:", err)
+	}
+}
+
+// notifyDBus вызывает Notify сервиса уведомлений.
+func (nt *Notifier) notifyDBus(n Notification) error {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	if nt.bus == nil {
+		bus, err := dialSessionBus()
+		if err != nil {
+			return fmt.Errorf("failed to show notification: %v", err)
+		}
+		nt.bus = bus
+	}
+	err := nt.bus.Call("org.freedesktop.Notifications", "/org/freedesktop/Notifications",
+		"org.freedesktop.Notifications", "Notify", "susssasa{sv}i",
+		"bareterm", uint32(0), "utilities-terminal", n.Title, n.Body, []string{},
+		map[string]byte{"urgency": n.Urgency}, int32(-1))
+	if err != nil {
+		nt.bus.Close()
+		nt.bus = nil
+		return fmt.Errorf("failed to show notification: %v", err)
+	}
+	return nil
+}
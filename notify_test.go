@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCall - вызов метода, полученный тестовой шиной.
+type fakeCall struct {
+	member, sig string
+	body        []byte
+}
+
+// fakeBus - сессионная шина D-Bus для тестов на временном сокете. Она
+// проходит аутентификацию EXTERNAL (или отклоняет ее, если reject) и
+// отвечает на любой вызов пустым результатом.
+type fakeBus struct {
+	reject bool
+	auth   chan string // Номер пользователя из AUTH EXTERNAL
+	calls  chan fakeCall
+}
+
+func startFakeBus(t *testing.T, reject bool) *fakeBus {
+	path := filepath.Join(t.TempDir(), "bus")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+path)
+
+	bus := &fakeBus{reject: reject, auth: make(chan string, 4), calls: make(chan fakeCall, 16)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go bus.serve(conn)
+		}
+	}()
+	return bus
+}
+
+func (b *fakeBus) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if nul, err := r.ReadByte(); err != nil || nul != 0 {
+		return
+	}
+	line, err := r.ReadString('\n')
+	uid, ok := strings.CutPrefix(strings.TrimSuffix(line, "\r\n"), "AUTH EXTERNAL ")
+	if err != nil || !ok {
+		return
+	}
+	b.auth <- uid
+	if b.reject {
+		io.WriteString(conn, "REJECTED EXTERNAL\r\n")
+		return
+	}
+	io.WriteString(conn, "OK 0123456789abcdef0123456789abcdef\r\n")
+	if line, err := r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	for {
+		var fixed [16]byte
+		if _, err := io.ReadFull(r, fixed[:]); err != nil {
+			return
+		}
+		order := binary.LittleEndian
+		serial := order.Uint32(fixed[8:])
+		bodyLen, fieldsLen := order.Uint32(fixed[4:]), order.Uint32(fixed[12:])
+		rest := make([]byte, (fieldsLen+7)&^7+bodyLen)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return
+		}
+		call := fakeCall{body: rest[(fieldsLen+7)&^7:]}
+		d := dbusDecoder{buf: rest[:fieldsLen], order: order}
+		for d.pos < len(d.buf) && d.err == nil {
+			d.align(8)
+			code := d.byte()
+			var value string
+			if d.signature() == "g" {
+				value = d.signature()
+			} else {
+				value = d.string()
+			}
+			switch code {
+			case dbusFieldMember:
+				call.member = value
+			case dbusFieldSignature:
+				call.sig = value
+			}
+		}
+		b.calls <- call
+
+		var e dbusEncoder
+		e.buf = append(e.buf, 'l', dbusMethodReturn, 0, 1)
+		e.uint32(0)
+		e.uint32(serial + 1000)
+		size, start := e.arrayStart(8)
+		e.buf = append(e.buf, dbusFieldReplySerial)
+		e.signature("u")
+		e.uint32(serial)
+		e.arrayEnd(size, start)
+		e.align(8)
+		if _, err := conn.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+// call ждет очередной вызов метода.
+func (b *fakeBus) call(t *testing.T) fakeCall {
+	t.Helper()
+	select {
+	case call := <-b.calls:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("no call on the bus")
+		return fakeCall{}
+	}
+}
+
+func TestNotifyDBus(t *testing.T) {
+	bus := startFakeBus(t, false)
+	nt := &Notifier{}
+	nt.Notify(Notification{Title: "Сборка", Body: "готово", Urgency: 2}, nil)
+
+	if uid, want := <-bus.auth, hex.EncodeToString([]byte(strconv.Itoa(os.Getuid()))); uid != want {
+		t.Errorf("AUTH EXTERNAL %s, want %s", uid, want)
+	}
+	if call := bus.call(t); call.member != "Hello" || call.sig != "" {
+		t.Errorf("first call = %s(%s), want Hello()", call.member, call.sig)
+	}
+	call := bus.call(t)
+	if call.member != "Notify" || call.sig != "susssasa{sv}i" {
+		t.Fatalf("call = %s(%s), want Notify(susssasa{sv}i)", call.member, call.sig)
+	}
+
+	d := dbusDecoder{buf: call.body, order: binary.LittleEndian}
+	app, id, icon, summary, body := d.string(), d.uint32(), d.string(), d.string(), d.string()
+	actions := d.uint32()
+	hints := make(map[string]byte)
+	n := d.uint32()
+	d.align(8)
+	for end := d.pos + int(n); d.pos < end && d.err == nil; {
+		d.align(8)
+		key := d.string()
+		if sig := d.signature(); sig != "y" {
+			t.Fatalf("hint %s has signature %q, want y", key, sig)
+		}
+		hints[key] = d.byte()
+	}
+	timeout := int32(d.uint32())
+	if d.err != nil || d.pos != len(d.buf) {
+		t.Fatalf("failed to decode Notify arguments: %v", d.err)
+	}
+	if app != "bareterm" || id != 0 || icon != "utilities-terminal" || summary != "Сборка" || body != "готово" {
+		t.Errorf("Notify(%q, %d, %q, %q, %q)", app, id, icon, summary, body)
+	}
+	if actions != 0 || len(hints) != 1 || hints["urgency"] != 2 || timeout != -1 {
+		t.Errorf("actions of %d bytes, hints %v, timeout %d", actions, hints, timeout)
+	}
+
+	// Следующее уведомление идет по тому же соединению
+	nt.Notify(Notification{Body: "еще"}, nil)
+	if call := bus.call(t); call.member != "Notify" {
+		t.Errorf("second call = %s, want Notify", call.member)
+	}
+}
+
+func TestNotifyFallback(t *testing.T) {
+	bus := startFakeBus(t, true)
+	out := filepath.Join(t.TempDir(), "out")
+	command := []string{"sh", "-c", `printf '%s|%s' "$1" "$2" > "$0"`, out}
+	NewNotifier().Post(Notification{Title: "Сборка", Body: "готово"}, command)
+
+	<-bus.auth
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(out); err == nil && len(data) > 0 {
+			if string(data) != "Сборка|готово" {
+				t.Errorf("command got %q", data)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("fallback command did not run")
+}
+
+func TestNotifyLimit(t *testing.T) {
+	var l notifyLimit
+	now := time.Now()
+	for i := 0; i < notifyBurst; i++ {
+		if !l.Allow(now) {
+			t.Fatalf("notification %d of a burst was refused", i)
+		}
+	}
+	if l.Allow(now) {
+		t.Error("notification beyond the burst was allowed")
+	}
+	if l.Allow(now.Add(notifyInterval / 2)) {
+		t.Error("notification before the interval was allowed")
+	}
+	if !l.Allow(now.Add(notifyInterval)) {
+		t.Error("notification after the interval was refused")
+	}
+}
+
+func TestNotifyOSC(t *testing.T) {
+	term := NewTerminal(4, 10)
+	term.Write([]byte("\x1b]9;4;1;50\x1b\\" + // Индикатор ConEmu
+		"\x1b]9;hello\x07" +
+		"\x1b]777;notify;Title;Body\x1b\\" +
+		"\x1b]99;i=1:d=0:u=2;Kitty\x1b\\\x1b]99;i=1:p=body:e=1;" + "Ym9keQ==" + "\x1b\\"))
+	want := []Notification{
+		{Body: "hello", Urgency: 1},
+		{Title: "Title", Body: "Body", Urgency: 1},
+		{Title: "Kitty", Body: "body", Urgency: 2},
+	}
+	got := term.TakeNotifications()
+	if len(got) != len(want) {
+		t.Fatalf("notifications = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("notification %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
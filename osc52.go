@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// ClipboardAccess определяет, как обрабатываются запросы OSC 52.
+type ClipboardAccess int
+
+const (
+	ClipboardDeny  ClipboardAccess = iota // Запрос отклоняется
+	ClipboardAsk                          // Пользователь подтверждает запрос
+	ClipboardAllow                        // Запрос выполняется без подтверждения
+)
+
+// ClipboardPolicy задает права программ на доступ к буферу обмена через OSC 52.
+type ClipboardPolicy struct {
+	Read    ClipboardAccess // Чтение буфера обмена (OSC 52 ; c ; ?)
+	Write   ClipboardAccess // Запись в буфер обмена
+	MaxSize int             // Максимальный размер записываемого текста в байтах
+}
+
+// maxClipboardSize ограничивает размер текста OSC 52 в настройках: текст
+// в base64 вместе с "52;c;" должен поместиться в строку OSC, длиннее
+// которой разборщик не принимает.
+const maxClipboardSize = (maxOSCLength - len("52;c;")) / 4 * 3
+
+// clipboardAccessNames - значения прав доступа в файле настроек.
+var clipboardAccessNames = [...]string{ClipboardDeny: "deny", ClipboardAsk: "ask", ClipboardAllow: "allow"}
+
+// parseClipboardAccess разбирает права доступа к буферу обмена из настроек.
+func parseClipboardAccess(s string) (ClipboardAccess, error) {
+	for access, name := range clipboardAccessNames {
+		if s == name {
+			return ClipboardAccess(access), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown clipboard access %q", s)
+}
+
+// String возвращает название прав доступа для файла настроек.
+func (a ClipboardAccess) String() string {
+	return clipboardAccessNames[a]
+}
+
+// defaultClipboardPolicy разрешает запись и запрещает чтение: прочитать
+// буфер обмена через OSC 52 может любая программа, в том числе на удаленной
+// машине, поэтому чтение нужно включать явно.
+var defaultClipboardPolicy = ClipboardPolicy{
+	Read:    ClipboardDeny,
+	Write:   ClipboardAllow,
+	MaxSize: 512 << 10,
+}
+
+// ClipboardRequest - запрос программы на чтение или запись буфера обмена.
+// Буфер обмена GLFW доступен только из главного потока, поэтому запросы
+// копятся в модели терминала и выполняются при отрисовке кадра.
+type ClipboardRequest struct {
+	Primary bool   // Первичное выделение вместо буфера обмена
+	Read    bool   // Запрос содержимого
+	Text    string // Текст для записи
+	Ask     bool   // Перед выполнением нужно спросить пользователя
+}
+
+// parseOSC52 разбирает аргумент OSC 52 вида "Pc;Pd", где Pc - список
+// буферов, а Pd - текст в base64 или "?" для запроса содержимого.
+func parseOSC52(arg string, maxSize int) (ClipboardRequest, error) {
+	targets, data, ok := strings.Cut(arg, ";")
+	if !ok {
+		return ClipboardRequest{}, fmt.Errorf("missing clipboard data")
+	}
+
+	var req ClipboardRequest
+	// Из списка буферов используется первый известный; пустой список означает "s 0"
+	for _, c := range targets {
+		if c == 'p' {
+			req.Primary = true
+			break
+		}
+		if strings.ContainsRune("cqs01234567", c) {
+			break
+		}
+	}
+
+	if data == "?" {
+		req.Read = true
+		return req, nil
+	}
+	// DecodedLen не учитывает дополнение "=", поэтому точный размер
+	// проверяется после декодирования
+	if base64.StdEncoding.DecodedLen(len(data)) > maxSize+2 {
+		return ClipboardRequest{}, fmt.Errorf("clipboard data exceeds %d bytes", maxSize)
+	}
+	text, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return ClipboardRequest{}, fmt.Errorf("invalid clipboard data: %v", err)
+	}
+	if len(text) > maxSize {
+		return ClipboardRequest{}, fmt.Errorf("clipboard data exceeds %d bytes", maxSize)
+	}
+	req.Text = string(text)
+	return req, nil
+}
+
+// SetClipboardPolicy задает права программы на доступ к буферу обмена.
+func (t *Terminal) SetClipboardPolicy(p ClipboardPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clipboardPolicy = p
+}
+
+// clipboardOSC обрабатывает OSC 52 с учетом политики доступа.
+func (t *Terminal) clipboardOSC(arg string) {
+	req, err := parseOSC52(arg, t.clipboardPolicy.MaxSize)
+	if err != nil {
+		return
+	}
+	access := t.clipboardPolicy.Write
+	if req.Read {
+		access = t.clipboardPolicy.Read
+	}
+	switch access {
+	case ClipboardDeny:
+		return
+	case ClipboardAsk:
+		req.Ask = true
+	}
+	// Ограничиваем очередь, если главный поток не успевает ее разбирать
+	if len(t.clipboardRequests) < 16 {
+		t.clipboardRequests = append(t.clipboardRequests, req)
+	}
+}
+
+// TakeClipboardRequests забирает накопленные запросы OSC 52.
+func (t *Terminal) TakeClipboardRequests() []ClipboardRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reqs := t.clipboardRequests
+	t.clipboardRequests = nil
+	return reqs
+}
+
+// osc52Reply формирует ответ на запрос содержимого буфера обмена.
+func osc52Reply(req ClipboardRequest, text string) []byte {
+	target := "c"
+	if req.Primary {
+		target = "p"
+	}
+	return []byte("\x1b]52;" + target + ";" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x1b\\")
+}
+
+// Description возвращает вопрос пользователю для подтверждения запроса.
+func (req ClipboardRequest) Description() string {
+	if req.Read {
+		return "Allow the program to read the clipboard? [y/N]"
+	}
+	return fmt.Sprintf("Allow the program to copy %d bytes to the clipboard? [y/N]", len(req.Text))
+}
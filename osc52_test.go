@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestParseOSC52(t *testing.T) {
+	hello := base64.StdEncoding.EncodeToString([]byte("hello"))
+	for _, tt := range []struct {
+		arg     string
+		maxSize int
+		want    ClipboardRequest
+		wantErr bool
+	}{
+		{arg: "c;" + hello, maxSize: 100, want: ClipboardRequest{Text: "hello"}},
+		{arg: ";" + hello, maxSize: 100, want: ClipboardRequest{Text: "hello"}},
+		{arg: "p;" + hello, maxSize: 100, want: ClipboardRequest{Primary: true, Text: "hello"}},
+		{arg: "cp;" + hello, maxSize: 100, want: ClipboardRequest{Text: "hello"}},
+		{arg: "xp;" + hello, maxSize: 100, want: ClipboardRequest{Primary: true, Text: "hello"}},
+		{arg: "c;?", maxSize: 100, want: ClipboardRequest{Read: true}},
+		{arg: "p;?", maxSize: 0, want: ClipboardRequest{Primary: true, Read: true}},
+		{arg: "c;", maxSize: 100, want: ClipboardRequest{}},
+		{arg: "c;" + hello, maxSize: 3, wantErr: true},
+		{arg: "c;not base64!", maxSize: 100, wantErr: true},
+		{arg: "c", maxSize: 100, wantErr: true},
+	} {
+		got, err := parseOSC52(tt.arg, tt.maxSize)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOSC52(%q) error = %v, want error %t", tt.arg, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseOSC52(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestClipboardPolicy(t *testing.T) {
+	write := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte("text")) + "\x1b\\"
+	read := "\x1b]52;c;?\x1b\\"
+	accesses := []ClipboardAccess{ClipboardAllow, ClipboardAsk, ClipboardDeny}
+	for _, r := range accesses {
+		for _, w := range accesses {
+			term := NewTerminal(4, 10)
+			term.SetClipboardPolicy(ClipboardPolicy{Read: r, Write: w, MaxSize: 100})
+			term.Write([]byte(write + read))
+
+			var want []ClipboardRequest
+			if w != ClipboardDeny {
+				want = append(want, ClipboardRequest{Text: "text", Ask: w == ClipboardAsk})
+			}
+			if r != ClipboardDeny {
+				want = append(want, ClipboardRequest{Read: true, Ask: r == ClipboardAsk})
+			}
+			got := term.TakeClipboardRequests()
+			if len(got) != len(want) {
+				t.Errorf("read %s, write %s: requests = %+v, want %+v", r, w, got, want)
+				continue
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("read %s, write %s: request %d = %+v, want %+v", r, w, i, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestClipboardMaxSize(t *testing.T) {
+	term := NewTerminal(4, 10)
+	term.SetClipboardPolicy(ClipboardPolicy{Write: ClipboardAllow, MaxSize: 4})
+	for _, text := range []string{"four", "five!"} {
+		term.Write([]byte("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x1b\\"))
+	}
+	if got := term.TakeClipboardRequests(); len(got) != 1 || got[0].Text != "four" {
+		t.Errorf("requests = %+v, want only the text within the limit", got)
+	}
+}
+
+// Текст наибольшего допустимого в настройках размера проходит через
+// разборщик целиком.
+func TestClipboardMaxSizeFitsOSC(t *testing.T) {
+	term := NewTerminal(4, 10)
+	term.SetClipboardPolicy(ClipboardPolicy{Write: ClipboardAllow, MaxSize: maxClipboardSize})
+	text := strings.Repeat("x", maxClipboardSize)
+	term.Write([]byte("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x1b\\"))
+	if got := term.TakeClipboardRequests(); len(got) != 1 || got[0].Text != text {
+		t.Errorf("got %d requests, want the text of %d bytes", len(got), maxClipboardSize)
+	}
+}
+
+func TestParseClipboardAccess(t *testing.T) {
+	for _, access := range []ClipboardAccess{ClipboardAllow, ClipboardAsk, ClipboardDeny} {
+		if got, err := parseClipboardAccess(access.String()); err != nil || got != access {
+			t.Errorf("parseClipboardAccess(%q) = %v, %v", access, got, err)
+		}
+	}
+	if _, err := parseClipboardAccess("always"); err == nil {
+		t.Error("parseClipboardAccess accepted an unknown value")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette - цвета терминала, которые программа может менять через OSC.
+// Цвета хранятся в формате RGB. Cursor, SelectionFG и SelectionBG могут
+// быть colorDefault: тогда курсор и выделение рисуются инверсией цветов.
+type Palette struct {
+	Colors      [256]Color // Цвета для индексов SGR 30-37, 90-97 и 38;5
+	Foreground  Color      // Цвет текста по умолчанию (OSC 10)
+	Background  Color      // Цвет фона по умолчанию (OSC 11)
+	Cursor      Color      // Цвет курсора (OSC 12)
+	SelectionBG Color      // Цвет фона выделения (OSC 17)
+	SelectionFG Color      // Цвет текста выделения (OSC 19)
+}
+
+// defaultPalette возвращает палитру xterm с белым текстом на черном фоне.
+func defaultPalette() Palette {
+	return Palette{
+		Colors:     xtermPalette(),
+		Foreground: RGBColor(0xFF, 0xFF, 0xFF),
+		Background: RGBColor(0x00, 0x00, 0x00),
+	}
+}
+
+// dynamicColor возвращает указатель на цвет OSC 10-19 в палитре p.
+func (p *Palette) dynamicColor(n int) *Color {
+	switch n {
+	case 10:
+		return &p.Foreground
+	case 11:
+		return &p.Background
+	case 12:
+		return &p.Cursor
+	case 17:
+		return &p.SelectionBG
+	case 19:
+		return &p.SelectionFG
+	}
+	return nil
+}
+
+// SetDefaultPalette задает палитру, к которой возвращают OSC 104/110-119 и
+// сброс терминала, и сразу применяет ее.
+func (t *Terminal) SetDefaultPalette(p Palette) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.defaultPalette = p
+	t.palette = p
+	t.dirty = true
+}
+
+// SetForwardColorQueries включает передачу запросов цветов OSC 4 и 10-19
+// клиентам сервера: отвечать на них должен клиент, чьи цвета видит
+// пользователь.
+func (t *Terminal) SetForwardColorQueries(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forwardQueries = on
+}
+
+// forwardColorQuery запоминает запрос цвета для клиентов сервера.
+func (t *Terminal) forwardColorQuery(query string) {
+	// Ограничиваем очередь, если сервер не успевает ее разбирать
+	if len(t.colorQueries) < 64 {
+		t.colorQueries = append(t.colorQueries, query)
+	}
+}
+
+// TakeColorQueries забирает накопленные запросы цветов.
+func (t *Terminal) TakeColorQueries() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	queries := t.colorQueries
+	t.colorQueries = nil
+	return queries
+}
+
+// paletteOSC обрабатывает OSC 4 ; index ; spec [; index ; spec ...].
+// Вместо spec можно передать "?", чтобы узнать текущий цвет.
+func (t *Terminal) paletteOSC(arg string) {
+	fields := strings.Split(arg, ";")
+	for i := 0; i+1 < len(fields); i += 2 {
+		index, err := strconv.Atoi(fields[i])
+		if err != nil || index < 0 || index > 255 {
+			continue
+		}
+		if fields[i+1] == "?" && t.forwardQueries {
+			t.forwardColorQuery(fmt.Sprintf("\x1b]4;%d;?\x1b\\", index))
+		} else if fields[i+1] == "?" {
+			t.reply(fmt.Sprintf("\x1b]4;%d;%s\x1b\\", index, formatColorSpec(t.palette.Colors[index])))
+		} else if c, ok := parseColorSpec(fields[i+1]); ok {
+			t.palette.Colors[index] = c
+		}
+	}
+}
+
+// resetPaletteOSC обрабатывает OSC 104 [; index ...]. Без индексов
+// сбрасывается вся палитра.
+func (t *Terminal) resetPaletteOSC(arg string) {
+	if arg == "" {
+		t.palette.Colors = t.defaultPalette.Colors
+		return
+	}
+	for _, field := range strings.Split(arg, ";") {
+		if index, err := strconv.Atoi(field); err == nil && index >= 0 && index <= 255 {
+			t.palette.Colors[index] = t.defaultPalette.Colors[index]
+		}
+	}
+}
+
+// dynamicColorOSC обрабатывает OSC 10-19 ; spec [; spec ...]. Как в xterm,
+// следующие значения относятся к следующим номерам: OSC 10 ; fg ; bg задает
+// и текст, и фон.
+func (t *Terminal) dynamicColorOSC(n int, arg string) {
+	for _, spec := range strings.Split(arg, ";") {
+		if c := t.palette.dynamicColor(n); c != nil {
+			if spec == "?" && t.forwardQueries {
+				t.forwardColorQuery(fmt.Sprintf("\x1b]%d;?\x1b\\", n))
+			} else if spec == "?" {
+				t.reply(fmt.Sprintf("\x1b]%d;%s\x1b\\", n, formatColorSpec(t.queryColor(n))))
+			} else if rgb, ok := parseColorSpec(spec); ok {
+				*c = rgb
+			}
+		}
+		n++
+	}
+}
+
+// queryColor возвращает цвет OSC 10-19 для ответа на запрос. Не заданные
+// цвета курсора и выделения сообщаются такими, какими они видны на экране.
+func (t *Terminal) queryColor(n int) Color {
+	c := *t.palette.dynamicColor(n)
+	if !c.IsDefault() {
+		return c
+	}
+	if n == 19 {
+		return t.palette.Background // Текст выделения - цвет фона
+	}
+	return t.palette.Foreground
+}
+
+// resetDynamicColorOSC обрабатывает OSC 110-119: возвращает цвет OSC n-100
+// к значению по умолчанию.
+func (t *Terminal) resetDynamicColorOSC(n int) {
+	if c := t.palette.dynamicColor(n - 100); c != nil {
+		*c = *t.defaultPalette.dynamicColor(n - 100)
+	}
+}
+
+// parseColorSpec разбирает цвет в форматах XParseColor: rgb:r/g/b с 1-4
+// шестнадцатеричными цифрами на компонент и #rgb, #rrggbb, #rrrgggbbb,
+// #rrrrggggbbbb.
+func parseColorSpec(spec string) (Color, bool) {
+	var parts []string
+	if rest, ok := strings.CutPrefix(spec, "rgb:"); ok {
+		parts = strings.Split(rest, "/")
+		if len(parts) != 3 {
+			return 0, false
+		}
+	} else if rest, ok := strings.CutPrefix(spec, "#"); ok {
+		n := len(rest) / 3
+		if n == 0 || len(rest)%3 != 0 || n > 4 {
+			return 0, false
+		}
+		parts = []string{rest[:n], rest[n : 2*n], rest[2*n:]}
+	} else {
+		return 0, false
+	}
+
+	var rgb [3]uint8
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 4 {
+			return 0, false
+		}
+		v, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return 0, false
+		}
+		// Компонент из n цифр масштабируется к 8 битам
+		maxValue := uint64(1)<<(4*len(part)) - 1
+		rgb[i] = uint8((v*255 + maxValue/2) / maxValue)
+	}
+	return RGBColor(rgb[0], rgb[1], rgb[2]), true
+}
+
+// formatColorSpec записывает цвет в формате ответа xterm rgb:RRRR/GGGG/BBBB.
+func formatColorSpec(c Color) string {
+	r, g, b := uint8(c>>16), uint8(c>>8), uint8(c)
+	return fmt.Sprintf("rgb:%04x/%04x/%04x", uint16(r)*257, uint16(g)*257, uint16(b)*257)
+}
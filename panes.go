@@ -0,0 +1,441 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Pane - панель вкладки: программа в своем псевдотерминале со своим экраном
+// и историей прокрутки, показанная в прямоугольнике сетки.
+type Pane struct {
+	id       int // Номер для удаленного управления
+	session  *Session
+	view     View
+	prompts  []ClipboardRequest // Запросы OSC 52, ожидающие подтверждения
+	exited   bool               // Завершение программы уже обработано
+	title    string             // Заголовок, заданный через удаленное управление
+	reported string             // Заголовок из последнего события title
+	notified notifyLimit        // Частота уведомлений программы
+}
+
+// Title возвращает заголовок панели: заданный через удаленное управление,
+// а если его нет - заголовок сессии по шаблону format из настроек.
+func (p *Pane) Title(format string) string {
+	if p.title != "" {
+		return p.title
+	}
+	return formatTitle(format, p.session)
+}
+
+// formatTitle подставляет в шаблон заголовка {title} - заголовок сессии и
+// {cwd} - рабочий каталог ее программы.
+func formatTitle(format string, s *Session) string {
+	if format == "" || format == "{title}" {
+		return s.Title()
+	}
+	var cwd string
+	if strings.Contains(format, "{cwd}") {
+		cwd = shortPath(s.Cwd())
+	}
+	return strings.NewReplacer("{title}", s.Title(), "{cwd}", cwd).Replace(format)
+}
+
+// paneDir возвращает каталог для новой панели рядом с p: рабочий каталог ее
+// программы, а если он неизвестен - каталог из --working-directory.
+func (app *App) paneDir(p *Pane) string {
+	if cwd := p.session.Cwd(); cwd != "" {
+		return cwd
+	}
+	return app.opts.Dir
+}
+
+// SplitDir - направление разделения панелей.
+type SplitDir int
+
+const (
+	SplitHorizontal SplitDir = iota // Панели слева и справа
+	SplitVertical                   // Панели сверху и снизу
+)
+
+// Layout - узел дерева раскладки панелей вкладки: лист с панелью или
+// разделение прямоугольника на две части линией шириной в одну ячейку.
+type Layout struct {
+	Pane          *Pane // Панель листа; nil у разделения
+	Dir           SplitDir
+	Ratio         float64 // Доля первой части в разделении
+	First, Second *Layout
+	parent        *Layout
+	rect          Rect // Прямоугольник узла при последней раскладке
+}
+
+// find возвращает лист с панелью p или nil.
+func (l *Layout) find(p *Pane) *Layout {
+	if l.Pane != nil {
+		if l.Pane == p {
+			return l
+		}
+		return nil
+	}
+	if found := l.First.find(p); found != nil {
+		return found
+	}
+	return l.Second.find(p)
+}
+
+// Split делит лист с панелью p на две части: p остается первой, а np
+// становится второй.
+func (l *Layout) Split(p *Pane, dir SplitDir, np *Pane) {
+	leaf := l.find(p)
+	leaf.First = &Layout{Pane: p, parent: leaf}
+	leaf.Second = &Layout{Pane: np, parent: leaf}
+	leaf.Pane, leaf.Dir, leaf.Ratio = nil, dir, 0.5
+}
+
+// Remove убирает панель p, отдавая ее место соседней части разделения, и
+// возвращает узел, занявший это место. Единственную панель убрать нельзя,
+// тогда возвращается nil.
+func (l *Layout) Remove(p *Pane) *Layout {
+	parent := l.find(p).parent
+	if parent == nil {
+		return nil
+	}
+	sibling := parent.First
+	if sibling.Pane == p {
+		sibling = parent.Second
+	}
+	// Соседняя часть переносится в узел разделения, чтобы не менять
+	// ссылку на него у его родителя
+	parent.Pane, parent.Dir, parent.Ratio = sibling.Pane, sibling.Dir, sibling.Ratio
+	parent.First, parent.Second = sibling.First, sibling.Second
+	if parent.First != nil {
+		parent.First.parent, parent.Second.parent = parent, parent
+	}
+	return parent
+}
+
+// Panes возвращает панели слева направо и сверху вниз.
+func (l *Layout) Panes() []*Pane {
+	if l.Pane != nil {
+		return []*Pane{l.Pane}
+	}
+	return append(l.First.Panes(), l.Second.Panes()...)
+}
+
+// Arrange раскладывает панели по прямоугольнику r.
+func (l *Layout) Arrange(r Rect) {
+	l.rect = r
+	if l.Pane != nil {
+		l.Pane.view.Rect = r
+		return
+	}
+	first, second := r, r
+	if l.Dir == SplitHorizontal {
+		first.Cols = splitSize(r.Cols, l.Ratio, minPaneCols)
+		second.Col = r.Col + first.Cols + 1
+		second.Cols = max(r.Cols-first.Cols-1, minPaneCols)
+	} else {
+		first.Rows = splitSize(r.Rows, l.Ratio, 1)
+		second.Row = r.Row + first.Rows + 1
+		second.Rows = max(r.Rows-first.Rows-1, 1)
+	}
+	l.First.Arrange(first)
+	l.Second.Arrange(second)
+}
+
+// minPaneCols - наименьшая ширина панели: в нее должен помещаться широкий символ.
+const minPaneCols = 2
+
+// splitSize возвращает размер первой части разделения size ячеек, из
+// которых одна занята линией. Каждой части остается хотя бы least ячеек.
+func splitSize(size int, ratio float64, least int) int {
+	n := size - 1
+	return clamp(int(math.Round(float64(n)*ratio)), least, max(n-least, least))
+}
+
+// divider возвращает прямоугольник линии разделения.
+func (l *Layout) divider() Rect {
+	first := l.First.rect
+	if l.Dir == SplitHorizontal {
+		return Rect{Row: l.rect.Row, Col: first.Col + first.Cols, Rows: l.rect.Rows, Cols: 1}
+	}
+	return Rect{Row: first.Row + first.Rows, Col: l.rect.Col, Rows: 1, Cols: l.rect.Cols}
+}
+
+// Dividers добавляет к dst линии всех разделений.
+func (l *Layout) Dividers(dst []Rect) []Rect {
+	if l.Pane != nil {
+		return dst
+	}
+	dst = append(dst, l.divider())
+	return l.Second.Dividers(l.First.Dividers(dst))
+}
+
+// DividerAt возвращает разделение, линия которого проходит через ячейку
+// сетки (row, col), или nil.
+func (l *Layout) DividerAt(row, col int) *Layout {
+	if l.Pane != nil {
+		return nil
+	}
+	if l.divider().Contains(row, col) {
+		return l
+	}
+	if found := l.First.DividerAt(row, col); found != nil {
+		return found
+	}
+	return l.Second.DividerAt(row, col)
+}
+
+// MoveDivider переносит линию разделения в строку или столбец сетки pos.
+func (l *Layout) MoveDivider(pos int) {
+	start, size, least := l.rect.Col, l.rect.Cols, minPaneCols
+	if l.Dir == SplitVertical {
+		start, size, least = l.rect.Row, l.rect.Rows, 1
+	}
+	if size < 2*least+1 {
+		return
+	}
+	// Доля выбирается так, чтобы splitSize вернул ровно pos-start
+	first := clamp(pos-start, least, size-1-least)
+	l.Ratio = float64(first) / float64(size-1)
+}
+
+// Neighbor возвращает панель, соседнюю с p в направлении (dx, dy), с
+// наибольшей общей границей, или nil.
+func (l *Layout) Neighbor(p *Pane, dx, dy int) *Pane {
+	cur := l.find(p).rect
+	var best *Pane
+	bestOverlap := 0
+	for _, o := range l.Panes() {
+		r := l.find(o).rect
+		var adjacent bool
+		var overlap int
+		switch {
+		case dx < 0:
+			adjacent = r.Col+r.Cols+1 == cur.Col
+		case dx > 0:
+			adjacent = cur.Col+cur.Cols+1 == r.Col
+		case dy < 0:
+			adjacent = r.Row+r.Rows+1 == cur.Row
+		case dy > 0:
+			adjacent = cur.Row+cur.Rows+1 == r.Row
+		}
+		if dx != 0 {
+			overlap = min(r.Row+r.Rows, cur.Row+cur.Rows) - max(r.Row, cur.Row)
+		} else {
+			overlap = min(r.Col+r.Cols, cur.Col+cur.Cols) - max(r.Col, cur.Col)
+		}
+		if adjacent && overlap > bestOverlap {
+			best, bestOverlap = o, overlap
+		}
+	}
+	return best
+}
+
+// newPane запускает command в каталоге dir в новой панели. Пустая команда
+// означает оболочку пользователя. С --attach программа запускается на
+// сервере и переживет закрытие окна. Размер уточнит раскладка вкладки.
+func (app *App) newPane(command []string, dir string) (*Pane, error) {
+	rows, cols := app.grid.Size()
+	if !app.opts.Attach {
+		session, err := NewSession(rows, cols, command, dir, glfw.PostEmptyEvent)
+		if err != nil {
+			return nil, err
+		}
+		return app.initPane(session), nil
+	}
+	conn, err := dialServer()
+	if err != nil {
+		return nil, err
+	}
+	session, err := NewRemoteSession(conn, rows, cols, command, dir, glfw.PostEmptyEvent)
+	if err != nil {
+		return nil, err
+	}
+	return app.initPane(session), nil
+}
+
+// attachPane подключает новую панель к сессии id сервера.
+func (app *App) attachPane(id int) (*Pane, error) {
+	conn, err := dialServer()
+	if err != nil {
+		return nil, err
+	}
+	rows, cols := app.grid.Size()
+	session, err := AttachRemoteSession(conn, id, rows, cols, glfw.PostEmptyEvent)
+	if err != nil {
+		return nil, err
+	}
+	return app.initPane(session), nil
+}
+
+// initPane создает панель для сессии с настройками окна.
+func (app *App) initPane(session *Session) *Pane {
+	session.defaultTitle = app.opts.Title
+	app.configureTerm(session.term)
+	pane := &Pane{id: app.windows.newID(), session: session}
+	pane.reported = pane.Title(app.cfg.TitleFormat)
+	return pane
+}
+
+// SplitPane делит панель с фокусом и запускает оболочку во второй части
+// в рабочем каталоге панели с фокусом.
+func (app *App) SplitPane(dir SplitDir) {
+	tab := app.tab()
+	pane, err := app.newPane(app.cfg.Shell, app.paneDir(tab.focus))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	tab.layout.Split(tab.focus, dir, pane)
+	tab.focus, tab.zoomed = pane, false
+	app.arrange(tab)
+}
+
+// ClosePane закрывает панель p вкладки tab и завершает ее программу.
+// Вместе с последней панелью закрывается вкладка.
+func (app *App) ClosePane(tab *Tab, p *Pane) {
+	if app.grid.search.term == p.session.term || app.grid.vi.term == p.session.term {
+		app.cancelModes()
+	}
+	node := tab.layout.Remove(p)
+	if node == nil {
+		for i := range app.tabs {
+			if app.tabs[i] == tab {
+				app.CloseTab(i)
+				break
+			}
+		}
+		return
+	}
+	// Программа может не сразу завершиться по SIGHUP, поэтому ожидание
+	// не держит главный поток
+	go p.session.Close()
+	if tab.focus == p {
+		tab.focus = node.Panes()[0]
+	}
+	tab.zoomed, app.dragging = false, nil
+	app.arrange(tab)
+}
+
+// FocusPane переводит фокус на соседнюю панель в направлении (dx, dy).
+func (app *App) FocusPane(dx, dy int) {
+	tab := app.tab()
+	if pane := tab.layout.Neighbor(tab.focus, dx, dy); pane != nil {
+		app.focusPane(tab, pane)
+	}
+}
+
+// cancelModes выключает режимы, привязанные к экрану панели с фокусом:
+// подсказки, поиск и режим vi.
+func (app *App) cancelModes() {
+	app.grid.hints.Cancel()
+	app.closeSearch()
+	app.closeVi()
+}
+
+// focusPane переводит фокус вкладки на панель pane.
+func (app *App) focusPane(tab *Tab, pane *Pane) {
+	if tab.focus == pane {
+		return
+	}
+	app.cancelModes() // Подсказки, поиск и режим vi относятся к экрану прежней панели
+	tab.focus = pane
+	if tab.zoomed {
+		tab.zoomed = false
+		app.arrange(tab)
+	} else {
+		app.showTab()
+	}
+}
+
+// ZoomPane разворачивает панель с фокусом на всю вкладку или возвращает
+// ее на место.
+func (app *App) ZoomPane() {
+	tab := app.tab()
+	if tab.layout.Pane != nil {
+		return // Единственная панель и так занимает всю вкладку
+	}
+	tab.zoomed = !tab.zoomed
+	app.arrange(tab)
+}
+
+// arrange раскладывает панели вкладки по сетке и сообщает размеры их
+// терминалам и программам.
+func (app *App) arrange(tab *Tab) {
+	rows, cols := app.grid.Size()
+	area := Rect{Rows: rows, Cols: cols}
+	tab.layout.Arrange(area)
+	if tab.zoomed {
+		tab.focus.view.Rect = area
+	}
+	for _, p := range tab.layout.Panes() {
+		if err := p.session.Resize(p.view.Rows, p.view.Cols); err != nil {
+			log.Println(err)
+		}
+	}
+	if tab == app.tab() {
+		app.showTab()
+	}
+}
+
+// showTab передает сетке панели активной вкладки.
+func (app *App) showTab() {
+	tab := app.tab()
+	if tab.zoomed {
+		app.grid.SetViews([]*View{&tab.focus.view}, &tab.focus.view, nil)
+		return
+	}
+	panes := tab.layout.Panes()
+	views := make([]*View, len(panes))
+	for i, p := range panes {
+		views[i] = &p.view
+	}
+	app.grid.SetViews(views, &tab.focus.view, tab.layout.Dividers(nil))
+}
+
+// PaneButton обрабатывает нажатие кнопки мыши над панелями: переводит фокус
+// на панель под указателем и начинает перетаскивание линии разделения.
+// Возвращает true, если событие не нужно передавать терминалу.
+func (app *App) PaneButton(button glfw.MouseButton, action glfw.Action, x, y float64) bool {
+	if button != glfw.MouseButtonLeft {
+		return false
+	}
+	if action == glfw.Release {
+		dragging := app.dragging != nil
+		app.dragging = nil
+		return dragging
+	}
+	tab := app.tab()
+	row, col := app.grid.areaCellAt(x, y)
+	if !tab.zoomed {
+		if divider := tab.layout.DividerAt(row, col); divider != nil {
+			app.dragging = divider
+			return true
+		}
+	}
+	for _, p := range tab.layout.Panes() {
+		if p.view.Contains(row, col) && (!tab.zoomed || p == tab.focus) {
+			app.focusPane(tab, p)
+		}
+	}
+	return false
+}
+
+// PaneMove тянет линию разделения за мышью. Возвращает true, если идет
+// перетаскивание.
+func (app *App) PaneMove(x, y float64) bool {
+	if app.dragging == nil {
+		return false
+	}
+	row, col := app.grid.areaCellAt(x, y)
+	if app.dragging.Dir == SplitVertical {
+		app.dragging.MoveDivider(row)
+	} else {
+		app.dragging.MoveDivider(col)
+	}
+	app.arrange(app.tab())
+	return true
+}
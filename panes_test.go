@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+// Панели по горизонтали не бывают уже minPaneCols столбцов.
+func TestLayoutMinPaneCols(t *testing.T) {
+	p1, p2 := &Pane{}, &Pane{}
+	l := &Layout{Dir: SplitHorizontal, Ratio: 0.5, First: &Layout{Pane: p1}, Second: &Layout{Pane: p2}}
+	l.Arrange(Rect{Rows: 4, Cols: 11})
+	for _, pos := range []int{0, 1, 10, 11} {
+		l.MoveDivider(pos)
+		l.Arrange(Rect{Rows: 4, Cols: 11})
+		if a, b := p1.view.Cols, p2.view.Cols; a < minPaneCols || b < minPaneCols || a+b+1 != 11 {
+			t.Errorf("divider at %d: panes of %d and %d columns", pos, a, b)
+		}
+	}
+	for _, ratio := range []float64{0, 1} {
+		l.Ratio = ratio
+		l.Arrange(Rect{Rows: 4, Cols: 5})
+		if a, b := p1.view.Cols, p2.view.Cols; a != minPaneCols || b != minPaneCols {
+			t.Errorf("ratio %g: panes of %d and %d columns", ratio, a, b)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import "unicode/utf8"
+
+// parserState описывает состояние конечного автомата разбора escape-последовательностей.
+type parserState int
+
+const (
+	stateGround             parserState = iota // Обычный текст
+	stateEscape                                // Получен ESC
+	stateEscapeIntermediate                    // ESC с промежуточными байтами
+	stateCSIEntry                              // Получен CSI (ESC [)
+	stateCSIParam                              // Параметры CSI
+	stateCSIIntermediate                       // Промежуточные байты CSI
+	stateCSIIgnore                             // Некорректная CSI-последовательность
+	stateOSCString                             // Строка OSC (ESC ])
+	stateStringIgnore                          // Строки DCS/SOS/PM/APC, которые мы пропускаем
+)
+
+const (
+	maxParams    = 32      // Максимальное число параметров CSI
+	maxOSCLength = 1 << 20 // Максимальная длина строки OSC
+)
+
+// parserHandler получает разобранные действия от Parser.
+type parserHandler interface {
+	print(r rune)
+	execute(b byte)
+	escDispatch(intermediates []byte, final byte)
+	csiDispatch(private byte, params []int, intermediates []byte, final byte)
+	oscDispatch(data []byte)
+}
+
+// Parser разбирает поток байтов от дочернего процесса на печатаемые символы,
+// управляющие символы и escape-последовательности (по мотивам автомата DEC VT500).
+type Parser struct {
+	handler       parserHandler
+	state         parserState
+	private       byte   // Приватный маркер CSI ('?', '>', '<', '=')
+	params        []int  // Параметры CSI
+	param         int    // Текущий накапливаемый параметр
+	hasParam      bool   // Был ли начат текущий параметр
+	intermediates []byte // Промежуточные байты
+	osc           []byte // Накопленная строка OSC
+	utf8Buf       [utf8.UTFMax]byte
+	utf8Len       int
+}
+
+// NewParser создает новый парсер, передающий действия обработчику.
+func NewParser(handler parserHandler) *Parser {
+	return &Parser{
+		handler: handler,
+		params:  make([]int, 0, maxParams),
+	}
+}
+
+// Feed разбирает очередную порцию байтов.
+func (p *Parser) Feed(data []byte) {
+	for _, b := range data {
+		p.feedByte(b)
+	}
+}
+
+func (p *Parser) feedByte(b byte) {
+	// Недописанный многобайтовый UTF-8 символ в обычном тексте
+	if p.utf8Len > 0 {
+		if b&0xC0 == 0x80 {
+			p.utf8Buf[p.utf8Len] = b
+			p.utf8Len++
+			if utf8.FullRune(p.utf8Buf[:p.utf8Len]) {
+				r, _ := utf8.DecodeRune(p.utf8Buf[:p.utf8Len])
+				p.utf8Len = 0
+				p.handler.print(r)
+			}
+			return
+		}
+		// Оборванная последовательность
+		p.utf8Len = 0
+		p.handler.print(utf8.RuneError)
+	}
+
+	// Переходы, действующие из любого состояния
+	switch b {
+	case 0x18, 0x1A: // CAN, SUB
+		p.state = stateGround
+		return
+	case 0x1B: // ESC
+		switch p.state {
+		case stateOSCString:
+			p.handler.oscDispatch(p.osc)
+		}
+		p.clear()
+		p.state = stateEscape
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b < 0x7F:
+			p.handler.print(rune(b))
+		case b == 0x7F:
+			// DEL игнорируется
+		case b >= 0xC0 && b < 0xF8:
+			p.utf8Buf[0] = b
+			p.utf8Len = 1
+		default:
+			p.handler.print(utf8.RuneError)
+		}
+
+	case stateEscape:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b < 0x30:
+			p.intermediates = append(p.intermediates, b)
+			p.state = stateEscapeIntermediate
+		case b == '[':
+			p.state = stateCSIEntry
+		case b == ']':
+			p.osc = p.osc[:0]
+			p.state = stateOSCString
+		case b == 'P' || b == 'X' || b == '^' || b == '_':
+			p.state = stateStringIgnore
+		case b < 0x7F:
+			p.handler.escDispatch(p.intermediates, b)
+			p.state = stateGround
+		}
+
+	case stateEscapeIntermediate:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b < 0x30:
+			p.intermediates = append(p.intermediates, b)
+		case b < 0x7F:
+			p.handler.escDispatch(p.intermediates, b)
+			p.state = stateGround
+		}
+
+	case stateCSIEntry, stateCSIParam:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b >= '0' && b <= '9':
+			p.param = p.param*10 + int(b-'0')
+			if p.param > 65535 {
+				p.param = 65535
+			}
+			p.hasParam = true
+			p.state = stateCSIParam
+		case b == ';' || b == ':':
+			p.pushParam()
+			p.state = stateCSIParam
+		case b >= '<' && b <= '?':
+			if p.state != stateCSIEntry {
+				p.state = stateCSIIgnore
+				return
+			}
+			p.private = b
+			p.state = stateCSIParam
+		case b < 0x30:
+			p.intermediates = append(p.intermediates, b)
+			p.state = stateCSIIntermediate
+		case b >= 0x40 && b < 0x7F:
+			p.dispatchCSI(b)
+		}
+
+	case stateCSIIntermediate:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b < 0x30:
+			p.intermediates = append(p.intermediates, b)
+		case b < 0x40:
+			p.state = stateCSIIgnore
+		case b < 0x7F:
+			p.dispatchCSI(b)
+		}
+
+	case stateCSIIgnore:
+		switch {
+		case b < 0x20:
+			p.handler.execute(b)
+		case b >= 0x40 && b < 0x7F:
+			p.state = stateGround
+		}
+
+	case stateOSCString:
+		switch {
+		case b == 0x07: // BEL завершает OSC так же, как ST
+			p.handler.oscDispatch(p.osc)
+			p.state = stateGround
+		case b < 0x20:
+			// Прочие управляющие символы внутри OSC игнорируются
+		case len(p.osc) < maxOSCLength:
+			p.osc = append(p.osc, b)
+		}
+
+	case stateStringIgnore:
+		// Все байты до ST пропускаются
+	}
+}
+
+// pushParam завершает текущий параметр CSI.
+func (p *Parser) pushParam() {
+	if len(p.params) < maxParams {
+		p.params = append(p.params, p.param)
+	}
+	p.param = 0
+	p.hasParam = false
+}
+
+func (p *Parser) dispatchCSI(final byte) {
+	if p.hasParam || len(p.params) > 0 {
+		p.pushParam()
+	}
+	p.handler.csiDispatch(p.private, p.params, p.intermediates, final)
+	p.state = stateGround
+}
+
+// clear сбрасывает накопленные параметры перед новой последовательностью.
+func (p *Parser) clear() {
+	p.private = 0
+	p.params = p.params[:0]
+	p.param = 0
+	p.hasParam = false
+	p.intermediates = p.intermediates[:0]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LineMark - разметка строки по OSC 133: оболочка отмечает начало
+// приглашения, начало вывода команды и код ее завершения.
+type LineMark uint8
+
+const (
+	MarkPrompt  LineMark = 1 << iota // Со строки начинается приглашение (A)
+	MarkOutput                       // Со строки начинается вывод команды (C)
+	MarkSuccess                      // Команда приглашения завершилась с кодом 0 (D)
+	MarkFailure                      // Команда приглашения завершилась с ошибкой (D)
+)
+
+// promptOSC обрабатывает OSC 133 ; kind [; params]. Отметки ставятся на
+// строку курсора, а код завершения D - на строку приглашения, в котором
+// была набрана команда. B (конец приглашения) не нужен для отметок строк
+// и пропускается.
+func (t *Terminal) promptOSC(arg string) {
+	kind, params, _ := strings.Cut(arg, ";")
+	line := &t.lines[t.cursor[0]]
+	switch kind {
+	case "A":
+		// Продолжение многострочной команды (k=s) - не новое приглашение
+		for _, p := range strings.Split(params, ";") {
+			if p == "k=s" || p == "k=c" {
+				return
+			}
+		}
+		line.Mark = line.Mark&^(MarkSuccess|MarkFailure) | MarkPrompt
+	case "C":
+		line.Mark |= MarkOutput
+	case "D":
+		status, _, _ := strings.Cut(params, ";")
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return // Код не передан: команду прервали или ее не было
+		}
+		mark := MarkSuccess
+		if code != 0 {
+			mark = MarkFailure
+		}
+		for i := len(t.history) + t.cursor[0]; i >= 0; i-- {
+			if l := t.lineAt(i); l.Mark&MarkPrompt != 0 {
+				l.Mark = l.Mark&^(MarkSuccess|MarkFailure) | mark
+				break
+			}
+		}
+	}
+}
+
+// ScrollToPrompt прокручивает область просмотра так, чтобы строка
+// предыдущего (dir < 0) или следующего (dir > 0) приглашения оказалась
+// вверху. Возвращает false, если приглашения в этом направлении нет.
+func (t *Terminal) ScrollToPrompt(dir int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.primary != nil {
+		return false // На альтернативном экране работает не оболочка
+	}
+	top := len(t.history) - t.scroll
+	for i := top + dir; i >= 0 && i < len(t.history)+t.rows; i += dir {
+		if t.lineAt(i).Mark&MarkPrompt != 0 {
+			t.scroll = clamp(len(t.history)-i, 0, len(t.history))
+			t.dirty = true
+			return true
+		}
+	}
+	return false
+}
+
+// lastOutput возвращает строки вывода последней команды: от строки с
+// отметкой C до следующего приглашения или до курсора, если команда еще
+// выполняется. Если приглашение началось на той же строке, что и вывод,
+// команда ничего не вывела.
+func (t *Terminal) lastOutput() (SelectionRange, bool) {
+	if t.primary != nil {
+		return SelectionRange{}, false
+	}
+	last := len(t.history) + t.cursor[0]
+	for start := last; start >= 0; start-- {
+		mark := t.lineAt(start).Mark
+		if mark&MarkOutput == 0 {
+			continue
+		}
+		if mark&MarkPrompt != 0 {
+			return SelectionRange{}, false
+		}
+		end := start
+		for end < last && t.lineAt(end+1).Mark&MarkPrompt == 0 {
+			end++
+		}
+		return SelectionRange{Start: Point{Line: start}, End: Point{Line: end, Col: t.cols - 1}}, true
+	}
+	return SelectionRange{}, false
+}
+
+// LastOutput возвращает текст вывода последней команды.
+func (t *Terminal) LastOutput() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.lastOutput()
+	if !ok {
+		return ""
+	}
+	return strings.TrimRight(t.rangeText(r), "\n")
+}
+
+// SelectLastOutput выделяет строки вывода последней команды и прокручивает
+// область просмотра к его началу, если оно не видно.
+func (t *Terminal) SelectLastOutput() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.lastOutput()
+	if !ok {
+		return false
+	}
+	t.sel = Selection{Active: true, Mode: SelectLine, Anchor: r.Start, Head: r.End}
+	if r.Start.Line < len(t.history)-t.scroll {
+		t.scroll = len(t.history) - r.Start.Line
+	}
+	t.dirty = true
+	return true
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// PTY представляет собой псевдотерминал с запущенным в нем дочерним процессом.
+type PTY struct {
+	master   *os.File  // Ведущая сторона псевдотерминала
+	cmd      *exec.Cmd // Дочерний процесс (обычно оболочка)
+	waitOnce sync.Once
+	waitErr  error // Результат завершения дочернего процесса
+}
+
+// winsize соответствует структуре struct winsize из <sys/ioctl.h>.
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// StartPTY открывает новый псевдотерминал и запускает в нем команду в
+// каталоге dir (пустая строка - текущий каталог).
+func StartPTY(name string, args []string, dir string, rows, cols int) (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ptmx: %v", err)
+	}
+
+	// Разблокируем ведомую сторону и узнаем ее номер
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to unlock pty: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to get pty number: %v", err)
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open pty slave: %v", err)
+	}
+	defer slave.Close()
+
+	p := &PTY{master: master}
+	if err := p.Resize(rows, cols); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Dir = dir
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	// Новая сессия с управляющим терминалом на ведомой стороне
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	p.cmd = cmd
+
+	return p, nil
+}
+
+// Read читает вывод дочернего процесса.
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.master.Read(b)
+}
+
+// Write передает ввод дочернему процессу.
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.master.Write(b)
+}
+
+// Resize сообщает дочернему процессу новый размер терминала через TIOCSWINSZ.
+func (p *PTY) Resize(rows, cols int) error {
+	ws := winsize{rows: uint16(rows), cols: uint16(cols)}
+	if err := ioctl(p.master, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return fmt.Errorf("failed to set window size: %v", err)
+	}
+	return nil
+}
+
+// Close закрывает псевдотерминал и дожидается завершения дочернего процесса.
+func (p *PTY) Close() error {
+	err := p.master.Close()
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Signal(syscall.SIGHUP)
+		p.Wait()
+	}
+	return err
+}
+
+// Wait дожидается завершения дочернего процесса. Метод можно вызывать
+// несколько раз и из разных горутин.
+func (p *PTY) Wait() error {
+	p.waitOnce.Do(func() {
+		p.waitErr = p.cmd.Wait()
+	})
+	return p.waitErr
+}
+
+// ForegroundProcess возвращает имя процесса из группы переднего плана
+// терминала или пустую строку, если его не удалось определить.
+func (p *PTY) ForegroundProcess() string {
+	comm, err := os.ReadFile(p.foregroundProc() + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// ForegroundCwd возвращает рабочий каталог лидера группы переднего плана
+// терминала или пустую строку, если его не удалось определить.
+func (p *PTY) ForegroundCwd() string {
+	cwd, err := os.Readlink(p.foregroundProc() + "/cwd")
+	if err != nil {
+		return ""
+	}
+	return cwd
+}
+
+// foregroundProc возвращает каталог /proc лидера группы переднего плана.
+// Если группу определить не удалось, путь указывает на несуществующий
+// процесс 0.
+func (p *PTY) foregroundProc() string {
+	var pgrp int32
+	if err := ioctl(p.master, syscall.TIOCGPGRP, unsafe.Pointer(&pgrp)); err != nil {
+		pgrp = 0
+	}
+	return "/proc/" + strconv.Itoa(int(pgrp))
+}
+
+// ioctl выполняет ioctl над файлом через SyscallConn: в отличие от Fd() это
+// не переводит дескриптор в блокирующий режим, и Close по-прежнему
+// прерывает чтение в горутине сессии. Аргумент передается указателем, а не
+// uintptr: иначе при росте стека в Control переменная переместится, и ядро
+// запишет результат по старому адресу.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
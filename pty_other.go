@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// PTY на других платформах пока не реализован.
+type PTY struct{}
+
+// StartPTY возвращает ошибку на неподдерживаемых платформах.
+func StartPTY(name string, args []string, dir string, rows, cols int) (*PTY, error) {
+	return nil, fmt.Errorf("pty is not supported on %s", runtime.GOOS)
+}
+
+func (p *PTY) Read(b []byte) (int, error)  { return 0, fmt.Errorf("pty is not supported") }
+func (p *PTY) Write(b []byte) (int, error) { return 0, fmt.Errorf("pty is not supported") }
+func (p *PTY) Resize(rows, cols int) error { return nil }
+func (p *PTY) Close() error                { return nil }
+func (p *PTY) Wait() error                 { return nil }
+func (p *PTY) ForegroundProcess() string   { return "" }
+func (p *PTY) ForegroundCwd() string       { return "" }
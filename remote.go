@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// RemotePTY - программа в сессии сервера bareterm. Read возвращает не вывод
+// программы, а изменения экрана, которые сервер передает управляющими
+// последовательностями; модель терминала окна разбирает их как обычный
+// вывод.
+type RemotePTY struct {
+	ID      int // Номер сессии на сервере
+	conn    net.Conn
+	r       *bufio.Reader
+	pending []byte // Непрочитанная часть изменений экрана
+	exitErr error  // Результат завершения программы, после конца Read
+
+	mu      sync.Mutex
+	process string // Имя процесса переднего плана на сервере
+	cwd     string // Рабочий каталог процесса переднего плана на сервере
+}
+
+// dialRemote отправляет серверу первый запрос соединения conn и ждет номер
+// сессии.
+func dialRemote(conn net.Conn, typ byte, req any) (*RemotePTY, error) {
+	if err := writeJSON(conn, typ, req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	p := &RemotePTY{conn: conn, r: bufio.NewReader(conn)}
+	typ, payload, err := readMessage(p.r)
+	if err == nil {
+		switch typ {
+		case msgHello:
+			err = json.Unmarshal(payload, &p.ID)
+		case msgError:
+			err = errors.New(string(payload))
+		default:
+			err = fmt.Errorf("unexpected message %d", typ)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("server: %v", err)
+	}
+	return p, nil
+}
+
+// remoteSize возвращает размер для сервера, который не принимает терминалы
+// меньше чем в minPaneCols столбцов.
+func remoteSize(rows, cols int) muxSize {
+	return muxSize{max(rows, 1), max(cols, minPaneCols)}
+}
+
+// NewRemoteSession запускает command в новой сессии сервера, подключенного
+// через conn. Пустая команда означает оболочку пользователя.
+func NewRemoteSession(conn net.Conn, rows, cols int, command []string, dir string, wake func()) (*Session, error) {
+	p, err := dialRemote(conn, msgNew, muxNew{muxSize: remoteSize(rows, cols), Command: command, Dir: dir})
+	if err != nil {
+		return nil, err
+	}
+	return newSession(p, rows, cols, wake), nil
+}
+
+// AttachRemoteSession подключается к сессии id сервера, подключенного через
+// conn. Сервер передаст историю прокрутки и экран сессии.
+func AttachRemoteSession(conn net.Conn, id, rows, cols int, wake func()) (*Session, error) {
+	p, err := dialRemote(conn, msgAttach, muxAttach{muxSize: remoteSize(rows, cols), ID: id})
+	if err != nil {
+		return nil, err
+	}
+	return newSession(p, rows, cols, wake), nil
+}
+
+// listRemoteSessions запрашивает у сервера, подключенного через conn,
+// список сессий и закрывает соединение.
+func listRemoteSessions(conn net.Conn) ([]muxSessionInfo, error) {
+	defer conn.Close()
+	if err := writeMessage(conn, msgList, nil); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	typ, payload, err := readMessage(bufio.NewReader(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %v", err)
+	}
+	if typ != msgSessions {
+		return nil, fmt.Errorf("unexpected message %d", typ)
+	}
+	var infos []muxSessionInfo
+	if err := json.Unmarshal(payload, &infos); err != nil {
+		return nil, fmt.Errorf("failed to parse sessions: %v", err)
+	}
+	return infos, nil
+}
+
+// dialServer подключается к серверу bareterm и запускает его в фоне, если
+// он еще не запущен.
+func dialServer() (net.Conn, error) {
+	// В чужом каталоге сокет мог подменить другой пользователь
+	if err := makeSocketDir(); err != nil {
+		return nil, err
+	}
+	path := socketPath()
+	if conn, err := net.Dial("unix", path); err == nil {
+		return conn, nil
+	}
+	if err := startServer(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < 100; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if conn, err := net.Dial("unix", path); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to server at %s", path)
+}
+
+// Read возвращает очередные изменения экрана. После завершения программы
+// возвращается io.EOF.
+func (p *RemotePTY) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		typ, payload, err := readMessage(p.r)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.exitErr = fmt.Errorf("lost connection to server: %v", err)
+			}
+			return 0, err
+		}
+		switch typ {
+		case msgScreen:
+			p.pending = payload
+		case msgProcess:
+			p.mu.Lock()
+			p.process = string(payload)
+			p.mu.Unlock()
+		case msgCwd:
+			p.mu.Lock()
+			p.cwd = string(payload)
+			p.mu.Unlock()
+		case msgExit:
+			if len(payload) > 0 {
+				p.exitErr = errors.New(string(payload))
+			}
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// Write передает ввод программе.
+func (p *RemotePTY) Write(b []byte) (int, error) {
+	if err := writeMessage(p.conn, msgInput, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Resize сообщает серверу новый размер терминала.
+func (p *RemotePTY) Resize(rows, cols int) error {
+	if err := writeJSON(p.conn, msgResize, remoteSize(rows, cols)); err != nil {
+		return fmt.Errorf("failed to resize remote session: %v", err)
+	}
+	return nil
+}
+
+// Close завершает программу на сервере и отключается от сессии.
+func (p *RemotePTY) Close() error {
+	writeMessage(p.conn, msgKill, nil)
+	return p.conn.Close()
+}
+
+// Detach отключается от сессии, не завершая программу.
+func (p *RemotePTY) Detach() error {
+	return p.conn.Close()
+}
+
+// Wait возвращает результат завершения программы. Вызывается после того,
+// как Read вернул ошибку.
+func (p *RemotePTY) Wait() error {
+	return p.exitErr
+}
+
+// ForegroundProcess возвращает имя процесса переднего плана, которое
+// сообщил сервер.
+func (p *RemotePTY) ForegroundProcess() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.process
+}
+
+// ForegroundCwd возвращает рабочий каталог процесса переднего плана,
+// который сообщил сервер.
+func (p *RemotePTY) ForegroundCwd() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cwd
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// SearchMode определяет, как понимается строка поиска.
+type SearchMode int
+
+const (
+	SearchPlain      SearchMode = iota // Точное совпадение
+	SearchIgnoreCase                   // Без учета регистра
+	SearchRegexp                       // Регулярное выражение Go (RE2)
+)
+
+// searchModeNames - подписи режимов в строке поиска.
+var searchModeNames = [...]string{"", "ignore case", "regex"}
+
+// Search - поиск по экрану и истории прокрутки. Строки истории не
+// меняются, поэтому их текст склеивается в логические строки один раз, пока
+// открыт поиск, а при новом выводе ищутся только строки, ушедшие в историю,
+// и экран. Номера строк истории хранятся со сдвигом offset, чтобы
+// отбрасывание старых строк не требовало обхода всех записей.
+type Search struct {
+	Active  bool
+	re      *regexp.Regexp
+	literal string           // Строка поиска без регулярного выражения
+	fold    bool             // literal в нижнем регистре ищется без учета регистра в тексте из ASCII
+	lines   []searchLine     // Текст логических строк истории
+	offset  int              // Строка текста - номер строки в lines и history плюс offset
+	done    int              // Строки истории до done уже есть в lines
+	found   int              // Логические строки до found уже просмотрены
+	history []SelectionRange // Совпадения в истории
+	screen  []SelectionRange // Совпадения на экране и в строках после done
+	current Point            // Текущее совпадение
+	text    []byte           // Буфер текста логической строки
+	lower   []byte           // Буфер текста в нижнем регистре
+	matches [][2]int         // Буфер совпадений в тексте
+	cells   []searchCell     // Ячейки, с которых начинаются символы text
+}
+
+// searchLine - текст логической строки истории без пробелов в конце.
+type searchLine struct {
+	line, end int // Строки [line, end)
+	text      string
+}
+
+// searchCell связывает байт текста логической строки с ячейкой.
+type searchCell struct {
+	offset int
+	point  Point
+}
+
+// compileSearch переводит строку поиска в регулярное выражение.
+func compileSearch(query string, mode SearchMode) (*regexp.Regexp, error) {
+	switch mode {
+	case SearchIgnoreCase:
+		query = "(?i)" + regexp.QuoteMeta(query)
+	case SearchPlain:
+		query = regexp.QuoteMeta(query)
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	return re, nil
+}
+
+// SetSearch ищет query на экране и в истории и показывает ближайшее к низу
+// области просмотра совпадение. Пустая строка убирает совпадения.
+func (t *Terminal) SetSearch(query string, mode SearchMode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Текст истории остается от прошлого поиска
+	s := &t.search
+	*s = Search{
+		Active: true,
+		lines:  s.lines, offset: s.offset, done: s.done,
+		text: s.text, lower: s.lower, matches: s.matches, cells: s.cells,
+	}
+	t.dirty = true
+	if query == "" {
+		return nil
+	}
+	re, err := compileSearch(query, mode)
+	if err != nil {
+		return err
+	}
+	s.re = re
+	switch {
+	case mode == SearchPlain:
+		s.literal = query
+	case mode == SearchIgnoreCase && isASCII(query):
+		s.literal, s.fold = strings.ToLower(query), true
+	}
+	t.updateSearch()
+
+	// Ближайшее совпадение выше нижней строки области просмотра, а если
+	// его нет - первое ниже
+	bottom := Point{Line: len(t.history) - t.scroll + t.rows}
+	i := t.searchIndex(bottom) - 1
+	if i < 0 {
+		i = 0
+	}
+	t.selectMatch(i)
+	return nil
+}
+
+// SearchNext переходит к следующему совпадению: dir < 0 - к более раннему
+// (вверх), dir > 0 - к более позднему. После крайнего совпадения поиск
+// продолжается с другого конца.
+func (t *Terminal) SearchNext(dir int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.updateSearch()
+	n := t.searchCount()
+	if n == 0 {
+		return
+	}
+	cur := t.currentMatch()
+	var i int
+	if dir < 0 {
+		i = t.searchIndex(cur) - 1
+	} else {
+		i = t.searchIndex(Point{cur.Line, cur.Col + 1})
+	}
+	t.selectMatch((i + n) % n)
+}
+
+// ClearSearch выключает поиск, убирает подсветку совпадений и освобождает
+// текст истории.
+func (t *Terminal) ClearSearch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.search.Active {
+		t.search = Search{}
+		t.dirty = true
+	}
+}
+
+// updateSearch дополняет текст истории строками, ушедшими в историю, и ищет
+// совпадения в новых строках истории и на экране. Вызывается под мьютексом.
+func (t *Terminal) updateSearch() {
+	s := &t.search
+	if s.re == nil {
+		return
+	}
+	// Отброшенные строки истории
+	if drop := sort.Search(len(s.lines), func(i int) bool { return s.lines[i].line+s.offset >= 0 }); drop > 0 {
+		clear(s.lines[:drop])
+		s.lines = s.lines[drop:]
+		s.found = max(s.found-drop, 0)
+	}
+	if drop := sort.Search(len(s.history), func(i int) bool { return s.history[i].Start.Line+s.offset >= 0 }); drop > 0 {
+		s.history = s.history[drop:]
+	}
+
+	// Логическая строка попадает в текст, только когда целиком ушла в
+	// историю: ее конец мог еще измениться
+	for s.done < len(t.history) {
+		end := s.done
+		for end < len(t.history) && t.history[end].Wrapped {
+			end++
+		}
+		if end == len(t.history) {
+			break
+		}
+		t.lineText(s.done, end+1, false)
+		text := string(bytes.TrimRight(s.text, " "))
+		s.lines = append(s.lines, searchLine{s.done - s.offset, end + 1 - s.offset, text})
+		s.done = end + 1
+	}
+	for ; s.found < len(s.lines); s.found++ {
+		l := s.lines[s.found]
+		s.history = t.searchText(l.text, l.line+s.offset, l.end+s.offset, -s.offset, s.history)
+	}
+
+	s.screen = s.screen[:0]
+	last := len(t.history) + t.rows
+	line := s.done
+	if t.primary != nil {
+		line = len(t.history) // На альтернативном экране история не видна
+	}
+	for line < last {
+		end := line
+		for end < last-1 && t.lineAt(end).Wrapped {
+			end++
+		}
+		t.lineText(line, end+1, false)
+		s.screen = t.searchText(string(s.text), line, end+1, 0, s.screen)
+		line = end + 1
+	}
+}
+
+// lineText склеивает строки [from, to) текста в s.text, а с cells
+// запоминает в s.cells ячейки символов.
+func (t *Terminal) lineText(from, to int, cells bool) {
+	s := &t.search
+	s.text, s.cells = s.text[:0], s.cells[:0]
+	for line := from; line < to; line++ {
+		for col, c := range t.lineAt(line).Cells {
+			if c.Attr&AttrWideSpacer != 0 {
+				continue
+			}
+			if cells {
+				s.cells = append(s.cells, searchCell{len(s.text), Point{line, col}})
+			}
+			if c.Char == 0 {
+				s.text = append(s.text, ' ')
+			} else {
+				s.text = utf8.AppendRune(s.text, c.Char)
+			}
+		}
+	}
+}
+
+// searchText ищет совпадения в тексте text логической строки из строк
+// [from, to) и добавляет их к dst со сдвигом строк shift.
+func (t *Terminal) searchText(text string, from, to, shift int, dst []SelectionRange) []SelectionRange {
+	s := &t.search
+	ascii := isASCII(text)
+	matches := s.matches[:0]
+	switch {
+	case s.literal != "" && !s.fold:
+		matches = indexAll(text, s.literal, matches)
+	case s.fold && ascii:
+		// Регулярное выражение без учета регистра медленное, а в тексте из
+		// ASCII достаточно сравнить строки в нижнем регистре
+		s.lower = append(s.lower[:0], text...)
+		for i, c := range s.lower {
+			if 'A' <= c && c <= 'Z' {
+				s.lower[i] = c + 'a' - 'A'
+			}
+		}
+		matches = indexAll(string(s.lower), s.literal, matches)
+	default:
+		for _, m := range s.re.FindAllStringIndex(text, -1) {
+			matches = append(matches, [2]int{m[0], m[1]})
+		}
+	}
+	s.matches = matches
+	if len(matches) == 0 {
+		return dst
+	}
+
+	// В тексте из ASCII каждый байт - ячейка, иначе нужна таблица ячеек
+	cellAt := func(offset int) Point {
+		line := from
+		for ; line < to-1 && offset >= len(t.lineAt(line).Cells); line++ {
+			offset -= len(t.lineAt(line).Cells)
+		}
+		return Point{line, offset}
+	}
+	if !ascii {
+		t.lineText(from, to, true)
+		cellAt = func(offset int) Point {
+			i := sort.Search(len(s.cells), func(i int) bool { return s.cells[i].offset > offset })
+			return s.cells[i-1].point
+		}
+	}
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue // Пустое совпадение нечего подсвечивать
+		}
+		start, end := cellAt(m[0]), cellAt(m[1]-1)
+		// Широкий символ подсвечивается целиком
+		if c := t.cellAt(end); c != nil && c.Attr&AttrWide != 0 {
+			end.Col++
+		}
+		start.Line += shift
+		end.Line += shift
+		dst = append(dst, SelectionRange{Start: start, End: end})
+	}
+	return dst
+}
+
+// indexAll добавляет к dst непересекающиеся вхождения sub в text.
+func indexAll(text, sub string, dst [][2]int) [][2]int {
+	for i := 0; ; {
+		j := strings.Index(text[i:], sub)
+		if j < 0 {
+			return dst
+		}
+		dst = append(dst, [2]int{i + j, i + j + len(sub)})
+		i += j + len(sub)
+	}
+}
+
+// isASCII сообщает, состоит ли строка только из символов ASCII.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// searchCount возвращает число совпадений.
+func (t *Terminal) searchCount() int {
+	if t.primary != nil {
+		return len(t.search.screen)
+	}
+	return len(t.search.history) + len(t.search.screen)
+}
+
+// searchMatch возвращает совпадение i в строках текста.
+func (t *Terminal) searchMatch(i int) SelectionRange {
+	s := &t.search
+	if t.primary == nil {
+		if i < len(s.history) {
+			m := s.history[i]
+			m.Start.Line += s.offset
+			m.End.Line += s.offset
+			return m
+		}
+		i -= len(s.history)
+	}
+	return s.screen[i]
+}
+
+// searchIndex возвращает номер первого совпадения, которое начинается не
+// раньше точки p.
+func (t *Terminal) searchIndex(p Point) int {
+	return sort.Search(t.searchCount(), func(i int) bool {
+		return !t.searchMatch(i).Start.before(p)
+	})
+}
+
+// currentMatch возвращает начало текущего совпадения в строках текста.
+func (t *Terminal) currentMatch() Point {
+	return Point{t.search.current.Line + t.search.offset, t.search.current.Col}
+}
+
+// selectMatch делает совпадение i текущим и прокручивает область
+// просмотра так, чтобы оно было видно.
+func (t *Terminal) selectMatch(i int) {
+	if i >= t.searchCount() {
+		return
+	}
+	m := t.searchMatch(i)
+	t.search.current = Point{m.Start.Line - t.search.offset, m.Start.Col}
+	t.dirty = true
+	if t.primary != nil {
+		return
+	}
+	if top := len(t.history) - t.scroll; m.Start.Line < top || m.End.Line >= top+t.rows {
+		t.scroll = clamp(len(t.history)-m.Start.Line+t.rows/2, 0, len(t.history))
+	}
+}
+
+// shiftSearch сдвигает текст и совпадения в истории вслед за строками
+// текста. Текст истории сдвигается и при пустой строке поиска: он
+// пригодится следующему запросу.
+func (t *Terminal) shiftSearch(delta int) {
+	if !t.search.Active {
+		return
+	}
+	t.search.offset += delta
+	t.search.done = max(t.search.done+delta, 0)
+}
+
+// truncateSearch забывает текст и совпадения в истории, начиная со строки
+// line, когда строки истории возвращаются на экран или удаляются.
+func (t *Terminal) truncateSearch(line int) {
+	s := &t.search
+	if !s.Active || s.done <= line {
+		return
+	}
+	n := sort.Search(len(s.lines), func(i int) bool { return s.lines[i].end+s.offset > line })
+	clear(s.lines[n:])
+	s.lines = s.lines[:n]
+	s.found = min(s.found, n)
+	s.done = line
+	if n > 0 {
+		s.done = min(line, s.lines[n-1].end+s.offset)
+	} else {
+		s.done = 0
+	}
+	m := sort.Search(len(s.history), func(i int) bool { return s.history[i].Start.Line+s.offset >= s.done })
+	s.history = s.history[:m]
+}
+
+// snapshotSearch копирует в снимок совпадения, видимые в области
+// просмотра. Вызывается под мьютексом.
+func (t *Terminal) snapshotSearch(dst *Snapshot) {
+	dst.Matches = dst.Matches[:0]
+	dst.MatchIndex, dst.MatchCount = 0, 0
+	if !t.search.Active {
+		return
+	}
+	t.updateSearch()
+	dst.MatchCount = t.searchCount()
+	cur := t.currentMatch()
+	if i := t.searchIndex(cur); i < dst.MatchCount && t.searchMatch(i).Start == cur {
+		dst.MatchIndex = i + 1
+	}
+	bottom := dst.Top + t.rows
+	// Совпадение может начаться выше области просмотра и продолжиться в ней
+	i := max(t.searchIndex(Point{Line: dst.Top - t.rows}), 0)
+	for ; i < dst.MatchCount; i++ {
+		m := t.searchMatch(i)
+		if m.Start.Line >= bottom {
+			break
+		}
+		if m.End.Line >= dst.Top {
+			dst.Matches = append(dst.Matches, m)
+		}
+	}
+	dst.CurrentMatch = cur
+}
+
+// Matched сообщает, попадает ли ячейка видимой области в совпадение поиска
+// и является ли это совпадение текущим. Совпадения не пересекаются и
+// упорядочены, поэтому проверяется только последнее, начавшееся до ячейки.
+func (s *Snapshot) Matched(row, col int) (matched, current bool) {
+	p := Point{s.Top + row, col}
+	i := sort.Search(len(s.Matches), func(i int) bool { return p.before(s.Matches[i].Start) }) - 1
+	if i < 0 || !s.Matches[i].Contains(p.Line, p.Col) {
+		return false, false
+	}
+	return true, s.Matches[i].Start == s.CurrentMatch
+}
+
+// SearchBar - строка ввода поиска внизу панели с фокусом.
+type SearchBar struct {
+	Active bool
+	Query  []rune
+	Mode   SearchMode
+	Err    error     // Ошибка в регулярном выражении
+	term   *Terminal // Терминал, в котором идет поиск
+	dir    int       // Направление поиска / и ? режима vi, 0 - обычный поиск
+}
+
+// Label возвращает текст строки поиска для снимка snap.
+func (b *SearchBar) Label(snap *Snapshot) string {
+	var label string
+	switch b.dir {
+	case 1:
+		label = "/"
+	case -1:
+		label = "?"
+	default:
+		label = "Search: "
+	}
+	if b.Mode != SearchPlain {
+		label = "(" + searchModeNames[b.Mode] + ") " + label
+	}
+	label += string(b.Query)
+	switch {
+	case b.Err != nil:
+		return label + "  [" + b.Err.Error() + "]"
+	case len(b.Query) == 0:
+		return label
+	case snap.MatchCount == 0:
+		return label + "  [no matches]"
+	}
+	return label + fmt.Sprintf("  [%d/%d]", snap.MatchIndex, snap.MatchCount)
+}
+
+// StartSearch открывает строку поиска для панели с фокусом. Строка поиска
+// прежней панели закрывается.
+func (app *App) StartSearch() {
+	term := app.tab().focus.session.term
+	if app.grid.search.Active && app.grid.search.term == term {
+		return
+	}
+	app.closeSearch()
+	app.grid.search = SearchBar{Active: true, term: term}
+	app.grid.needsRedraw = true
+	term.SetSearch("", SearchPlain)
+}
+
+// closeSearch закрывает строку поиска и убирает подсветку совпадений.
+func (app *App) closeSearch() {
+	if app.grid.search.Active {
+		app.grid.search.term.ClearSearch()
+		app.grid.search = SearchBar{}
+		app.grid.needsRedraw = true
+	}
+}
+
+// searchChar добавляет набранный символ к строке поиска.
+func (app *App) searchChar(char rune) {
+	app.grid.search.Query = append(app.grid.search.Query, char)
+	app.updateSearch()
+}
+
+// searchKey обрабатывает клавиши в строке поиска: Enter и стрелка вверх
+// переходят к более раннему совпадению, Shift+Enter и стрелка вниз - к более
+// позднему, Tab меняет режим поиска, Escape закрывает строку поиска. В
+// режиме vi Enter переносит курсор vi на текущее совпадение. Возвращает
+// false для остальных клавиш.
+func (app *App) searchKey(key glfw.Key, mods glfw.ModifierKey) bool {
+	bar := &app.grid.search
+	switch {
+	case key == glfw.KeyEscape:
+		app.closeSearch()
+	case key == glfw.KeyEnter && bar.dir != 0:
+		// В режиме vi Enter переносит курсор на совпадение, а подсветка
+		// остается для n и N
+		bar.term.ViToMatch()
+		app.grid.vi.searchDir = bar.dir
+		*bar = SearchBar{}
+		app.grid.needsRedraw = true
+	case key == glfw.KeyEnter && mods&glfw.ModShift != 0, key == glfw.KeyDown:
+		bar.term.SearchNext(1)
+	case key == glfw.KeyEnter, key == glfw.KeyUp:
+		bar.term.SearchNext(-1)
+	case key == glfw.KeyTab && mods == 0:
+		bar.Mode = (bar.Mode + 1) % SearchMode(len(searchModeNames))
+		app.updateSearch()
+	case key == glfw.KeyBackspace:
+		if len(bar.Query) > 0 {
+			bar.Query = bar.Query[:len(bar.Query)-1]
+			app.updateSearch()
+		}
+	case key == glfw.KeyU && mods == glfw.ModControl:
+		bar.Query = nil
+		app.updateSearch()
+	default:
+		return false
+	}
+	return true
+}
+
+// updateSearch ищет заново после изменения строки или режима поиска.
+func (app *App) updateSearch() {
+	bar := &app.grid.search
+	bar.Err = bar.term.SetSearch(string(bar.Query), bar.Mode)
+	if bar.dir != 0 {
+		bar.term.ViFindMatch(bar.dir)
+	}
+	app.grid.needsRedraw = true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// checkMatches проверяет, что каждое совпадение указывает на текст want.
+func checkMatches(t *testing.T, term *Terminal, want string, count int) {
+	t.Helper()
+	if n := term.searchCount(); n != count {
+		t.Fatalf("%d matches, want %d", n, count)
+	}
+	for i := 0; i < count; i++ {
+		m := term.searchMatch(i)
+		var b strings.Builder
+		for _, c := range term.lineAt(m.Start.Line).Cells[m.Start.Col : m.End.Col+1] {
+			b.WriteRune(c.Char)
+		}
+		if b.String() != want {
+			t.Errorf("match %d at %+v is %q, want %q", i, m.Start, b.String(), want)
+		}
+	}
+}
+
+// Текст истории, оставшийся от прошлого поиска, сдвигается вслед за
+// отброшенными строками, пока строка поиска пуста.
+func TestSearchEmptyQueryKeepsHistory(t *testing.T) {
+	term := NewTerminal(2, 10)
+	term.SetMaxHistory(5)
+	term.Write([]byte("x\r\nfoo\r\nx\r\nx\r\nx\r\nx\r\nx"))
+	if err := term.SetSearch("foo", SearchPlain); err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, term, "foo", 1)
+
+	term.SetSearch("", SearchPlain)
+	term.Write([]byte("\r\ny\r\ny\r\ny"))
+	term.SetSearch("foo", SearchPlain)
+	checkMatches(t, term, "foo", 0)
+	term.SetSearch("x", SearchPlain)
+	checkMatches(t, term, "x", 4)
+
+	// Возврат строк на экран тоже забывает их текст
+	term.SetSearch("", SearchPlain)
+	term.Resize(6, 10)
+	term.Write([]byte("\x1b[H\x1b[J"))
+	term.SetSearch("y", SearchPlain)
+	checkMatches(t, term, "y", 0)
+}
+
+// Поиск по истории в 100 тысяч строк: первый запрос склеивает текст
+// истории, следующие ищут в готовом тексте.
+func BenchmarkSearchHistory(b *testing.B) {
+	const lines = 100000
+	term := NewTerminal(24, 80)
+	term.SetMaxHistory(lines)
+	var out strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&out, "%06d lorem ipsum dolor sit amet, consectetur adipiscing elit\r\n", i)
+	}
+	term.Write([]byte(out.String()))
+
+	b.Run("First", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			term.ClearSearch()
+			term.SetSearch("elit 0", SearchPlain)
+		}
+	})
+	for _, mode := range []SearchMode{SearchPlain, SearchIgnoreCase, SearchRegexp} {
+		b.Run(fmt.Sprintf("Cached%d", mode), func(b *testing.B) {
+			term.SetSearch("x", mode)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				term.SetSearch("099999", mode)
+			}
+		})
+	}
+}
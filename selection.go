@@ -0,0 +1,244 @@
+package main
+
+import "strings"
+
+// defaultWordSeparators - символы, на которых останавливается выделение слова
+// двойным щелчком.
+const defaultWordSeparators = " \t,│`|:\"'()[]{}<>"
+
+// SelectionMode определяет, как выделение расширяется от точки привязки.
+type SelectionMode int
+
+const (
+	SelectChar  SelectionMode = iota // Посимвольное выделение
+	SelectWord                       // Выделение по словам (двойной щелчок)
+	SelectLine                       // Выделение строк (тройной щелчок)
+	SelectBlock                      // Прямоугольное выделение (Alt)
+)
+
+// Point - позиция в тексте терминала. Line отсчитывается от самой старой
+// строки истории прокрутки, поэтому точка не сдвигается при выводе.
+type Point struct {
+	Line, Col int
+}
+
+// before сообщает, предшествует ли точка p точке q.
+func (p Point) before(q Point) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Col < q.Col
+}
+
+// Selection описывает выделенную пользователем область.
+type Selection struct {
+	Active bool
+	Mode   SelectionMode
+	Anchor Point // Точка начала выделения
+	Head   Point // Точка, за которой следует мышь
+}
+
+// SelectionRange - нормализованное выделение, готовое для отрисовки.
+type SelectionRange struct {
+	Start, End Point // Начало и конец включительно (Start не позже End)
+	Block      bool  // Прямоугольное выделение
+}
+
+// Contains сообщает, попадает ли ячейка в выделение.
+func (r *SelectionRange) Contains(line, col int) bool {
+	if line < r.Start.Line || line > r.End.Line {
+		return false
+	}
+	if r.Block {
+		return col >= min(r.Start.Col, r.End.Col) && col <= max(r.Start.Col, r.End.Col)
+	}
+	if line == r.Start.Line && col < r.Start.Col {
+		return false
+	}
+	if line == r.End.Line && col > r.End.Col {
+		return false
+	}
+	return true
+}
+
+// StartSelection начинает новое выделение в ячейке экрана (строка, столбец).
+func (t *Terminal) StartSelection(row, col int, mode SelectionMode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.viewPoint(row, col)
+	t.sel = Selection{Active: true, Mode: mode, Anchor: p, Head: p}
+	t.dirty = true
+}
+
+// UpdateSelection перемещает подвижный конец выделения.
+func (t *Terminal) UpdateSelection(row, col int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.sel.Active {
+		return
+	}
+	t.sel.Head = t.viewPoint(row, col)
+	t.dirty = true
+}
+
+// ExtendSelection расширяет существующее выделение до ячейки (Shift+щелчок):
+// точкой привязки становится дальний от щелчка конец выделения.
+func (t *Terminal) ExtendSelection(row, col int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.sel.Active {
+		return false
+	}
+	p := t.viewPoint(row, col)
+	r, ok := t.selectionRange()
+	if ok {
+		if p.before(r.Start) {
+			t.sel.Anchor = r.End
+		} else if r.End.before(p) {
+			t.sel.Anchor = r.Start
+		}
+	}
+	t.sel.Head = p
+	t.dirty = true
+	return true
+}
+
+// ClearSelection снимает выделение.
+func (t *Terminal) ClearSelection() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sel.Active {
+		t.sel = Selection{}
+		t.dirty = true
+	}
+}
+
+// viewPoint переводит ячейку видимой области в точку текста.
+func (t *Terminal) viewPoint(row, col int) Point {
+	return Point{Line: len(t.history) - t.scroll + row, Col: col}
+}
+
+// lineAt возвращает строку истории или экрана по абсолютному номеру.
+func (t *Terminal) lineAt(line int) *Line {
+	switch {
+	case line < 0:
+		return nil
+	case line < len(t.history):
+		return &t.history[line]
+	case line-len(t.history) < len(t.lines):
+		return &t.lines[line-len(t.history)]
+	}
+	return nil
+}
+
+// selectionRange нормализует выделение с учетом режима: упорядочивает концы
+// и расширяет их до границ слов или строк.
+func (t *Terminal) selectionRange() (SelectionRange, bool) {
+	if !t.sel.Active {
+		return SelectionRange{}, false
+	}
+	start, end := t.sel.Anchor, t.sel.Head
+	if end.before(start) {
+		start, end = end, start
+	}
+
+	switch t.sel.Mode {
+	case SelectChar:
+		if start == end && !t.vi.Active {
+			return SelectionRange{}, false // Простой щелчок ничего не выделяет
+		}
+	case SelectWord:
+		start = t.wordStart(start)
+		end = t.wordEnd(end)
+	case SelectLine:
+		for l := t.lineAt(start.Line - 1); l != nil && l.Wrapped; l = t.lineAt(start.Line - 1) {
+			start.Line--
+		}
+		for l := t.lineAt(end.Line); l != nil && l.Wrapped; l = t.lineAt(end.Line) {
+			end.Line++
+		}
+		start.Col, end.Col = 0, t.cols-1
+	case SelectBlock:
+		return SelectionRange{Start: start, End: end, Block: true}, true
+	}
+
+	// Широкий символ выделяется целиком
+	if c := t.cellAt(start); c != nil && c.Attr&AttrWideSpacer != 0 && start.Col > 0 {
+		start.Col--
+	}
+	if c := t.cellAt(end); c != nil && c.Attr&AttrWide != 0 {
+		end.Col++
+	}
+	return SelectionRange{Start: start, End: end}, true
+}
+
+// cellAt возвращает ячейку в точке текста.
+func (t *Terminal) cellAt(p Point) *Cell {
+	l := t.lineAt(p.Line)
+	if l == nil || p.Col < 0 || p.Col >= len(l.Cells) {
+		return nil
+	}
+	return &l.Cells[p.Col]
+}
+
+// SetWordSeparators задает символы, на которых останавливается выделение
+// слова.
+func (t *Terminal) SetWordSeparators(separators string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.wordSeparators = separators
+}
+
+// isWordCell сообщает, относится ли ячейка к слову.
+func (t *Terminal) isWordCell(p Point) bool {
+	c := t.cellAt(p)
+	if c == nil {
+		return false
+	}
+	if c.Attr&AttrWideSpacer != 0 {
+		return true
+	}
+	return c.Char != 0 && !strings.ContainsRune(t.wordSeparators, c.Char)
+}
+
+// wordStart находит начало слова, переходя через мягкие переносы строк.
+func (t *Terminal) wordStart(p Point) Point {
+	if !t.isWordCell(p) {
+		return p
+	}
+	for {
+		prev := Point{p.Line, p.Col - 1}
+		if prev.Col < 0 {
+			l := t.lineAt(p.Line - 1)
+			if l == nil || !l.Wrapped {
+				return p
+			}
+			prev = Point{p.Line - 1, len(l.Cells) - 1}
+		}
+		if !t.isWordCell(prev) {
+			return p
+		}
+		p = prev
+	}
+}
+
+// wordEnd находит конец слова, переходя через мягкие переносы строк.
+func (t *Terminal) wordEnd(p Point) Point {
+	if !t.isWordCell(p) {
+		return p
+	}
+	for {
+		next := Point{p.Line, p.Col + 1}
+		if l := t.lineAt(p.Line); next.Col >= len(l.Cells) {
+			if !l.Wrapped {
+				return p
+			}
+			next = Point{p.Line + 1, 0}
+		}
+		if !t.isWordCell(next) {
+			return p
+		}
+		p = next
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// serverWriteTimeout ограничивает ожидание записи клиенту: окно, которое
+// перестало читать, отключается и не задерживает остальных.
+const serverWriteTimeout = 10 * time.Second
+
+// Server - сервер сессий bareterm. Он держит псевдотерминалы и модели
+// терминалов, а окна подключаются к сессиям через сокет и отключаются от них.
+// Закрытие окна не завершает программы, и к ним можно подключиться снова.
+// Размер терминала сессии задает клиент, последним сообщивший свой размер.
+type Server struct {
+	mu       sync.Mutex
+	sessions map[int]*serverSession
+	nextID   int
+	history  int           // Размер истории прокрутки сессий
+	empty    chan struct{} // Закрывается, когда завершилась последняя сессия
+}
+
+// serverSession - сессия сервера и подключенные к ней клиенты.
+type serverSession struct {
+	id      int
+	session *Session
+	changed chan struct{} // Сигнал об изменении модели терминала
+	mu      sync.Mutex    // Защищает clients и запись в их соединения
+	clients map[*serverClient]bool
+	process string // Имя процесса переднего плана, отправленное клиентам
+	cwd     string // Каталог процесса переднего плана, отправленный клиентам
+}
+
+// serverClient - окно, подключенное к сессии. У каждого клиента свой
+// кодировщик, потому что клиенты подключаются в разное время.
+type serverClient struct {
+	conn net.Conn
+	enc  screenEncoder
+}
+
+// NewServer создает сервер без сессий. history - размер истории прокрутки
+// каждой сессии.
+func NewServer(history int) *Server {
+	return &Server{
+		sessions: make(map[int]*serverSession),
+		nextID:   1,
+		history:  history,
+		empty:    make(chan struct{}),
+	}
+}
+
+// runServer запускает сервер на сокете socketPath и обслуживает клиентов,
+// пока не завершится последняя сессия.
+func runServer(cfg Config) error {
+	path := socketPath()
+	if err := makeSocketDir(); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("server is already running at %s", path)
+	}
+	// Сокет мог остаться от сервера, завершившегося аварийно
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	// Сессии сервера не принадлежат окну, запустившему сервер
+	os.Unsetenv(controlSocketEnv)
+	return NewServer(cfg.Scrollback).Serve(l)
+}
+
+// Serve принимает соединения, пока не завершится последняя сессия.
+func (srv *Server) Serve(l net.Listener) error {
+	go func() {
+		<-srv.empty
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-srv.empty:
+				return nil
+			default:
+				return fmt.Errorf("failed to accept connection: %v", err)
+			}
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// ServeConn обслуживает соединение одного клиента. Клиента можно подключить
+// и в том же процессе, например через net.Pipe.
+func (srv *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	typ, payload, err := readMessage(r)
+	if err != nil {
+		return
+	}
+
+	var ss *serverSession
+	var size muxSize
+	switch typ {
+	case msgList:
+		writeJSON(conn, msgSessions, srv.list())
+		return
+	case msgNew:
+		var req muxNew
+		if err = json.Unmarshal(payload, &req); err == nil {
+			ss, err = srv.start(req)
+			size = req.muxSize
+		}
+	case msgAttach:
+		var req muxAttach
+		if err = json.Unmarshal(payload, &req); err == nil {
+			if ss = srv.session(req.ID); ss == nil {
+				err = fmt.Errorf("session %d not found", req.ID)
+			}
+			size = req.muxSize
+		}
+	default:
+		err = fmt.Errorf("unexpected message %d", typ)
+	}
+	if err == nil && !validSize(size) {
+		err = fmt.Errorf("invalid terminal size %dx%d", size.Cols, size.Rows)
+	}
+	if err != nil {
+		writeMessage(conn, msgError, []byte(err.Error()))
+		return
+	}
+
+	client := &serverClient{conn: conn}
+	if !ss.attach(client, size) {
+		writeMessage(conn, msgError, []byte(fmt.Sprintf("session %d has exited", ss.id)))
+		return
+	}
+	defer ss.detach(client)
+
+	for {
+		typ, payload, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case msgInput:
+			ss.session.Write(payload)
+		case msgResize:
+			if json.Unmarshal(payload, &size) == nil && validSize(size) {
+				ss.resize(size)
+			}
+		case msgKill:
+			ss.session.Close()
+		}
+	}
+}
+
+// validSize проверяет размер терминала от клиента.
+func validSize(size muxSize) bool {
+	return size.Rows > 0 && size.Cols >= minPaneCols && size.Rows <= 1000 && size.Cols <= 1000
+}
+
+// start запускает программу в новой сессии.
+func (srv *Server) start(req muxNew) (*serverSession, error) {
+	if !validSize(req.muxSize) {
+		return nil, fmt.Errorf("invalid terminal size %dx%d", req.Cols, req.Rows)
+	}
+	ss := &serverSession{
+		changed: make(chan struct{}, 1),
+		clients: make(map[*serverClient]bool),
+	}
+	session, err := NewSession(req.Rows, req.Cols, req.Command, req.Dir, ss.notify)
+	if err != nil {
+		return nil, err
+	}
+	session.term.SetMaxHistory(srv.history)
+	// Права доступа к буферу обмена проверяет модель терминала клиента
+	session.term.SetClipboardPolicy(ClipboardPolicy{
+		Read:    ClipboardAllow,
+		Write:   ClipboardAllow,
+		MaxSize: maxClipboardSize,
+	})
+	// На запросы цветов отвечает клиент: у него цвета темы пользователя
+	session.term.SetForwardColorQueries(true)
+	ss.session = session
+
+	srv.mu.Lock()
+	ss.id = srv.nextID
+	srv.nextID++
+	srv.sessions[ss.id] = ss
+	srv.mu.Unlock()
+
+	go srv.run(ss)
+	return ss, nil
+}
+
+// session возвращает сессию с номером id или nil.
+func (srv *Server) session(id int) *serverSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.sessions[id]
+}
+
+// list описывает сессии сервера по возрастанию номеров.
+func (srv *Server) list() []muxSessionInfo {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	infos := make([]muxSessionInfo, 0, len(srv.sessions))
+	for _, ss := range srv.sessions {
+		ss.mu.Lock()
+		infos = append(infos, muxSessionInfo{ID: ss.id, Title: ss.session.Title(), Clients: len(ss.clients)})
+		ss.mu.Unlock()
+	}
+	slices.SortFunc(infos, func(a, b muxSessionInfo) int { return a.ID - b.ID })
+	return infos
+}
+
+// run рассылает клиентам изменения экрана сессии, а после завершения
+// программы сообщает о нем и удаляет сессию.
+func (srv *Server) run(ss *serverSession) {
+	for {
+		select {
+		case <-ss.changed:
+			ss.flush()
+		case <-ss.session.Done():
+			ss.flush()
+			ss.exit()
+			srv.mu.Lock()
+			delete(srv.sessions, ss.id)
+			if len(srv.sessions) == 0 {
+				close(srv.empty)
+			}
+			srv.mu.Unlock()
+			return
+		}
+	}
+}
+
+// notify сообщает горутине рассылки, что модель терминала изменилась.
+func (ss *serverSession) notify() {
+	select {
+	case ss.changed <- struct{}{}:
+	default:
+	}
+}
+
+// flush отправляет всем клиентам изменения экрана, звонок, запросы к буферу
+// обмена, уведомления, имя и каталог процесса переднего плана.
+func (ss *serverSession) flush() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	_, bell := ss.session.term.TakeAlerts()
+	term := ss.session.term
+	var queries []string
+	if len(ss.clients) > 0 {
+		// Запросы цветов ждут клиента, который на них ответит
+		queries = term.TakeColorQueries()
+	}
+	alerts := muxAlerts(bell, term.TakeClipboardRequests(), term.TakeNotifications(), queries)
+	process, cwd := ss.session.Foreground()
+	changed := process != ss.process || cwd != ss.cwd
+	ss.process, ss.cwd = process, cwd
+	for c := range ss.clients {
+		ss.update(c, alerts, changed)
+	}
+}
+
+// update отправляет клиенту c кадр изменений экрана. Клиент, запись к
+// которому не удалась, отключается. Вызывается под мьютексом сессии.
+func (ss *serverSession) update(c *serverClient, alerts []byte, process bool) {
+	c.conn.SetWriteDeadline(time.Now().Add(serverWriteTimeout))
+	var err error
+	if process {
+		err = writeMessage(c.conn, msgProcess, []byte(ss.process))
+		if err == nil {
+			err = writeMessage(c.conn, msgCwd, []byte(ss.cwd))
+		}
+	}
+	if frame := c.enc.Frame(ss.session.term); err == nil && (frame != nil || len(alerts) > 0) {
+		err = writeMessage(c.conn, msgScreen, append(frame, alerts...))
+	}
+	if err != nil {
+		log.Printf("failed to update client of session %d: %v", ss.id, err)
+		c.conn.Close()
+		delete(ss.clients, c)
+	}
+}
+
+// attach подключает клиента к сессии с размером терминала size и отправляет
+// ему номер сессии, историю и экран. Возвращает false, если программа уже
+// завершилась.
+func (ss *serverSession) attach(c *serverClient, size muxSize) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	select {
+	case <-ss.session.Done():
+		return false
+	default:
+	}
+	if err := ss.session.Resize(size.Rows, size.Cols); err != nil {
+		log.Println(err)
+	}
+	ss.notify() // Остальные клиенты получат экран нового размера
+	if err := writeJSON(c.conn, msgHello, ss.id); err != nil {
+		return false
+	}
+	ss.clients[c] = true
+	ss.update(c, nil, true)
+	return true
+}
+
+// detach отключает клиента от сессии. Программа продолжает работать.
+func (ss *serverSession) detach(c *serverClient) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.clients, c)
+}
+
+// resize меняет размер терминала сессии по запросу клиента.
+func (ss *serverSession) resize(size muxSize) {
+	if err := ss.session.Resize(size.Rows, size.Cols); err != nil {
+		log.Println(err)
+	}
+	ss.notify()
+}
+
+// exit сообщает клиентам о завершении программы и отключает их.
+func (ss *serverSession) exit() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var msg string
+	if ss.session.exitErr != nil {
+		msg = ss.session.exitErr.Error()
+	}
+	for c := range ss.clients {
+		c.conn.SetWriteDeadline(time.Now().Add(serverWriteTimeout))
+		writeMessage(c.conn, msgExit, []byte(msg))
+		c.conn.Close()
+		delete(ss.clients, c)
+	}
+}
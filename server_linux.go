@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// checkSocketDir проверяет, что каталог сокетов принадлежит пользователю и
+// закрыт для остальных. Каталог в /tmp мог заранее создать другой
+// пользователь, чтобы подменить сокет и получать ввод из окон.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %v", err)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(st.Uid) != os.Getuid() || info.Mode().Perm() != 0o700 {
+		return fmt.Errorf("socket directory %s must be a directory owned by the user with mode 0700", dir)
+	}
+	return nil
+}
+
+// startServer запускает сервер bareterm в фоне, в отдельной сессии, чтобы он
+// пережил закрытие окна и терминала, из которого запущен bareterm.
+func startServer() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %v", err)
+	}
+	cmd := exec.Command(exe, "--server")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start server: %v", err)
+	}
+	go cmd.Wait()
+	return nil
+}
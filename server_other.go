@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// startServer возвращает ошибку на неподдерживаемых платформах.
+func startServer() error {
+	return fmt.Errorf("server is not supported on %s", runtime.GOOS)
+}
+
+// checkSocketDir проверяет, что каталог сокетов закрыт для остальных
+// пользователей. Владельца на этих платформах не проверить.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %v", err)
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0o700 {
+		return fmt.Errorf("socket directory %s must be a directory with mode 0700", dir)
+	}
+	return nil
+}
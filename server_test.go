@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient - окно, подключенное к серверу в том же процессе через
+// net.Pipe. Кадры экрана применяются к своей модели терминала, как в
+// RemotePTY.
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	term *Terminal
+	id   int
+}
+
+// testProgram выводит ready, а на каждую строку ввода - ее и размер
+// терминала.
+var testProgram = []string{"sh", "-c", `echo ready; while read l; do echo "got $l"; stty size; done`}
+
+// newTestServer создает сервер и завершает его сессии в конце теста.
+func newTestServer(t *testing.T) *Server {
+	srv := NewServer(100)
+	t.Cleanup(func() {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		for _, ss := range srv.sessions {
+			ss.session.Close()
+		}
+	})
+	return srv
+}
+
+// dialTestServer подключает клиента запросом typ и ждет номер сессии.
+func dialTestServer(t *testing.T, srv *Server, typ byte, req any, size muxSize) *testClient {
+	t.Helper()
+	conn, server := net.Pipe()
+	go srv.ServeConn(server)
+	c := &testClient{conn: conn, r: bufio.NewReader(conn), term: NewTerminal(size.Rows, size.Cols)}
+	t.Cleanup(func() { conn.Close() })
+	c.send(t, typ, req)
+	typ, payload := c.read(t)
+	if typ != msgHello {
+		t.Fatalf("got message %d (%q), want hello", typ, payload)
+	}
+	if err := json.Unmarshal(payload, &c.id); err != nil {
+		t.Fatalf("failed to parse hello: %v", err)
+	}
+	return c
+}
+
+func (c *testClient) send(t *testing.T, typ byte, v any) {
+	t.Helper()
+	var err error
+	if data, ok := v.(string); ok {
+		err = writeMessage(c.conn, typ, []byte(data))
+	} else {
+		err = writeJSON(c.conn, typ, v)
+	}
+	if err != nil {
+		t.Fatalf("failed to send message %d: %v", typ, err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, payload, err := readMessage(c.r)
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return typ, payload
+}
+
+// waitFor применяет кадры экрана, пока на экране клиента не появится text,
+// и возвращает полученные кадры.
+func (c *testClient) waitFor(t *testing.T, text string) []string {
+	t.Helper()
+	var frames []string
+	for !strings.Contains(c.term.Text(false), text) {
+		typ, payload := c.read(t)
+		switch typ {
+		case msgScreen:
+			c.term.Write(payload)
+			frames = append(frames, string(payload))
+		case msgExit, msgError:
+			t.Fatalf("got message %d (%q) waiting for %q", typ, payload, text)
+		}
+	}
+	return frames
+}
+
+func TestServerFirstFrame(t *testing.T) {
+	srv := newTestServer(t)
+	size := muxSize{Rows: 5, Cols: 20}
+	c := dialTestServer(t, srv, msgNew, muxNew{muxSize: size, Command: testProgram}, size)
+	if c.id != 1 {
+		t.Errorf("session id = %d, want 1", c.id)
+	}
+	frames := c.waitFor(t, "ready")
+	// Первый кадр передает состояние целиком, в том числе заголовок и режимы
+	if !strings.Contains(frames[0], "\x1b]2;") || !strings.Contains(frames[0], "\x1b[?2004l") {
+		t.Errorf("first frame %q does not carry the full state", frames[0])
+	}
+}
+
+func TestServerIncrementalFrame(t *testing.T) {
+	srv := newTestServer(t)
+	size := muxSize{Rows: 5, Cols: 20}
+	c := dialTestServer(t, srv, msgNew, muxNew{muxSize: size, Command: testProgram}, size)
+	c.waitFor(t, "ready")
+
+	c.send(t, msgInput, "abc\r")
+	for _, frame := range c.waitFor(t, "5 20") {
+		// Неизмененная первая строка и заголовок повторно не передаются
+		if strings.Contains(frame, "\x1b[1H") || strings.Contains(frame, "\x1b]2;") {
+			t.Errorf("incremental frame %q repaints unchanged state", frame)
+		}
+	}
+	if text := c.term.Text(false); !strings.HasPrefix(text, "ready\nabc\ngot abc\n5 20") {
+		t.Errorf("client screen = %q", text)
+	}
+}
+
+func TestServerResize(t *testing.T) {
+	srv := newTestServer(t)
+	size := muxSize{Rows: 5, Cols: 20}
+	c := dialTestServer(t, srv, msgNew, muxNew{muxSize: size, Command: testProgram}, size)
+	c.waitFor(t, "ready")
+
+	c.term.Resize(8, 30)
+	c.send(t, msgResize, muxSize{Rows: 8, Cols: 30})
+	c.send(t, msgInput, "x\r")
+	c.waitFor(t, "8 30")
+	if text := c.term.Text(false); !strings.HasPrefix(text, "ready\nx\ngot x\n8 30") {
+		t.Errorf("client screen after resize = %q", text)
+	}
+}
+
+func TestServerReattach(t *testing.T) {
+	srv := newTestServer(t)
+	size := muxSize{Rows: 3, Cols: 20}
+	c := dialTestServer(t, srv, msgNew, muxNew{muxSize: size, Command: testProgram}, size)
+	c.waitFor(t, "ready")
+	c.send(t, msgInput, "one\r")
+	c.waitFor(t, "3 20")
+	c.conn.Close()
+
+	// Новый клиент получает историю, ушедшую с экрана, и сам экран
+	c = dialTestServer(t, srv, msgAttach, muxAttach{muxSize: size, ID: c.id}, size)
+	c.waitFor(t, "3 20")
+	if text := c.term.Text(true); !strings.HasPrefix(text, "ready\none\ngot one\n3 20") {
+		t.Errorf("replayed screen = %q", text)
+	}
+	c.send(t, msgInput, "two\r")
+	c.waitFor(t, "got two")
+
+	// Первый клиент отключается, когда сервер заметит закрытие соединения
+	deadline := time.Now().Add(5 * time.Second)
+	infos := srv.list()
+	for (len(infos) != 1 || infos[0].Clients != 1) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		infos = srv.list()
+	}
+	if len(infos) != 1 || infos[0].ID != c.id || infos[0].Clients != 1 {
+		t.Errorf("sessions = %+v, want one session with one client", infos)
+	}
+}
+
+// clientInput передает ответы модели терминала клиента серверу как ввод.
+type clientInput struct{ conn net.Conn }
+
+func (w clientInput) Write(p []byte) (int, error) {
+	if err := writeMessage(w.conn, msgInput, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Цвета, заданные программой, передаются клиенту, а на запросы цветов
+// отвечает клиент своими цветами.
+func TestServerPalette(t *testing.T) {
+	srv := newTestServer(t)
+	size := muxSize{Rows: 5, Cols: 60}
+	program := []string{"sh", "-c", `stty -echo -icanon
+		printf 'ready\n\033]4;1;#102030\033\\\033]11;?\033\\'
+		r=$(dd bs=1 count=25 2>/dev/null)
+		printf '%s\n' "$r" | tr '\033' E
+		read l
+		printf '\033]104;1\033\\'
+		echo done; read l`}
+	c := dialTestServer(t, srv, msgNew, muxNew{muxSize: size, Command: program}, size)
+	c.term.out = clientInput{c.conn}
+	theme := defaultPalette()
+	theme.Foreground, theme.Background = RGBColor(0x20, 0x20, 0x20), RGBColor(0xEE, 0xEE, 0xEE)
+	c.term.SetDefaultPalette(theme)
+
+	palette := func() Palette {
+		c.term.mu.Lock()
+		defer c.term.mu.Unlock()
+		return c.term.palette
+	}
+
+	// Ответ клиента приходит после кадра с цветом, заданным раньше запроса
+	c.waitFor(t, "E]11;")
+	if text := c.term.Text(false); !strings.Contains(text, "E]11;rgb:eeee/eeee/eeee") {
+		t.Errorf("program got reply %q, want the client background", text)
+	}
+	if got, want := palette().Colors[1], RGBColor(0x10, 0x20, 0x30); got != want {
+		t.Errorf("color 1 = %06x, want %06x", got, want)
+	}
+	if got := palette().Background; got != theme.Background {
+		t.Errorf("background = %06x, want the client theme", got)
+	}
+
+	c.send(t, msgInput, "\n")
+	c.waitFor(t, "done")
+	if got := palette().Colors[1]; got != theme.Colors[1] {
+		t.Errorf("color 1 = %06x after reset, want %06x", got, theme.Colors[1])
+	}
+}
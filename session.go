@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// foregroundRefresh - как часто при выводе обновляются имя и каталог
+// процесса переднего плана. Они нужны заголовку в каждом кадре, а их
+// чтение - системные вызовы и чтение /proc.
+const foregroundRefresh = 200 * time.Millisecond
+
+// Process - программа, с которой связана сессия: в локальном псевдотерминале
+// (PTY) или в сессии сервера bareterm (RemotePTY).
+type Process interface {
+	io.ReadWriter
+	Resize(rows, cols int) error
+	Close() error
+	Wait() error
+	ForegroundProcess() string
+	ForegroundCwd() string
+}
+
+// Session связывает псевдотерминал с моделью терминала. Чтение и разбор
+// вывода дочернего процесса выполняются в отдельной горутине, чтобы большие
+// объемы вывода не блокировали главный поток с GLFW и OpenGL.
+type Session struct {
+	pty          Process
+	term         *Terminal
+	wake         func()        // Будит главный поток после изменения модели
+	done         chan struct{} // Закрывается, когда дочерний процесс завершился
+	exitErr      error         // Результат завершения процесса, после done
+	defaultTitle string        // Заголовок, пока программа не задала свой
+	syncTimer    *time.Timer   // Будит главный поток в конце синхронизации
+
+	mu              sync.Mutex  // Защищает сведения о процессе переднего плана
+	process, cwd    string      // Имя и каталог процесса переднего плана
+	foregroundAt    time.Time   // Когда они были прочитаны
+	foregroundTimer *time.Timer // Обновит их, если вывод прекратится
+}
+
+// NewSession запускает команду в новом псевдотерминале в каталоге dir.
+// Пустая команда означает оболочку пользователя.
+func NewSession(rows, cols int, command []string, dir string, wake func()) (*Session, error) {
+	if len(command) == 0 {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		command = []string{shell}
+	}
+
+	pty, err := StartPTY(command[0], command[1:], dir, rows, cols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start shell: %v", err)
+	}
+	return newSession(pty, rows, cols, wake), nil
+}
+
+// newSession связывает запущенную программу с новой моделью терминала и
+// начинает читать ее вывод.
+func newSession(pty Process, rows, cols int, wake func()) *Session {
+	term := NewTerminal(rows, cols)
+	term.out = pty
+
+	s := &Session{
+		pty:  pty,
+		term: term,
+		wake: wake,
+		done: make(chan struct{}),
+	}
+	s.updateForeground()
+	go s.readLoop()
+	return s
+}
+
+// readLoop читает вывод дочернего процесса и передает его модели терминала.
+func (s *Session) readLoop() {
+	defer close(s.done)
+	defer s.notify()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			s.term.Write(buf[:n])
+			s.refreshForeground()
+			if wait := s.term.SyncRemaining(); wait > 0 {
+				// Кадр задержан синхронизированным выводом: разбудим главный
+				// поток по истечении таймаута, даже если вывод прекратится
+				if s.syncTimer == nil {
+					s.syncTimer = time.AfterFunc(wait, s.notify)
+				} else {
+					s.syncTimer.Reset(wait)
+				}
+			} else {
+				s.notify()
+			}
+		}
+		if err != nil {
+			s.exitErr = s.pty.Wait()
+			return
+		}
+	}
+}
+
+// refreshForeground обновляет сведения о процессе переднего плана после
+// вывода, но не чаще раза в foregroundRefresh. Через foregroundRefresh
+// после конца вывода они читаются еще раз: программа могла смениться, ничего
+// не выводя.
+func (s *Session) refreshForeground() {
+	s.mu.Lock()
+	due := time.Since(s.foregroundAt) >= foregroundRefresh
+	if s.foregroundTimer == nil {
+		s.foregroundTimer = time.AfterFunc(foregroundRefresh, func() {
+			s.updateForeground()
+			s.notify()
+		})
+	} else {
+		s.foregroundTimer.Reset(foregroundRefresh)
+	}
+	s.mu.Unlock()
+	if due {
+		s.updateForeground()
+	}
+}
+
+// updateForeground читает имя и каталог процесса переднего плана.
+func (s *Session) updateForeground() {
+	process, cwd := s.pty.ForegroundProcess(), s.pty.ForegroundCwd()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.process, s.cwd = process, cwd
+	s.foregroundAt = time.Now()
+}
+
+// Foreground возвращает имя и рабочий каталог процесса переднего плана,
+// прочитанные при последнем выводе.
+func (s *Session) Foreground() (process, cwd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.process, s.cwd
+}
+
+func (s *Session) notify() {
+	if s.wake != nil {
+		s.wake()
+	}
+}
+
+// Write передает ввод пользователя дочернему процессу.
+func (s *Session) Write(data []byte) (int, error) {
+	return s.pty.Write(data)
+}
+
+// Resize меняет размер терминала и сообщает его дочернему процессу.
+func (s *Session) Resize(rows, cols int) error {
+	s.term.Resize(rows, cols)
+	return s.pty.Resize(rows, cols)
+}
+
+// Done возвращает канал, который закрывается по завершении дочернего процесса.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close завершает дочерний процесс и освобождает псевдотерминал.
+func (s *Session) Close() error {
+	return s.pty.Close()
+}
+
+// Detach отключает окно от программы. Программа в сессии сервера продолжает
+// работать, и к ней можно подключиться снова, а локальная завершается.
+func (s *Session) Detach() error {
+	if remote, ok := s.pty.(*RemotePTY); ok {
+		return remote.Detach()
+	}
+	return s.Close()
+}
+
+// ExitMessage описывает, как завершился дочерний процесс. Вызывается после
+// закрытия канала Done.
+func (s *Session) ExitMessage() string {
+	if s.exitErr != nil {
+		return "process exited: " + s.exitErr.Error()
+	}
+	return "process exited"
+}
+
+// Cwd возвращает рабочий каталог программы: сообщенный через OSC 7, а если
+// программа его не сообщает - каталог процесса переднего плана.
+func (s *Session) Cwd() string {
+	if cwd := s.term.Cwd(); cwd != "" {
+		return cwd
+	}
+	_, cwd := s.Foreground()
+	return cwd
+}
+
+// Title возвращает заголовок окна для сессии: установленный программой
+// через OSC 0/2, а если его нет - заданный при запуске или имя процесса
+// переднего плана.
+func (s *Session) Title() string {
+	if title := s.term.Title(); title != "" {
+		return title
+	}
+	if s.defaultTitle != "" {
+		return s.defaultTitle
+	}
+	if name, _ := s.Foreground(); name != "" {
+		return name
+	}
+	return "bareterm"
+}
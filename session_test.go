@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Имя процесса переднего плана обновляется и после того, как вывод
+// прекратился: sleep ничего не выводит.
+func TestSessionForegroundRefresh(t *testing.T) {
+	s, err := NewSession(5, 20, []string{"sh", "-c", "echo start; exec sleep 10"}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if name, _ := s.Foreground(); name == "sleep" {
+			if title := s.Title(); title != "sleep" {
+				t.Errorf("title = %q, want sleep", title)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	name, _ := s.Foreground()
+	t.Fatalf("foreground process = %q, want sleep", name)
+}
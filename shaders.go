@@ -19,7 +19,8 @@ const vertexShaderSource = `
     
     void main() {
         gl_Position = vec4(cellPosition + aPos * cellSize, 0.0, 1.0);
-        TexCoord = aTexCoord;
+        // Строки изображения глифа идут сверху вниз
+        TexCoord = vec2(aTexCoord.x, 1.0 - aTexCoord.y);
     }
 ` + "\x00"
 
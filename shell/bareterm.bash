@@ -0,0 +1,41 @@
+# Разметка приглашений OSC 133 для bareterm: начало приглашения (A), начало
+# вывода команды (C) и код ее завершения (D), а также рабочий каталог
+# (OSC 7) для новых вкладок и панелей. Подключается в ~/.bashrc:
+#
+#     . /path/to/bareterm/shell/bareterm.bash
+#
+# Начало вывода отмечает PS0, поэтому нужен bash 4.4 или новее.
+
+if [[ $- == *i* && -z $__bareterm_marks ]]; then
+    __bareterm_marks=1
+    __bareterm_output=$'\e]133;C\e\\'
+
+    # Каталог передается как путь URI: байты вне безопасного набора
+    # кодируются как %XX
+    __bareterm_urlencode() {
+        local LC_ALL=C dir=$1 c i
+        REPLY=
+        for (( i = 0; i < ${#dir}; i++ )); do
+            c=${dir:i:1}
+            case $c in
+                [A-Za-z0-9/._~-]) REPLY+=$c ;;
+                *) printf -v c '%%%02X' "'$c"; REPLY+=$c ;;
+            esac
+        done
+    }
+
+    __bareterm_prompt() {
+        local code=$?
+        # Пустая строка не запускает команду, и кода завершения у нее нет
+        [[ -n $__bareterm_running ]] && printf '\e]133;D;%s\e\\' "$code"
+        __bareterm_running=
+        __bareterm_urlencode "$PWD"
+        printf '\e]7;file://%s%s\e\\\e]133;A\e\\' "$HOSTNAME" "$REPLY"
+    }
+
+    # Функция идет первой, пока $? еще хранит код завершения команды
+    PROMPT_COMMAND="__bareterm_prompt${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+    # PS0 выводится перед запуском команды; присваивание запоминает, что
+    # команда запущена, и само выводит отметку C
+    PS0='${__bareterm_running:=$__bareterm_output}'"$PS0"
+fi
@@ -0,0 +1,24 @@
+# Разметка приглашений OSC 133 для bareterm: начало приглашения (A), начало
+# вывода команды (C) и код ее завершения (D), а также рабочий каталог
+# (OSC 7) для новых вкладок и панелей. Подключается в
+# ~/.config/fish/config.fish:
+#
+#     source /path/to/bareterm/shell/bareterm.fish
+
+if status is-interactive; and not set -q __bareterm_marks
+    set -g __bareterm_marks 1
+
+    function __bareterm_prompt --on-event fish_prompt
+        # Каталог передается как путь URI: байты вне безопасного набора
+        # кодируются как %XX
+        printf '\e]7;file://%s%s\e\\\e]133;A\e\\' $hostname (string escape --style=url -- $PWD)
+    end
+
+    function __bareterm_preexec --on-event fish_preexec
+        printf '\e]133;C\e\\'
+    end
+
+    function __bareterm_postexec --on-event fish_postexec
+        printf '\e]133;D;%s\e\\' $status
+    end
+end
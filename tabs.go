@@ -0,0 +1,203 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Tab - вкладка окна: панели, разложенные деревом разделений.
+type Tab struct {
+	id       int // Номер для удаленного управления
+	layout   *Layout
+	focus    *Pane // Панель с фокусом ввода
+	zoomed   bool  // Панель с фокусом развернута на всю вкладку
+	activity bool  // Был вывод, пока вкладка неактивна
+	bell     bool  // Был звонок, пока вкладка неактивна
+}
+
+// tab возвращает активную вкладку.
+func (app *App) tab() *Tab {
+	return app.tabs[app.active]
+}
+
+// NewTab запускает command в каталоге dir в новой вкладке после активной
+// и переключается на нее. Пустая команда означает оболочку пользователя.
+func (app *App) NewTab(command []string, dir string) error {
+	pane, err := app.newPane(command, dir)
+	if err != nil {
+		return err
+	}
+	app.addTab(pane)
+	return nil
+}
+
+// AttachTab открывает вкладку, подключенную к сессии id сервера, после
+// активной и переключается на нее.
+func (app *App) AttachTab(id int) error {
+	pane, err := app.attachPane(id)
+	if err != nil {
+		return err
+	}
+	app.addTab(pane)
+	return nil
+}
+
+// addTab добавляет вкладку с панелью pane после активной и переключается на нее.
+func (app *App) addTab(pane *Pane) {
+	tab := &Tab{id: app.windows.newID(), layout: &Layout{Pane: pane}, focus: pane}
+	i := min(app.active+1, len(app.tabs))
+	app.tabs = slices.Insert(app.tabs, i, tab)
+	app.active = i
+	app.arrange(tab)
+	app.SelectTab(i)
+}
+
+// CloseTab закрывает вкладку i и завершает программы в ее панелях.
+// Последняя вкладка не удаляется, а закрывает окно; ее программы завершит
+// Close.
+func (app *App) CloseTab(i int) {
+	if len(app.tabs) == 1 {
+		app.window.SetShouldClose(true)
+		return
+	}
+	// Программа может не сразу завершиться по SIGHUP, поэтому ожидание
+	// не держит главный поток
+	for _, p := range app.tabs[i].layout.Panes() {
+		go p.session.Close()
+	}
+	app.tabs = slices.Delete(app.tabs, i, i+1)
+	active := app.active
+	if i < active {
+		active--
+	}
+	app.SelectTab(min(active, len(app.tabs)-1))
+}
+
+// SelectTab делает вкладку i активной и снимает с нее отметки вывода и звонка.
+func (app *App) SelectTab(i int) {
+	app.active = i
+	tab := app.tab()
+	tab.activity, tab.bell = false, false
+	app.cancelModes() // Подсказки, поиск и режим vi относятся к экрану прежней вкладки
+	app.dragging = nil
+	app.showTab()
+	app.updateTabs()
+}
+
+// MoveTab сдвигает активную вкладку на delta позиций по кругу.
+func (app *App) MoveTab(delta int) {
+	n := len(app.tabs)
+	j := ((app.active+delta)%n + n) % n
+	app.tabs[app.active], app.tabs[j] = app.tabs[j], app.tabs[app.active]
+	app.active = j
+	app.updateTabs()
+}
+
+// Update обрабатывает события панелей: завершение программ, вывод и звонки
+// в неактивных вкладках, запросы к буферу обмена и заголовки. Вызывается из
+// главного цикла перед отрисовкой.
+func (app *App) Update() {
+	for i := len(app.tabs) - 1; i >= 0; i-- {
+		tab := app.tabs[i]
+		for _, p := range tab.layout.Panes() {
+			app.updatePane(tab, p, i == app.active)
+		}
+	}
+
+	pane := app.tab().focus
+	if len(pane.prompts) > 0 {
+		app.grid.SetPrompt(pane.prompts[0].Description())
+	} else {
+		app.grid.SetPrompt("")
+	}
+
+	// Заголовок окна из OSC 0/2 или имени процесса переднего плана
+	if title := pane.Title(app.cfg.TitleFormat); title != app.title {
+		app.title = title
+		app.window.SetTitle(title)
+		app.grid.SetTitle(title)
+	}
+	app.updateTabs()
+}
+
+// updatePane обрабатывает события панели p вкладки tab и сообщает о них
+// подписчикам удаленного управления.
+func (app *App) updatePane(tab *Tab, p *Pane, active bool) {
+	event := ControlEvent{Window: app.id, Tab: tab.id, Pane: p.id}
+
+	// Панель закрывается после завершения программы. С --hold она остается
+	// открытой, а в терминал выводится сообщение о завершении.
+	select {
+	case <-p.session.Done():
+		if p.exited {
+			break
+		}
+		p.exited = true
+		event.Event, event.Message = "command_finished", p.session.ExitMessage()
+		app.windows.publish(event)
+		if !app.opts.Hold {
+			app.ClosePane(tab, p)
+			return
+		}
+		p.session.term.Write([]byte("\r\n[" + p.session.ExitMessage() + "]"))
+	default:
+	}
+
+	activity, bell := p.session.term.TakeAlerts()
+	if !active {
+		tab.activity = tab.activity || activity
+		tab.bell = tab.bell || bell
+	}
+	if bell {
+		event.Event, event.Message = "bell", ""
+		app.windows.publish(event)
+	}
+	if title := p.Title(app.cfg.TitleFormat); title != p.reported {
+		p.reported = title
+		event.Event, event.Title = "title", title
+		app.windows.publish(event)
+	}
+
+	// Уведомление не показывается, пока панель видна в окне с фокусом,
+	// если программа не попросила показывать его всегда
+	focused := active && app.window.GetAttrib(glfw.Focused) == glfw.True
+	for _, n := range p.session.term.TakeNotifications() {
+		if !app.cfg.Notifications || focused && !n.Always || !p.notified.Allow(time.Now()) {
+			continue
+		}
+		if n.Title == "" {
+			n.Title = p.Title(app.cfg.TitleFormat)
+		}
+		app.windows.notifier.Post(n, app.cfg.NotifyCommand)
+	}
+
+	// Запросы к буферу обмена выполняются в главном потоке
+	for _, req := range p.session.term.TakeClipboardRequests() {
+		if req.Ask {
+			p.prompts = append(p.prompts, req)
+		} else {
+			p.session.applyClipboardRequest(req)
+		}
+	}
+}
+
+// updateTabs передает сетке строку вкладок. Если строка появилась или
+// исчезла, размер сетки меняется, и он сообщается всем вкладкам.
+func (app *App) updateTabs() {
+	infos := make([]TabInfo, len(app.tabs))
+	for i, tab := range app.tabs {
+		infos[i] = TabInfo{
+			Title:    tab.focus.Title(app.cfg.TitleFormat),
+			Activity: tab.activity,
+			Bell:     tab.bell,
+			Active:   i == app.active,
+		}
+	}
+	rows, _ := app.grid.Size()
+	app.grid.SetTabs(infos)
+	if r, _ := app.grid.Size(); r != rows {
+		app.resize()
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
-	"strings"
+	"log"
+	"math"
+	"time"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
@@ -10,21 +12,77 @@ import (
 
 // TermGrid представляет собой структуру для отображения сетки символов.
 type TermGrid struct {
-	window      *glfw.Window // Окно GLFW для отображения сетки
-	program     uint32       // Идентификатор шейдерной программы OpenGL
-	vao         uint32       // Vertex Array Object для хранения состояния вершинных атрибутов
-	vbo         uint32       // Vertex Buffer Object для хранения вершинных данных
-	cells       [][]rune     // Двумерный массив для хранения символов в сетке
-	cellSize    [2]float32   // Размер одной ячейки сетки (ширина, высота)
-	textColor   [4]float32   // Цвет текста (RGBA)
-	bgColor     [4]float32   // Цвет фона (RGBA)
-	font        *Font        // Шрифт для отрисовки текста
-	cursor      [2]int       // Позиция курсора в сетке (строка, столбец)
-	needsRedraw bool         // Флаг необходимости перерисовки
-}
-
-// NewTermGrid создает новый экземпляр TermGrid с заданными размерами.
-func NewTermGrid(width, height int, rows, cols int) (*TermGrid, error) {
+	window       *glfw.Window  // Окно GLFW для отображения сетки
+	program      uint32        // Идентификатор шейдерной программы OpenGL
+	vao          uint32        // Vertex Array Object для хранения состояния вершинных атрибутов
+	vbo          uint32        // Vertex Buffer Object для хранения вершинных данных
+	rows, cols   int           // Размер области панелей в символах (без строки вкладок)
+	views        []*View       // Видимые панели
+	view         *View         // Панель с фокусом ввода
+	dividers     []Rect        // Линии между панелями
+	cellSize     [2]float32    // Размер одной ячейки сетки (ширина, высота)
+	font         *Font         // Шрифт для отрисовки текста, общий с другими окнами
+	fontRequest  int           // Размер шрифта до подгонки под высоту ячейки
+	needsRedraw  bool          // Флаг необходимости перерисовки
+	prompt       string        // Вопрос пользователю в нижней строке
+	hoverLink    uint32        // Ссылка OSC 8 под указателем мыши
+	hints        HintMode      // Режим подсказок (выбор ссылок с клавиатуры)
+	search       SearchBar     // Строка поиска по экрану и истории
+	vi           ViInput       // Режим vi (выделение с клавиатуры)
+	fontFamily   string        // Имя шрифта
+	fontSize     int           // Размер шрифта из настроек (0 - по высоте ячейки)
+	padding      int           // Отступ сетки от краев окна в пикселях
+	hintPatterns []HintPattern // Шаблоны режима подсказок из настроек
+	cursorShape  CursorShape   // Форма курсора, если программа ее не задала
+	cursorBlink  bool          // Мигание курсора, если программа его не задала
+	blinkStart   time.Time     // Начало текущего цикла мигания
+	windowed     [4]int        // Положение и размер окна до перехода в полноэкранный режим
+	tabs         []TabInfo     // Вкладки окна; строка вкладок видна, если их больше одной
+}
+
+// Rect - прямоугольник области панелей в ячейках.
+type Rect struct {
+	Row, Col   int
+	Rows, Cols int
+}
+
+// Contains сообщает, попадает ли ячейка (row, col) в прямоугольник.
+func (r Rect) Contains(row, col int) bool {
+	return row >= r.Row && row < r.Row+r.Rows && col >= r.Col && col < r.Col+r.Cols
+}
+
+// View - терминал панели, показанный в прямоугольнике сетки.
+type View struct {
+	Rect          // Положение и размер в ячейках
+	snap Snapshot // Последний снимок экрана терминала
+}
+
+// TabInfo описывает вкладку для строки вкладок.
+type TabInfo struct {
+	Title    string
+	Activity bool // Вывод в неактивной вкладке
+	Bell     bool // Звонок в неактивной вкладке
+	Active   bool
+}
+
+// CursorShape - форма курсора.
+type CursorShape int
+
+const (
+	CursorBlock     CursorShape = iota // Блок
+	CursorUnderline                    // Подчеркивание
+	CursorBar                          // Вертикальная черта
+)
+
+// blinkInterval - время, на которое мигающий курсор показывается и скрывается.
+const blinkInterval = 500 * time.Millisecond
+
+// NewTermGrid создает окно с заголовком title и сеткой с размерами,
+// шрифтом и курсором из настроек. Контекст OpenGL окна разделяет объекты с
+// контекстом окна share, если оно задано, поэтому окна используют общие
+// текстуры глифов.
+func NewTermGrid(cfg Config, title string, share *glfw.Window) (*TermGrid, error) {
+	width, height := cfg.Width, cfg.Height
 	// Устанавливаем подсказки для создания окна GLFW
 	glfw.WindowHint(glfw.Resizable, glfw.False)
 	glfw.WindowHint(glfw.ContextVersionMajor, 3)
@@ -33,7 +91,7 @@ func NewTermGrid(width, height int, rows, cols int) (*TermGrid, error) {
 	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
 
 	// Создаем окно GLFW
-	window, err := glfw.CreateWindow(width, height, "TermGrid", nil, nil)
+	window, err := glfw.CreateWindow(width, height, title, nil, share)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create window: %v", err)
 	}
@@ -41,70 +99,133 @@ func NewTermGrid(width, height int, rows, cols int) (*TermGrid, error) {
 	// Устанавливаем текущий контекст OpenGL
 	window.MakeContextCurrent()
 
-	// Инициализируем OpenGL
-	if err := gl.Init(); err != nil {
-		return nil, fmt.Errorf("failed to initialize OpenGL: %v", err)
+	// Инициализируем OpenGL; функции OpenGL загружаются один раз для всех окон
+	if share == nil {
+		if err := gl.Init(); err != nil {
+			window.Destroy()
+			return nil, fmt.Errorf("failed to initialize OpenGL: %v", err)
+		}
 	}
 
 	// Создаем и инициализируем структуру TermGrid
 	grid := &TermGrid{
 		window:      window,
-		cells:       make([][]rune, rows),
-		cellSize:    [2]float32{float32(width) / float32(cols), float32(height) / float32(rows)},
-		textColor:   [4]float32{1, 1, 1, 1}, // Белый цвет по умолчанию
-		bgColor:     [4]float32{0, 0, 0, 1}, // Черный цвет по умолчанию
-		cursor:      [2]int{0, 0},
+		rows:        cfg.Rows,
+		cols:        cfg.Columns,
 		needsRedraw: true,
+		fontFamily:  cfg.FontFamily,
+		fontSize:    cfg.FontSize,
+		padding:     cfg.Padding,
+		cursorShape: cfg.CursorShape,
+		cursorBlink: cfg.CursorBlink,
+		blinkStart:  time.Now(),
 	}
-	for i := range grid.cells {
-		grid.cells[i] = make([]rune, cols)
-	}
+	grid.updateCellSize(width, height)
 
 	// Инициализируем OpenGL ресурсы
 	if err := grid.initOpenGL(); err != nil {
+		grid.Destroy()
 		return nil, err
 	}
 	// Устанавливаем callback для изменения размера окна
 	window.SetSizeCallback(grid.ResizeCallback)
 
 	// Создаем шрифт для отрисовки текста
-	grid.font, err = NewFont("DejaVuSansMono", int(grid.cellSize[1]))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create font: %v", err)
+	if err := grid.loadFont(false); err != nil {
+		grid.Destroy()
+		return nil, err
 	}
 
 	return grid, nil
 }
 
-func (g *TermGrid) SetTextColor(color [4]float32) {
-	g.textColor = color
+// ApplyConfig применяет новые настройки шрифта, отступов и курсора. Размер
+// окна и сетки при этом не меняется.
+func (g *TermGrid) ApplyConfig(cfg Config) error {
+	g.cursorShape, g.cursorBlink = cfg.CursorShape, cfg.CursorBlink
+	g.padding = cfg.Padding
+	g.hintPatterns = cfg.HintPatterns
+	width, height := g.window.GetSize()
+	g.updateCellSize(width, height)
+
+	reload := g.fontFamily != cfg.FontFamily
+	g.fontFamily, g.fontSize = cfg.FontFamily, cfg.FontSize
 	g.needsRedraw = true
+	return g.loadFont(reload)
 }
 
-func (g *TermGrid) SetFontSize(newSize int) error {
-	newFont, err := NewFont("DejaVuSansMono", newSize)
-	if err != nil {
-		return fmt.Errorf("failed to create new font: %v", err)
+// updateCellSize пересчитывает размер ячейки по размеру окна.
+func (g *TermGrid) updateCellSize(width, height int) {
+	g.cellSize = [2]float32{
+		float32(width-2*g.padding) / float32(g.cols),
+		float32(height-2*g.padding) / float32(g.rows+g.barRows()),
 	}
+}
 
-	g.font.Destroy()
-	g.font = newFont
-
-	// Recalculate cell size based on new font size
-	width, height := g.window.GetSize()
-	g.cellSize = [2]float32{
-		float32(width) / float32(len(g.cells[0])),
-		float32(height) / float32(len(g.cells)),
+// loadFont создает шрифт нужного размера, если текущий шрифт не подходит
+// или force. Размер берется из настроек, а если он не задан - такой, чтобы
+// строка шрифта помещалась в высоту ячейки. При ошибке остается прежний шрифт.
+func (g *TermGrid) loadFont(force bool) error {
+	size := g.fontSize
+	if size == 0 {
+		size = max(int(g.cellSize[1]), 1)
+	}
+	if g.font != nil && g.fontRequest == size && !force {
+		return nil
+	}
+	font, err := LoadFont(g.fontFamily, size)
+	if err != nil {
+		return fmt.Errorf("failed to create font: %v", err)
+	}
+	if _, height := font.CellSize(); g.fontSize == 0 && height > size {
+		// Высота строки больше кегля; уменьшаем кегль пропорционально
+		fit := max(size*size/height, 1)
+		fitted, err := LoadFont(g.fontFamily, fit)
+		font.Release()
+		if err != nil {
+			return fmt.Errorf("failed to create font: %v", err)
+		}
+		font = fitted
 	}
+	if g.font != nil {
+		g.font.Release() // Освобождаем старый шрифт, если он не нужен другим окнам
+	}
+	g.font, g.fontRequest = font, size
+	return nil
+}
 
+// SetFontSize меняет размер шрифта во время работы. Размер ячейки берется
+// из метрик нового шрифта. Если keepGrid и окно не во весь экран, окно
+// подгоняется под прежнее число строк и столбцов; иначе они пересчитываются
+// по размеру окна, и вызывающий должен сообщить новый размер терминалу.
+func (g *TermGrid) SetFontSize(size int, keepGrid bool) error {
+	font, err := LoadFont(g.fontFamily, size)
+	if err != nil {
+		return fmt.Errorf("failed to create font: %v", err)
+	}
+	g.font.Release() // Текстуры глифов старого размера могут быть больше не нужны
+	g.font, g.fontRequest = font, size
+	g.fontSize = size
+
+	cellWidth, cellHeight := font.CellSize()
+	g.cellSize = [2]float32{float32(cellWidth), float32(cellHeight)}
+	if keepGrid && g.window.GetMonitor() == nil {
+		// Размер ячейки сохранится: ResizeCallback разделит новый размер
+		// окна на то же число строк и столбцов
+		g.window.SetSize(g.cols*cellWidth+2*g.padding, (g.rows+g.barRows())*cellHeight+2*g.padding)
+	} else {
+		width, height := g.window.GetSize()
+		g.cols = max((width-2*g.padding)/cellWidth, 2)
+		g.rows = max((height-2*g.padding)/cellHeight-g.barRows(), 2)
+	}
+	g.hints.Cancel() // Метки подсказок привязаны к старой сетке
 	g.needsRedraw = true
 	return nil
 }
 
-// SetBackgroundColor устанавливает цвет фона для всей сетки.
-func (g *TermGrid) SetBackgroundColor(color [4]float32) {
-	g.bgColor = color
-	g.needsRedraw = true
+// Size возвращает размер сетки терминала в символах.
+func (g *TermGrid) Size() (rows, cols int) {
+	return g.rows, g.cols
 }
 
 // // Запуск отрисовки
@@ -152,145 +273,496 @@ func (g *TermGrid) initOpenGL() error {
 	return nil
 }
 
+// SetViews задает видимые панели, панель с фокусом и линии между панелями.
+func (g *TermGrid) SetViews(views []*View, focus *View, dividers []Rect) {
+	if focus != g.view {
+		g.hoverLink = 0 // Номера ссылок у каждого терминала свои
+	}
+	g.views, g.view, g.dividers = views, focus, dividers
+	g.needsRedraw = true
+}
+
+// Update забирает у терминала панели свежий снимок экрана, если он
+// изменился. Вызывается из главного потока перед отрисовкой кадра.
+func (g *TermGrid) Update(v *View, term *Terminal) bool {
+	if !term.Snapshot(&v.snap) {
+		return false
+	}
+	g.needsRedraw = true
+	if v == g.view {
+		g.blinkStart = time.Now() // Курсор не гаснет, пока идет вывод
+	}
+	return true
+}
+
+// areaCellAt возвращает ячейку области панелей под точкой окна, заданной в
+// пикселях. Координаты могут выходить за пределы области.
+func (g *TermGrid) areaCellAt(x, y float64) (row, col int) {
+	row = int(math.Floor((y - float64(g.top())) / float64(g.cellSize[1])))
+	col = int(math.Floor((x - float64(g.padding)) / float64(g.cellSize[0])))
+	return row, col
+}
+
+// CellAt возвращает ячейку (строка, столбец) панели с фокусом под точкой
+// окна, заданной в пикселях. Точки вне панели прижимаются к ее краю.
+func (g *TermGrid) CellAt(x, y float64) (row, col int) {
+	row, col = g.areaCellAt(x, y)
+	v := g.view
+	return clamp(row-v.Row, 0, v.Rows-1), clamp(col-v.Col, 0, v.Cols-1)
+}
+
+// PixelAt возвращает точку окна, заданную в пикселях, относительно левого
+// верхнего угла панели с фокусом: без отступа, строки вкладок и панелей
+// левее и выше. Точки вне панели прижимаются к ее краю.
+func (g *TermGrid) PixelAt(x, y float64) (px, py int) {
+	v := g.view
+	left, top := g.cellPos(v.Row, v.Col)
+	width := int(float32(v.Cols) * g.cellSize[0])
+	height := int(float32(v.Rows) * g.cellSize[1])
+	px = int(math.Floor(x - float64(left)))
+	py = int(math.Floor(y - float64(top)))
+	return clamp(px, 0, width-1), clamp(py, 0, height-1)
+}
+
+// LinkAt возвращает номер ссылки OSC 8 в ячейке панели с фокусом.
+func (g *TermGrid) LinkAt(row, col int) uint32 {
+	lines := g.view.snap.Lines
+	if row >= len(lines) || col >= len(lines[row].Cells) {
+		return 0
+	}
+	return lines[row].Cells[col].Link
+}
+
+// SetHoverLink запоминает ссылку под указателем мыши для подчеркивания.
+func (g *TermGrid) SetHoverLink(link uint32) {
+	if g.hoverLink != link {
+		g.hoverLink = link
+		g.needsRedraw = true
+	}
+}
+
 // Render отрисовывает содержимое сетки.
 func (g *TermGrid) Render() {
+	g.window.MakeContextCurrent()
+	palette := &g.view.snap.Palette
+	background := palette.Background.RGBA()
+	gl.ClearColor(background[0], background[1], background[2], background[3])
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	gl.UseProgram(g.program)
 	width, height := g.window.GetSize()
 	gl.Viewport(0, 0, int32(width), int32(height))
-	// Устанавливаем uniform-переменные для шейдеров
-	gl.Uniform2fv(gl.GetUniformLocation(g.program, gl.Str("cellSize\x00")), 1, &g.cellSize[0])
-	gl.Uniform4fv(gl.GetUniformLocation(g.program, gl.Str("textColor\x00")), 1, &g.textColor[0])
-	gl.Uniform4fv(gl.GetUniformLocation(g.program, gl.Str("bgColor\x00")), 1, &g.bgColor[0])
-
-	// Отрисовываем каждую ячейку сетки
-	for row, line := range g.cells {
-		for col, char := range line {
-			if char == 0 {
-				continue // Пропускаем пустые ячейки
+
+	for _, v := range g.views {
+		g.renderView(v)
+	}
+
+	// Линии между панелями рисуются посередине своих ячеек
+	thickness := max(1, g.cellSize[0]/8)
+	color := palette.Colors[8].RGBA()
+	for _, d := range g.dividers {
+		x, y := g.cellPos(d.Row, d.Col)
+		w, h := float32(d.Cols)*g.cellSize[0], float32(d.Rows)*g.cellSize[1]
+		if d.Cols == 1 {
+			g.drawQuad(x+(w-thickness)/2, y, thickness, h, 0, color, color)
+		} else {
+			g.drawQuad(x, y+(h-thickness)/2, w, thickness, 0, color, color)
+		}
+	}
+
+	// Метки подсказок рисуются поверх начала каждой подсказки
+	v := g.view
+	if g.hints.Active {
+		labelFg, labelBg := [4]float32{0, 0, 0, 1}, palette.Colors[11].RGBA()
+		for i := range g.hints.Hints {
+			h := &g.hints.Hints[i]
+			if g.hints.Visible(h) {
+				for j, char := range h.Label {
+					g.renderCell(v.Row+h.Start[0], v.Col+min(h.Start[1]+j, v.Cols-1), Cell{Char: char}, labelFg, labelBg)
+				}
 			}
-			g.renderCell(row, col, char)
 		}
 	}
 
+	// Вопрос пользователю и строка поиска рисуются поверх нижней строки
+	// панели с фокусом
+	if g.prompt != "" {
+		g.drawText(v.Row+v.Rows-1, v.Col, v.Col+v.Cols, g.prompt, background, palette.Foreground.RGBA())
+	} else if g.search.Active {
+		g.drawText(v.Row+v.Rows-1, v.Col, v.Col+v.Cols, g.search.Label(&v.snap), background, palette.Foreground.RGBA())
+	}
+
+	if g.barRows() > 0 {
+		g.renderTabBar()
+	}
+
 	g.window.SwapBuffers()
+	g.needsRedraw = false
 }
 
-// renderCell отрисовывает отдельную ячейку сетки.
-func (g *TermGrid) renderCell(row, col int, char rune) {
-	width, height := g.window.GetSize()
-	position := [2]float32{
-		2*float32(col)*g.cellSize[0]/float32(width) - 1,
-		1 - 2*float32(row+1)*g.cellSize[1]/float32(height),
+// renderView рисует терминал панели в ее прямоугольнике.
+func (g *TermGrid) renderView(v *View) {
+	palette := &v.snap.Palette
+	background := palette.Background.RGBA()
+	// Фон панели: программа в ней могла сменить его через OSC 11
+	x, y := g.cellPos(v.Row, v.Col)
+	g.drawQuad(x, y, float32(v.Cols)*g.cellSize[0], float32(v.Rows)*g.cellSize[1], 0, background, background)
+
+	focused := v == g.view
+	for row, line := range v.snap.Lines[:min(len(v.snap.Lines), v.Rows)] {
+		for col, cell := range line.Cells[:min(len(line.Cells), v.Cols)] {
+			if cell.Attr&AttrWideSpacer != 0 {
+				continue // Вторую половину широкого символа рисует первая
+			}
+			if focused && (cell.Link != 0 && cell.Link == g.hoverLink || g.hintAt(row, col)) {
+				cell.Attr |= AttrUnderline // Ссылка под мышью и подсказки подчеркиваются
+			}
+			fg, bg := g.cellColors(palette, cell)
+			if v.snap.Selected(row, col) {
+				fg, bg = g.selectionColors(palette, fg, bg)
+			} else if matched, current := v.snap.Matched(row, col); current {
+				// Текущее совпадение поиска ярче остальных
+				fg, bg = background, palette.Colors[11].RGBA()
+			} else if matched {
+				fg, bg = background, palette.Colors[3].RGBA()
+			}
+			if (cell.Char == 0 || cell.Char == ' ') && bg == background {
+				continue // Пропускаем пустые ячейки
+			}
+			g.renderCell(v.Row+row, v.Col+col, cell, fg, bg)
+		}
 	}
-	gl.Uniform2fv(gl.GetUniformLocation(g.program, gl.Str("cellPosition\x00")), 1, &position[0])
 
-	texture := g.font.GetCharTexture(char)
-	gl.BindTexture(gl.TEXTURE_2D, texture)
+	// Код завершения команды - полоса у левого края строки ее приглашения
+	thickness := max(2, g.cellSize[0]/4)
+	for row, line := range v.snap.Lines[:min(len(v.snap.Lines), v.Rows)] {
+		var color [4]float32
+		switch {
+		case line.Mark&MarkSuccess != 0:
+			color = palette.Colors[2].RGBA()
+		case line.Mark&MarkFailure != 0:
+			color = palette.Colors[1].RGBA()
+		default:
+			continue
+		}
+		x, y := g.cellPos(v.Row+row, v.Col)
+		g.drawQuad(x, y, thickness, g.cellSize[1], 0, color, color)
+	}
 
-	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	if v.snap.CursorVisible && v.snap.Cursor[0] < min(len(v.snap.Lines), v.Rows) && v.snap.Cursor[1] < v.Cols {
+		g.renderCursor(v)
+	}
+
+	// Курсор режима vi - блок своего цвета поверх курсора программы
+	if row, col := v.snap.ViCursor[0], v.snap.ViCursor[1]; v.snap.ViActive && row >= 0 && row < min(len(v.snap.Lines), v.Rows) && col < v.Cols {
+		cell := v.snap.Lines[row].Cells[col]
+		g.renderCell(v.Row+row, v.Col+col, cell, background, palette.Colors[12].RGBA())
+	}
 }
 
-// SetCell устанавливает символ в указанной позиции сетки.
-func (g *TermGrid) SetCell(row, col int, char rune) {
-	if row >= 0 && row < len(g.cells) && col >= 0 && col < len(g.cells[0]) {
-		g.cells[row][col] = char
-		g.needsRedraw = true
+// renderCursor рисует курсор цветом OSC 12, а если он не задан - цветом
+// текста под курсором. Блочный курсор инвертирует цвета ячейки. В панели
+// без фокуса курсор рисуется рамкой и не мигает.
+func (g *TermGrid) renderCursor(v *View) {
+	shape, blink := g.cursorStyle(v)
+	focused := v == g.view
+	if focused && blink && time.Since(g.blinkStart)/blinkInterval%2 == 1 {
+		return // Мигающий курсор сейчас скрыт
+	}
 
+	row, col := v.snap.Cursor[0], v.snap.Cursor[1]
+	cell := v.snap.Lines[row].Cells[col]
+	fg, bg := g.cellColors(&v.snap.Palette, cell)
+	if !v.snap.Palette.Cursor.IsDefault() {
+		fg = v.snap.Palette.Cursor.RGBA()
+	}
+
+	x, y := g.cellPos(v.Row+row, v.Col+col)
+	w, h := g.cellSize[0], g.cellSize[1]
+	if cell.Attr&AttrWide != 0 {
+		w *= 2
+	}
+	thickness := max(2, h/10)
+	switch {
+	case !focused:
+		thickness = max(1, thickness/2)
+		g.drawQuad(x, y, w, thickness, 0, fg, fg)
+		g.drawQuad(x, y+h-thickness, w, thickness, 0, fg, fg)
+		g.drawQuad(x, y, thickness, h, 0, fg, fg)
+		g.drawQuad(x+w-thickness, y, thickness, h, 0, fg, fg)
+	case shape == CursorUnderline:
+		g.drawQuad(x, y+h-thickness, w, thickness, 0, fg, fg)
+	case shape == CursorBar:
+		g.drawQuad(x, y, thickness, h, 0, fg, fg)
+	default:
+		g.renderCell(v.Row+row, v.Col+col, cell, bg, fg)
 	}
 }
 
-func (g *TermGrid) SetCell2(row, col int, char rune) {
-	if row >= 0 && row < len(g.cells) && col >= 0 && col < len(g.cells[0]) {
-		if g.cells[row][col] != char {
-			g.cells[row][col] = char
-			g.needsRedraw = true
-		}
+// cursorStyle возвращает форму курсора и признак мигания: заданные
+// программой через DECSCUSR, а если она их не задала - из настроек.
+func (g *TermGrid) cursorStyle(v *View) (CursorShape, bool) {
+	if style := v.snap.CursorStyle; style > 0 {
+		// 1-2 - блок, 3-4 - подчеркивание, 5-6 - черта; нечетные мигают
+		return CursorShape((style - 1) / 2), style%2 == 1
 	}
+	return g.cursorShape, g.cursorBlink
 }
 
-// SetText устанавливает текст в сетку, начиная с текущей позиции курсора.
-func (g *TermGrid) SetText(text string) {
-	lines := strings.Split(text, "\n")
-	for row, line := range lines {
-		if row >= len(g.cells) {
-			break
-		}
-		for col, char := range line {
-			if col >= len(g.cells[row]) {
-				break
-			}
-			g.cells[row][col] = char
+// NextBlink возвращает время до следующего переключения мигающего курсора
+// или 0, если курсор не мигает.
+func (g *TermGrid) NextBlink() time.Duration {
+	if _, blink := g.cursorStyle(g.view); !blink || !g.view.snap.CursorVisible {
+		return 0
+	}
+	return blinkInterval - time.Since(g.blinkStart)%blinkInterval
+}
+
+// StartHints включает режим подсказок для экрана панели с фокусом.
+func (g *TermGrid) StartHints(action HintAction) {
+	g.hints.Start(g.view.snap.Lines, action, g.hintPatterns)
+	g.needsRedraw = true
+}
+
+// hintAt сообщает, покрыта ли ячейка видимой подсказкой.
+func (g *TermGrid) hintAt(row, col int) bool {
+	if !g.hints.Active {
+		return false
+	}
+	for i := range g.hints.Hints {
+		if g.hints.Visible(&g.hints.Hints[i]) && g.hints.Hints[i].Contains(row, col) {
+			return true
 		}
 	}
-	g.cursor[0] = len(lines) - 1
-	g.cursor[1] = len(lines[len(lines)-1])
+	return false
+}
+
+// ToggleFullscreen переключает окно сетки между полноэкранным и обычным
+// режимом.
+func (g *TermGrid) ToggleFullscreen() {
+	if g.window.GetMonitor() != nil {
+		x, y, w, h := g.windowed[0], g.windowed[1], g.windowed[2], g.windowed[3]
+		g.window.SetMonitor(nil, x, y, w, h, glfw.DontCare)
+		return
+	}
+	monitor := glfw.GetPrimaryMonitor()
+	if monitor == nil {
+		return
+	}
+	x, y := g.window.GetPos()
+	w, h := g.window.GetSize()
+	g.windowed = [4]int{x, y, w, h}
+	mode := monitor.GetVideoMode()
+	g.window.SetMonitor(monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+}
+
+// cellPos возвращает левый верхний угол ячейки области панелей в пикселях.
+// Строка -1 - строка вкладок.
+func (g *TermGrid) cellPos(row, col int) (x, y float32) {
+	return float32(g.padding) + float32(col)*g.cellSize[0], g.top() + float32(row)*g.cellSize[1]
+}
+
+// top возвращает отступ первой строки терминала от верха окна в пикселях.
+func (g *TermGrid) top() float32 {
+	return float32(g.padding) + float32(g.barRows())*g.cellSize[1]
+}
+
+// barRows возвращает число строк, занятых строкой вкладок.
+func (g *TermGrid) barRows() int {
+	if len(g.tabs) > 1 {
+		return 1
+	}
+	return 0
+}
+
+// SetTabs обновляет строку вкладок. Когда строка появляется или исчезает,
+// сетка терминала теряет или получает строку, а размер ячейки сохраняется.
+func (g *TermGrid) SetTabs(tabs []TabInfo) {
+	bar := g.barRows()
+	g.tabs = append(g.tabs[:0], tabs...)
+	g.rows = max(g.rows+bar-g.barRows(), 1)
 	g.needsRedraw = true
+}
 
+// tabWidth возвращает ширину вкладки в строке вкладок в ячейках.
+func (g *TermGrid) tabWidth() int {
+	return max(g.cols/max(len(g.tabs), 1), 1)
 }
 
-// AppendChar добавляет символ в текущую позицию курсора.
-func (g *TermGrid) AppendChar(char rune) {
-	if g.cursor[1] < len(g.cells[g.cursor[0]]) {
-		g.cells[g.cursor[0]][g.cursor[1]] = char
-		g.cursor[1]++
-		g.needsRedraw = true
+// TabAt возвращает номер вкладки под точкой окна или -1, если точка не
+// попадает в строку вкладок.
+func (g *TermGrid) TabAt(x, y float64) int {
+	if g.barRows() == 0 || y < float64(g.padding) || y >= float64(g.top()) || x < float64(g.padding) {
+		return -1
+	}
+	i := int((x - float64(g.padding)) / float64(g.cellSize[0]) / float64(g.tabWidth()))
+	if i >= len(g.tabs) {
+		return -1
+	}
+	return i
+}
 
+// renderTabBar рисует строку вкладок над сеткой терминала (строка -1).
+// Вывод в неактивной вкладке отмечается "*", звонок - "!" и красным фоном.
+func (g *TermGrid) renderTabBar() {
+	palette := &g.view.snap.Palette
+	width := g.tabWidth()
+	for i, tab := range g.tabs {
+		fg, bg := palette.Foreground.RGBA(), palette.Colors[8].RGBA()
+		mark := ""
+		switch {
+		case tab.Active:
+			fg, bg = palette.Background.RGBA(), palette.Foreground.RGBA()
+		case tab.Bell:
+			mark, bg = "!", palette.Colors[1].RGBA()
+		case tab.Activity:
+			mark = "*"
+		}
+		label := fmt.Sprintf(" %d%s %s", i+1, mark, tab.Title)
+		g.drawText(-1, i*width, (i+1)*width, label, fg, bg)
 	}
 }
 
-// NewLine переводит курсор на новую строку.
-func (g *TermGrid) NewLine() {
-	if g.cursor[0] < len(g.cells)-1 {
-		g.cursor[0]++
-		g.cursor[1] = 0
-		g.needsRedraw = true
+// SetTitle устанавливает заголовок окна сетки.
+func (g *TermGrid) SetTitle(title string) {
+	g.window.SetTitle(title)
+}
 
+// SetPrompt показывает вопрос пользователю в нижней строке сетки.
+// Пустая строка убирает вопрос.
+func (g *TermGrid) SetPrompt(prompt string) {
+	if g.prompt != prompt {
+		g.prompt = prompt
+		g.needsRedraw = true
 	}
 }
 
-// Backspace удаляет символ перед курсором.
-func (g *TermGrid) Backspace() {
-	if g.cursor[1] > 0 {
-		g.cursor[1]--
-		g.cells[g.cursor[0]][g.cursor[1]] = 0
-	} else if g.cursor[0] > 0 {
-		g.cursor[0]--
-		g.cursor[1] = len(g.cells[g.cursor[0]]) - 1
-		for g.cursor[1] > 0 && g.cells[g.cursor[0]][g.cursor[1]-1] == 0 {
-			g.cursor[1]--
+// drawText рисует строку поверх сетки, начиная с ячейки (row, col), и
+// заполняет фоном остаток строки до столбца end.
+func (g *TermGrid) drawText(row, col, end int, text string, fg, bg [4]float32) {
+	for _, char := range text {
+		if col+max(1, runeWidth(char)) > end {
+			return
+		}
+		cell := Cell{Char: char}
+		if runeWidth(char) == 2 {
+			cell.Attr |= AttrWide
 		}
+		g.renderCell(row, col, cell, fg, bg)
+		col += max(1, runeWidth(char))
 	}
-	g.needsRedraw = true
+	for ; col < end; col++ {
+		g.renderCell(row, col, Cell{}, fg, bg)
+	}
+}
+
+// cellColors возвращает цвета текста и фона ячейки с учетом атрибутов.
+func (g *TermGrid) cellColors(palette *Palette, cell Cell) (fg, bg [4]float32) {
+	fgColor := cell.FG
+	if index, ok := fgColor.Index(); ok && index < 8 && cell.Attr&AttrBold != 0 {
+		fgColor = IndexedColor(index + 8) // Жирный текст использует яркие цвета
+	}
+	fg = resolveColor(palette, fgColor, palette.Foreground)
+	bg = resolveColor(palette, cell.BG, palette.Background)
+	if cell.Attr&AttrReverse != 0 {
+		fg, bg = bg, fg
+	}
+	if cell.Attr&AttrHidden != 0 {
+		fg = bg
+	}
+	return fg, bg
+}
+
+// selectionColors возвращает цвета выделенной ячейки: цвета OSC 17/19,
+// а если они не заданы - инверсию цветов ячейки.
+func (g *TermGrid) selectionColors(palette *Palette, fg, bg [4]float32) ([4]float32, [4]float32) {
+	if palette.SelectionBG.IsDefault() && palette.SelectionFG.IsDefault() {
+		return bg, fg
+	}
+	if !palette.SelectionBG.IsDefault() {
+		bg = palette.SelectionBG.RGBA()
+	}
+	if !palette.SelectionFG.IsDefault() {
+		fg = palette.SelectionFG.RGBA()
+	}
+	return fg, bg
+}
+
+// resolveColor переводит цвет ячейки в RGBA, используя палитру palette.
+func resolveColor(palette *Palette, c Color, def Color) [4]float32 {
+	if c.IsDefault() {
+		return def.RGBA()
+	}
+	if index, ok := c.Index(); ok {
+		return palette.Colors[index].RGBA()
+	}
+	return c.RGBA()
+}
 
+// renderCell отрисовывает отдельную ячейку сетки.
+func (g *TermGrid) renderCell(row, col int, cell Cell, fg, bg [4]float32) {
+	x, y := g.cellPos(row, col)
+	w := g.cellSize[0]
+	if cell.Attr&AttrWide != 0 {
+		w *= 2
+	}
+
+	var texture uint32
+	if cell.Char != 0 && cell.Char != ' ' {
+		texture = g.font.GetCharTexture(cell.Char)
+	}
+	g.drawQuad(x, y, w, g.cellSize[1], texture, fg, bg)
+
+	// Подчеркивание и зачеркивание рисуются тонкими полосами цвета текста
+	line := max(1, g.cellSize[1]/14)
+	if cell.Attr&AttrUnderline != 0 {
+		g.drawQuad(x, y+g.cellSize[1]-line, w, line, 0, fg, fg)
+	}
+	if cell.Attr&AttrStrike != 0 {
+		g.drawQuad(x, y+g.cellSize[1]/2, w, line, 0, fg, fg)
+	}
+}
+
+// drawQuad рисует прямоугольник, заданный в пикселях от левого верхнего угла
+// окна. Текстура 0 дает сплошную заливку цветом bg.
+func (g *TermGrid) drawQuad(x, y, w, h float32, texture uint32, fg, bg [4]float32) {
+	width, height := g.window.GetSize()
+	size := [2]float32{2 * w / float32(width), 2 * h / float32(height)}
+	position := [2]float32{
+		2*x/float32(width) - 1,
+		1 - 2*(y+h)/float32(height),
+	}
+	gl.Uniform2fv(gl.GetUniformLocation(g.program, gl.Str("cellSize\x00")), 1, &size[0])
+	gl.Uniform2fv(gl.GetUniformLocation(g.program, gl.Str("cellPosition\x00")), 1, &position[0])
+	gl.Uniform4fv(gl.GetUniformLocation(g.program, gl.Str("textColor\x00")), 1, &fg[0])
+	gl.Uniform4fv(gl.GetUniformLocation(g.program, gl.Str("bgColor\x00")), 1, &bg[0])
+
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
 }
 
-// Destroy освобождает ресурсы, занятые TermGrid.
+// Destroy освобождает ресурсы, занятые TermGrid, и закрывает окно.
 func (g *TermGrid) Destroy() {
+	g.window.MakeContextCurrent()
 	gl.DeleteProgram(g.program)
 	gl.DeleteVertexArrays(1, &g.vao)
 	gl.DeleteBuffers(1, &g.vbo)
-	g.font.Destroy()
+	if g.font != nil {
+		g.font.Release()
+	}
+	g.window.Destroy()
 }
 
 func (g *TermGrid) ResizeCallback(w *glfw.Window, width int, height int) {
 	// Обновляем размер viewport OpenGL
+	g.window.MakeContextCurrent()
 	gl.Viewport(0, 0, int32(width), int32(height))
 
 	// Пересчитываем размер ячейки
-	g.cellSize = [2]float32{
-		float32(width) / float32(len(g.cells[0])),
-		float32(height) / float32(len(g.cells)),
-	}
+	g.updateCellSize(width, height)
 
 	// Обновляем размер шрифта, если необходимо
-	newFontSize := int(g.cellSize[1])
-	if g.font.size != newFontSize {
-		newFont, err := NewFont("DejaVuSansMono", newFontSize)
-		if err == nil {
-			g.font.Destroy() // Освобождаем ресурсы старого шрифта
-			g.font = newFont
-		}
+	if err := g.loadFont(false); err != nil {
+		log.Println(err)
 	}
 
 	// Устанавливаем флаг необходимости перерисовки
@@ -0,0 +1,1046 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// syncTimeout ограничивает время, на которое синхронизированный вывод
+// (режим 2026) может задержать отрисовку, если программа не сбросила режим.
+const syncTimeout = 150 * time.Millisecond
+
+// supportedModes перечисляет приватные режимы DEC, о которых терминал
+// сообщает в ответ на DECRQM.
+var supportedModes = map[int]bool{
+	1: true, 7: true, 25: true, 47: true, 1047: true, 1049: true, 2004: true, 2026: true,
+	mouseX10: true, mouseNormal: true, mouseButtonMove: true, mouseAnyMove: true,
+	mouseEncUTF8: true, mouseEncSGR: true, mouseEncURXVT: true, mouseEncSGRPixels: true,
+}
+
+// CellAttr - набор атрибутов отображения символа (SGR).
+type CellAttr uint16
+
+const (
+	AttrBold       CellAttr = 1 << iota // Жирный
+	AttrDim                             // Приглушенный
+	AttrItalic                          // Курсив
+	AttrUnderline                       // Подчеркнутый
+	AttrBlink                           // Мигающий
+	AttrReverse                         // Инверсия цветов
+	AttrHidden                          // Скрытый
+	AttrStrike                          // Зачеркнутый
+	AttrWide                            // Первая половина широкого символа
+	AttrWideSpacer                      // Вторая половина широкого символа
+)
+
+// Cell представляет одну ячейку экрана терминала.
+type Cell struct {
+	Char rune     // Символ (0 - пустая ячейка)
+	FG   Color    // Цвет текста
+	BG   Color    // Цвет фона
+	Attr CellAttr // Атрибуты
+	Link uint32   // Номер ссылки OSC 8 (0 - нет ссылки)
+}
+
+// Line представляет одну строку экрана или истории прокрутки.
+type Line struct {
+	Cells   []Cell
+	Wrapped bool     // Строка продолжается на следующей (мягкий перенос)
+	Mark    LineMark // Отметки приглашения и вывода команды (OSC 133)
+}
+
+// savedCursor хранит состояние курсора для DECSC/DECRC.
+type savedCursor struct {
+	cursor [2]int
+	pen    Cell
+}
+
+// Terminal - модель терминала: экран, история прокрутки, курсор и режимы.
+// Вывод дочернего процесса разбирается в отдельной горутине, поэтому все
+// изменения состояния выполняются под мьютексом mu, а поток отрисовки
+// получает согласованную копию экрана через Snapshot.
+type Terminal struct {
+	mu          sync.Mutex
+	parser      *Parser
+	rows, cols  int
+	lines       []Line       // Видимый экран
+	primary     []Line       // Основной экран, пока активен альтернативный
+	history     []Line       // История прокрутки (старые строки в начале)
+	scrolled    int          // Сколько строк всего ушло в историю
+	maxHistory  int          // Максимальный размер истории
+	cursor      [2]int       // Позиция курсора (строка, столбец)
+	saved       savedCursor  // Сохраненный курсор (DECSC)
+	wrapPending bool         // Следующий символ должен перейти на новую строку
+	cursorStyle int          // Форма курсора DECSCUSR (0 - из настроек)
+	pen         Cell         // Текущие цвета и атрибуты для новых символов
+	top, bottom int          // Область прокрутки (DECSTBM), включительно
+	modes       map[int]bool // Приватные режимы DEC (DECSET/DECRST)
+	out         io.Writer    // Куда отправлять ответы на запросы (DSR, DA)
+	replies     []byte       // Ответы, накопленные во время разбора
+	dirty       bool         // Экран изменился с момента последнего снимка
+	activity    bool         // Был вывод с прошлого вызова TakeAlerts
+	bell        bool         // Был звонок (BEL) с прошлого вызова TakeAlerts
+	syncStart   time.Time    // Момент включения синхронизированного вывода
+
+	scroll         int       // На сколько строк область просмотра сдвинута в историю
+	sel            Selection // Выделение пользователя
+	search         Search    // Поиск по экрану и истории
+	vi             viCursor  // Курсор режима vi
+	wordSeparators string    // Разделители слов для выделения двойным щелчком
+
+	clipboardPolicy   ClipboardPolicy    // Права доступа к буферу обмена через OSC 52
+	clipboardRequests []ClipboardRequest // Запросы OSC 52 для главного потока
+
+	notifications []Notification           // Уведомления OSC 9/777/99 для главного потока
+	pendingNotes  map[string]*Notification // Уведомления OSC 99, переданные не целиком
+
+	links   []Hyperlink       // Ссылки OSC 8; номер ссылки в ячейке - индекс + 1
+	linkIDs map[string]uint32 // Номера ссылок по id и URI
+
+	title      string       // Заголовок окна (OSC 0/2)
+	cwd        string       // Рабочий каталог, сообщенный программой (OSC 7)
+	iconName   string       // Имя значка (OSC 0/1)
+	titleStack []titleEntry // Стек заголовков XTWINOPS (CSI 22/23 t)
+
+	palette        Palette  // Текущие цвета (OSC 4, 10-19)
+	defaultPalette Palette  // Цвета, к которым возвращает сброс
+	forwardQueries bool     // Запросы цветов отвечает не эта модель, а клиенты сервера
+	colorQueries   []string // Запросы цветов для клиентов сервера
+}
+
+// titleEntry - сохраненные заголовок и имя значка.
+type titleEntry struct {
+	title, iconName string
+}
+
+// maxTitleStack ограничивает глубину стека заголовков, как в xterm.
+const maxTitleStack = 10
+
+// Snapshot - согласованная копия видимого экрана для отрисовки.
+type Snapshot struct {
+	Rows, Cols    int
+	Lines         []Line
+	Cursor        [2]int
+	CursorVisible bool
+	CursorStyle   int            // Форма курсора DECSCUSR (0 - из настроек)
+	Top           int            // Номер первой видимой строки в тексте терминала
+	Selection     SelectionRange // Выделение пользователя
+	HasSelection  bool
+	Matches       []SelectionRange // Совпадения поиска в области просмотра
+	CurrentMatch  Point            // Начало текущего совпадения
+	MatchIndex    int              // Номер текущего совпадения с 1 (0 - не видно)
+	MatchCount    int              // Число всех совпадений
+	ViActive      bool             // Включен режим vi
+	ViCursor      [2]int           // Курсор режима vi в области просмотра (строка, столбец)
+	Palette       Palette          // Цвета для отрисовки
+}
+
+// Selected сообщает, выделена ли ячейка видимой области.
+func (s *Snapshot) Selected(row, col int) bool {
+	return s.HasSelection && s.Selection.Contains(s.Top+row, col)
+}
+
+// NewTerminal создает модель терминала заданного размера.
+func NewTerminal(rows, cols int) *Terminal {
+	t := &Terminal{
+		rows:       rows,
+		cols:       cols,
+		maxHistory: 10000,
+		bottom:     rows - 1,
+		modes:      map[int]bool{7: true, 25: true},
+		dirty:      true,
+
+		wordSeparators:  defaultWordSeparators,
+		clipboardPolicy: defaultClipboardPolicy,
+		linkIDs:         make(map[string]uint32),
+		palette:         defaultPalette(),
+	}
+	t.defaultPalette = t.palette
+	t.lines = t.blankLines(rows)
+	t.parser = NewParser(t)
+	return t
+}
+
+// Write разбирает вывод дочернего процесса и обновляет модель.
+// Метод безопасно вызывать из горутины чтения PTY.
+func (t *Terminal) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	t.parser.Feed(data)
+	t.dirty = true
+	t.activity = true
+	replies := t.replies
+	t.replies = nil
+	t.mu.Unlock()
+
+	if len(replies) > 0 && t.out != nil {
+		if _, err := t.out.Write(replies); err != nil {
+			return len(data), fmt.Errorf("failed to write reply: %v", err)
+		}
+	}
+	return len(data), nil
+}
+
+// Snapshot копирует видимый экран в dst, если он изменился с прошлого вызова.
+// Буферы dst переиспользуются, поэтому поток отрисовки может держать два
+// снимка и не выделять память на каждый кадр.
+//
+// Пока включен синхронизированный вывод (CSI ? 2026 h), снимок не
+// обновляется, чтобы отрисовка не увидела наполовину выведенный кадр.
+// Через syncTimeout режим перестает сдерживать отрисовку.
+func (t *Terminal) Snapshot(dst *Snapshot) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.dirty || t.synchronized() {
+		return false
+	}
+	t.dirty = false
+	t.snapshot(dst)
+	return true
+}
+
+// snapshot копирует видимый экран в dst. Вызывается под мьютексом.
+func (t *Terminal) snapshot(dst *Snapshot) {
+	dst.Rows, dst.Cols = t.rows, t.cols
+	dst.Cursor = [2]int{t.cursor[0] + t.scroll, t.cursor[1]}
+	dst.CursorVisible = t.modes[25] && dst.Cursor[0] < t.rows
+	dst.CursorStyle = t.cursorStyle
+	dst.Top = len(t.history) - t.scroll
+	dst.Selection, dst.HasSelection = t.selectionRange()
+	t.snapshotSearch(dst)
+	dst.ViActive = t.vi.Active
+	dst.ViCursor = [2]int{t.vi.Point.Line - dst.Top, t.vi.Point.Col}
+	dst.Palette = t.palette
+	if cap(dst.Lines) < t.rows {
+		dst.Lines = make([]Line, t.rows)
+	}
+	dst.Lines = dst.Lines[:t.rows]
+	for i := range dst.Lines {
+		// Строки истории сохраняют ширину экрана, на котором были выведены
+		line := t.lineAt(dst.Top + i)
+		dst.Lines[i].Cells = resizeCells(append(dst.Lines[i].Cells[:0], line.Cells...), t.cols)
+		dst.Lines[i].Wrapped = line.Wrapped
+		dst.Lines[i].Mark = line.Mark
+	}
+}
+
+// TakeAlerts сообщает, был ли вывод и звонок (BEL) с прошлого вызова.
+func (t *Terminal) TakeAlerts() (activity, bell bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	activity, bell = t.activity, t.bell
+	t.activity, t.bell = false, false
+	return activity, bell
+}
+
+// SyncRemaining возвращает, сколько еще синхронизированный вывод будет
+// сдерживать отрисовку, или 0, если не сдерживает.
+func (t *Terminal) SyncRemaining() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.modes[2026] {
+		return 0
+	}
+	return max(syncTimeout-time.Since(t.syncStart), 0)
+}
+
+func (t *Terminal) synchronized() bool {
+	return t.modes[2026] && time.Since(t.syncStart) < syncTimeout
+}
+
+// Mode сообщает, включен ли приватный режим DEC с заданным номером.
+func (t *Terminal) Mode(mode int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.modes[mode]
+}
+
+// AltScreen сообщает, активен ли альтернативный экран.
+func (t *Terminal) AltScreen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.primary != nil
+}
+
+// ScrollView прокручивает область просмотра на delta строк: положительные
+// значения сдвигают ее в историю, отрицательные - обратно к экрану.
+func (t *Terminal) ScrollView(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scroll := t.scroll + delta
+	if t.primary != nil {
+		scroll = 0 // У альтернативного экрана нет истории
+	}
+	scroll = clamp(scroll, 0, len(t.history))
+	if scroll != t.scroll {
+		t.scroll = scroll
+		t.dirty = true
+	}
+}
+
+// ScrollToBottom возвращает область просмотра к экрану.
+func (t *Terminal) ScrollToBottom() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.scroll != 0 {
+		t.scroll = 0
+		t.dirty = true
+	}
+}
+
+// ScrollToTop сдвигает область просмотра к началу истории.
+func (t *Terminal) ScrollToTop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.primary == nil && t.scroll != len(t.history) {
+		t.scroll = len(t.history)
+		t.dirty = true
+	}
+}
+
+// SetMaxHistory меняет размер истории прокрутки. Лишние старые строки
+// отбрасываются сразу.
+func (t *Terminal) SetMaxHistory(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.maxHistory = max(n, 0)
+	if drop := len(t.history) - t.maxHistory; drop > 0 {
+		clear(t.history[:drop])
+		t.history = t.history[drop:]
+		t.shiftSelection(-drop)
+		t.shiftSearch(-drop)
+		t.scroll = min(t.scroll, len(t.history))
+		t.dirty = true
+	}
+}
+
+// Resize меняет размер экрана. Строки над курсором, не помещающиеся по
+// высоте, уходят в историю, а при увеличении высоты возвращаются из нее,
+// поэтому текст остается на месте. Лишние столбцы обрезаются. Область
+// прокрутки сбрасывается на весь экран.
+func (t *Terminal) Resize(rows, cols int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rows == t.rows && cols == t.cols {
+		return
+	}
+	t.cols = cols
+	if t.primary == nil {
+		t.lines, t.cursor[0] = t.resizeScreen(t.lines, t.cursor[0], rows, true)
+	} else {
+		// Основной экран меняется так, как если бы был активен, а
+		// альтернативный не связан с историей и обрезается снизу
+		t.primary, t.saved.cursor[0] = t.resizeScreen(t.primary, t.saved.cursor[0], rows, true)
+		t.lines, _ = t.resizeScreen(t.lines, 0, rows, false)
+	}
+	t.rows = rows
+	t.top, t.bottom = 0, rows-1
+	t.moveCursor(t.cursor[0], t.cursor[1])
+	t.scroll = min(t.scroll, len(t.history))
+	t.dirty = true
+}
+
+// resizeScreen меняет число строк экрана lines с курсором в строке row и
+// ширину строк под t.cols. Если history, строки обмениваются с историей
+// прокрутки. Возвращает новые строки и строку курсора.
+func (t *Terminal) resizeScreen(lines []Line, row, rows int, history bool) ([]Line, int) {
+	if drop := row - rows + 1; drop > 0 && history {
+		// Курсор остается на экране, строки над ним уходят в историю
+		for _, line := range lines[:drop] {
+			t.pushHistory(line)
+		}
+		lines, row = lines[drop:], row-drop
+	}
+	if pull := min(rows-len(lines), len(t.history)); pull > 0 && history {
+		n := len(t.history) - pull
+		lines = append(slices.Clone(t.history[n:]), lines...)
+		clear(t.history[n:])
+		t.history, row = t.history[:n], row+pull
+		t.truncateSearch(n)
+	}
+
+	lines = lines[:min(len(lines), rows)]
+	for len(lines) < rows {
+		lines = append(lines, t.blankLine())
+	}
+	for i := range lines {
+		lines[i].Cells = resizeCells(lines[i].Cells, t.cols)
+	}
+	return lines, row
+}
+
+// resizeCells обрезает или дополняет пустыми ячейками строку до cols.
+func resizeCells(cells []Cell, cols int) []Cell {
+	if len(cells) < cols {
+		return append(cells, make([]Cell, cols-len(cells))...)
+	}
+	cells = cells[:cols]
+	if cols > 0 && cells[cols-1].Attr&AttrWide != 0 {
+		cells[cols-1] = Cell{} // Вторая половина широкого символа не поместилась
+	}
+	return cells
+}
+
+// blankLine создает пустую строку с текущим цветом фона.
+func (t *Terminal) blankLine() Line {
+	cells := make([]Cell, t.cols)
+	t.eraseCells(cells)
+	return Line{Cells: cells}
+}
+
+func (t *Terminal) blankLines(n int) []Line {
+	lines := make([]Line, n)
+	for i := range lines {
+		lines[i] = t.blankLine()
+	}
+	return lines
+}
+
+// eraseCells очищает ячейки, сохраняя текущий цвет фона (BCE).
+func (t *Terminal) eraseCells(cells []Cell) {
+	for i := range cells {
+		cells[i] = Cell{BG: t.pen.BG}
+	}
+}
+
+// moveCursor перемещает курсор с ограничением по границам экрана.
+func (t *Terminal) moveCursor(row, col int) {
+	t.cursor[0] = clamp(row, 0, t.rows-1)
+	t.cursor[1] = clamp(col, 0, t.cols-1)
+	t.wrapPending = false
+}
+
+// scrollUp сдвигает область прокрутки вверх на n строк. Строки, уходящие
+// с верха основного экрана, попадают в историю.
+func (t *Terminal) scrollUp(n int) {
+	if t.top == 0 && t.primary == nil {
+		for i := 0; i < min(n, t.bottom+1); i++ {
+			t.pushHistory(t.lines[i])
+			if t.scroll > 0 {
+				// Область просмотра остается на тех же строках истории
+				t.scroll = min(t.scroll+1, len(t.history))
+			}
+		}
+	}
+	t.deleteLines(t.top, n)
+}
+
+// scrollDown сдвигает область прокрутки вниз на n строк.
+func (t *Terminal) scrollDown(n int) {
+	t.insertLines(t.top, n)
+}
+
+// deleteLines удаляет n строк начиная с row, подтягивая снизу пустые строки
+// в пределах области прокрутки.
+func (t *Terminal) deleteLines(row, n int) {
+	n = min(n, t.bottom-row+1)
+	copy(t.lines[row:t.bottom+1], t.lines[row+n:t.bottom+1])
+	for i := t.bottom - n + 1; i <= t.bottom; i++ {
+		t.lines[i] = t.blankLine()
+	}
+}
+
+// insertLines вставляет n пустых строк начиная с row, сдвигая остальные вниз
+// в пределах области прокрутки.
+func (t *Terminal) insertLines(row, n int) {
+	n = min(n, t.bottom-row+1)
+	copy(t.lines[row+n:t.bottom+1], t.lines[row:t.bottom+1-n])
+	for i := row; i < row+n; i++ {
+		t.lines[i] = t.blankLine()
+	}
+}
+
+// pushHistory добавляет строку в историю прокрутки.
+func (t *Terminal) pushHistory(line Line) {
+	t.scrolled++
+	if t.maxHistory <= 0 {
+		return
+	}
+	if len(t.history) >= t.maxHistory {
+		// Срез сдвигается без копирования; append перенесет живую часть
+		// в новый массив, когда закончится емкость
+		t.history[0] = Line{}
+		t.history = t.history[1:]
+		t.shiftSelection(-1)
+		t.shiftSearch(-1)
+	}
+	t.history = append(t.history, line)
+}
+
+// shiftSelection сдвигает выделение и курсор режима vi вслед за строками
+// текста и снимает выделение, если выделенные строки ушли из истории.
+func (t *Terminal) shiftSelection(delta int) {
+	if t.vi.Active {
+		t.vi.Point = t.viClamp(Point{t.vi.Point.Line + delta, t.vi.Point.Col})
+	}
+	if !t.sel.Active {
+		return
+	}
+	t.sel.Anchor.Line += delta
+	t.sel.Head.Line += delta
+	if t.sel.Anchor.Line < 0 || t.sel.Head.Line < 0 {
+		t.sel = Selection{}
+	}
+}
+
+// index перемещает курсор на строку вниз, прокручивая область при необходимости.
+func (t *Terminal) index() {
+	if t.cursor[0] == t.bottom {
+		t.scrollUp(1)
+	} else if t.cursor[0] < t.rows-1 {
+		t.cursor[0]++
+	}
+	t.wrapPending = false
+}
+
+// reverseIndex перемещает курсор на строку вверх, прокручивая область при необходимости.
+func (t *Terminal) reverseIndex() {
+	if t.cursor[0] == t.top {
+		t.scrollDown(1)
+	} else if t.cursor[0] > 0 {
+		t.cursor[0]--
+	}
+	t.wrapPending = false
+}
+
+// print выводит символ в позицию курсора.
+func (t *Terminal) print(r rune) {
+	width := runeWidth(r)
+	if width == 0 {
+		// Комбинирующие символы пока не поддерживаются
+		return
+	}
+	if width == 2 && t.cols < 2 {
+		// Широкий символ не помещается в строку из одного столбца
+		r, width = ' ', 1
+	}
+
+	if t.wrapPending && t.modes[7] {
+		t.lines[t.cursor[0]].Wrapped = true
+		t.index()
+		t.cursor[1] = 0
+	}
+	t.wrapPending = false
+
+	if width == 2 && t.cursor[1] == t.cols-1 {
+		if !t.modes[7] {
+			return
+		}
+		// Широкий символ не помещается в последний столбец
+		t.lines[t.cursor[0]].Cells[t.cursor[1]] = Cell{BG: t.pen.BG}
+		t.lines[t.cursor[0]].Wrapped = true
+		t.index()
+		t.cursor[1] = 0
+	}
+
+	row, col := t.cursor[0], t.cursor[1]
+	cells := t.lines[row].Cells
+	t.breakWide(cells, col)
+	cell := t.pen
+	cell.Char = r
+	cells[col] = cell
+	if width == 2 {
+		t.breakWide(cells, col+1)
+		cells[col].Attr |= AttrWide
+		cells[col+1] = Cell{FG: t.pen.FG, BG: t.pen.BG, Attr: t.pen.Attr | AttrWideSpacer}
+	}
+
+	if col+width >= t.cols {
+		t.cursor[1] = t.cols - 1
+		t.wrapPending = true
+	} else {
+		t.cursor[1] = col + width
+	}
+}
+
+// breakWide очищает вторую половину широкого символа, если ячейка col
+// перезаписывается частично.
+func (t *Terminal) breakWide(cells []Cell, col int) {
+	switch {
+	case cells[col].Attr&AttrWideSpacer != 0 && col > 0:
+		cells[col-1] = Cell{BG: cells[col-1].BG}
+	case cells[col].Attr&AttrWide != 0 && col+1 < len(cells):
+		cells[col+1] = Cell{BG: cells[col+1].BG}
+	}
+}
+
+// execute обрабатывает управляющие символы C0.
+func (t *Terminal) execute(b byte) {
+	switch b {
+	case '\b':
+		if t.cursor[1] > 0 {
+			t.cursor[1]--
+		}
+		t.wrapPending = false
+	case '\t':
+		t.cursor[1] = min((t.cursor[1]/8+1)*8, t.cols-1)
+	case '\n', '\v', '\f':
+		t.index()
+	case '\r':
+		t.cursor[1] = 0
+		t.wrapPending = false
+	case 0x07:
+		t.bell = true
+	}
+}
+
+// escDispatch обрабатывает последовательности ESC.
+func (t *Terminal) escDispatch(intermediates []byte, final byte) {
+	if len(intermediates) > 0 {
+		// Выбор набора символов и прочие последовательности с промежуточными байтами
+		return
+	}
+	switch final {
+	case '7': // DECSC
+		t.saved = savedCursor{cursor: t.cursor, pen: t.pen}
+	case '8': // DECRC
+		t.pen = t.saved.pen
+		t.moveCursor(t.saved.cursor[0], t.saved.cursor[1])
+	case 'D': // IND
+		t.index()
+	case 'E': // NEL
+		t.index()
+		t.cursor[1] = 0
+	case 'M': // RI
+		t.reverseIndex()
+	case 'c': // RIS
+		t.reset()
+	}
+}
+
+// reset возвращает терминал в начальное состояние.
+func (t *Terminal) reset() {
+	t.pen = Cell{}
+	t.primary = nil
+	t.scroll = 0
+	t.sel = Selection{}
+	t.lines = t.blankLines(t.rows)
+	t.top, t.bottom = 0, t.rows-1
+	t.modes = map[int]bool{7: true, 25: true}
+	t.palette = t.defaultPalette
+	t.cursorStyle = 0
+	t.moveCursor(0, 0)
+	t.compactLinks() // Ссылки стертого экрана больше не нужны
+}
+
+// csiDispatch обрабатывает последовательности CSI.
+func (t *Terminal) csiDispatch(private byte, params []int, intermediates []byte, final byte) {
+	if len(intermediates) > 0 {
+		switch {
+		case string(intermediates) == "$" && final == 'p': // DECRQM
+			t.reportMode(private, param(params, 0, 0))
+		case string(intermediates) == " " && final == 'q' && private == 0: // DECSCUSR
+			if style := param(params, 0, 0); style <= 6 {
+				t.cursorStyle = style
+			}
+		}
+		return
+	}
+	n := param(params, 0, 1)
+
+	switch private {
+	case '?':
+		switch final {
+		case 'h':
+			t.setModes(params, true)
+		case 'l':
+			t.setModes(params, false)
+		}
+		return
+	case '>':
+		if final == 'c' { // Secondary DA
+			t.reply("\x1b[>0;10;1c")
+		}
+		return
+	case 0:
+	default:
+		return
+	}
+
+	row, col := t.cursor[0], t.cursor[1]
+	switch final {
+	case 'A': // CUU
+		t.moveCursor(row-n, col)
+	case 'B', 'e': // CUD, VPR
+		t.moveCursor(row+n, col)
+	case 'C', 'a': // CUF, HPR
+		t.moveCursor(row, col+n)
+	case 'D': // CUB
+		t.moveCursor(row, col-n)
+	case 'E': // CNL
+		t.moveCursor(row+n, 0)
+	case 'F': // CPL
+		t.moveCursor(row-n, 0)
+	case 'G', '`': // CHA, HPA
+		t.moveCursor(row, n-1)
+	case 'H', 'f': // CUP, HVP
+		t.moveCursor(param(params, 0, 1)-1, param(params, 1, 1)-1)
+	case 'd': // VPA
+		t.moveCursor(n-1, col)
+	case 'J': // ED
+		t.eraseDisplay(param(params, 0, 0))
+	case 'K': // EL
+		t.eraseLine(param(params, 0, 0))
+	case 'L': // IL
+		if row >= t.top && row <= t.bottom {
+			t.insertLines(row, n)
+			t.cursor[1] = 0
+		}
+	case 'M': // DL
+		if row >= t.top && row <= t.bottom {
+			t.deleteLines(row, n)
+			t.cursor[1] = 0
+		}
+	case 'P': // DCH
+		cells := t.lines[row].Cells
+		n = min(n, t.cols-col)
+		copy(cells[col:], cells[col+n:])
+		t.eraseCells(cells[t.cols-n:])
+	case '@': // ICH
+		cells := t.lines[row].Cells
+		n = min(n, t.cols-col)
+		copy(cells[col+n:], cells[col:])
+		t.eraseCells(cells[col : col+n])
+	case 'X': // ECH
+		t.eraseCells(t.lines[row].Cells[col:min(col+n, t.cols)])
+	case 'S': // SU
+		t.scrollUp(n)
+	case 'T': // SD
+		t.scrollDown(n)
+	case 'm': // SGR
+		t.setGraphics(params)
+	case 'r': // DECSTBM
+		top := param(params, 0, 1) - 1
+		bottom := param(params, 1, t.rows) - 1
+		if top < bottom && bottom < t.rows {
+			t.top, t.bottom = top, bottom
+			t.moveCursor(0, 0)
+		}
+	case 's': // SCOSC
+		t.saved = savedCursor{cursor: t.cursor, pen: t.pen}
+	case 'u': // SCORC
+		t.pen = t.saved.pen
+		t.moveCursor(t.saved.cursor[0], t.saved.cursor[1])
+	case 'n': // DSR
+		switch param(params, 0, 0) {
+		case 5:
+			t.reply("\x1b[0n")
+		case 6:
+			t.reply(fmt.Sprintf("\x1b[%d;%dR", row+1, col+1))
+		}
+	case 'c': // Primary DA
+		t.reply("\x1b[?62;22c")
+	case 't': // XTWINOPS
+		t.windowOps(params)
+	}
+}
+
+// windowOps реализует операции с заголовком из XTWINOPS: CSI 22 ; Ps t
+// сохраняет заголовок в стеке, CSI 23 ; Ps t восстанавливает его. Ps = 0
+// относится к заголовку и имени значка, 1 - только к имени значка, 2 - только
+// к заголовку.
+func (t *Terminal) windowOps(params []int) {
+	which := param(params, 1, 0)
+	switch param(params, 0, 0) {
+	case 22:
+		if len(t.titleStack) >= maxTitleStack {
+			t.titleStack = t.titleStack[1:]
+		}
+		t.titleStack = append(t.titleStack, titleEntry{title: t.title, iconName: t.iconName})
+	case 23:
+		if len(t.titleStack) == 0 {
+			return
+		}
+		e := t.titleStack[len(t.titleStack)-1]
+		t.titleStack = t.titleStack[:len(t.titleStack)-1]
+		if which == 0 || which == 1 {
+			t.iconName = e.iconName
+		}
+		if which == 0 || which == 2 {
+			t.title = e.title
+		}
+	}
+}
+
+// Title возвращает заголовок окна, установленный программой.
+func (t *Terminal) Title() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.title
+}
+
+// IconName возвращает имя значка, установленное программой.
+func (t *Terminal) IconName() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.iconName
+}
+
+// eraseDisplay реализует ED.
+func (t *Terminal) eraseDisplay(mode int) {
+	row, col := t.cursor[0], t.cursor[1]
+	switch mode {
+	case 0:
+		t.eraseCells(t.lines[row].Cells[col:])
+		for i := row + 1; i < t.rows; i++ {
+			t.lines[i] = t.blankLine()
+		}
+	case 1:
+		t.eraseCells(t.lines[row].Cells[:col+1])
+		for i := 0; i < row; i++ {
+			t.lines[i] = t.blankLine()
+		}
+	case 2:
+		t.lines = t.blankLines(t.rows)
+	case 3:
+		t.truncateSearch(0)
+		t.history = nil
+		t.scroll = 0
+		t.sel = Selection{}
+	}
+}
+
+// eraseLine реализует EL.
+func (t *Terminal) eraseLine(mode int) {
+	cells := t.lines[t.cursor[0]].Cells
+	switch mode {
+	case 0:
+		t.eraseCells(cells[t.cursor[1]:])
+		t.lines[t.cursor[0]].Wrapped = false
+	case 1:
+		t.eraseCells(cells[:t.cursor[1]+1])
+	case 2:
+		// Стертая целиком строка теряет и отметки OSC 133
+		t.eraseCells(cells)
+		t.lines[t.cursor[0]].Wrapped = false
+		t.lines[t.cursor[0]].Mark = 0
+	}
+}
+
+// reportMode отвечает на DECRQM: 1 - режим включен, 2 - выключен,
+// 0 - режим не поддерживается.
+func (t *Terminal) reportMode(private byte, mode int) {
+	if private != '?' {
+		// Режимы ANSI (IRM, LNM и другие) не поддерживаются
+		t.reply(fmt.Sprintf("\x1b[%d;0$y", mode))
+		return
+	}
+	state := 0
+	if supportedModes[mode] {
+		state = 2
+		if t.modes[mode] {
+			state = 1
+		}
+	}
+	t.reply(fmt.Sprintf("\x1b[?%d;%d$y", mode, state))
+}
+
+// setModes реализует DECSET/DECRST.
+func (t *Terminal) setModes(params []int, on bool) {
+	for _, mode := range params {
+		switch mode {
+		case 47, 1047, 1049:
+			if on == (t.primary != nil) {
+				break
+			}
+			if mode == 1049 && on {
+				t.saved = savedCursor{cursor: t.cursor, pen: t.pen}
+			}
+			t.scroll = 0
+			t.sel = Selection{}
+			if on {
+				t.primary = t.lines
+				t.lines = t.blankLines(t.rows)
+			} else {
+				t.lines = t.primary
+				t.primary = nil
+			}
+			if mode == 1049 && !on {
+				t.pen = t.saved.pen
+				t.moveCursor(t.saved.cursor[0], t.saved.cursor[1])
+			}
+		case mouseX10, mouseNormal, mouseButtonMove, mouseAnyMove:
+			// Режимы отслеживания мыши взаимоисключающие
+			for _, m := range mouseTrackingModes {
+				delete(t.modes, m)
+			}
+		case mouseEncUTF8, mouseEncSGR, mouseEncURXVT, mouseEncSGRPixels:
+			for _, m := range mouseEncodingModes {
+				delete(t.modes, m)
+			}
+		case 2026:
+			if on && !t.modes[2026] {
+				t.syncStart = time.Now()
+			}
+		}
+		t.modes[mode] = on
+	}
+}
+
+// setGraphics реализует SGR.
+func (t *Terminal) setGraphics(params []int) {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			t.pen = Cell{Link: t.pen.Link} // SGR не завершает ссылку
+		case p == 1:
+			t.pen.Attr |= AttrBold
+		case p == 2:
+			t.pen.Attr |= AttrDim
+		case p == 3:
+			t.pen.Attr |= AttrItalic
+		case p == 4 || p == 21:
+			t.pen.Attr |= AttrUnderline
+		case p == 5:
+			t.pen.Attr |= AttrBlink
+		case p == 7:
+			t.pen.Attr |= AttrReverse
+		case p == 8:
+			t.pen.Attr |= AttrHidden
+		case p == 9:
+			t.pen.Attr |= AttrStrike
+		case p == 22:
+			t.pen.Attr &^= AttrBold | AttrDim
+		case p == 23:
+			t.pen.Attr &^= AttrItalic
+		case p == 24:
+			t.pen.Attr &^= AttrUnderline
+		case p == 25:
+			t.pen.Attr &^= AttrBlink
+		case p == 27:
+			t.pen.Attr &^= AttrReverse
+		case p == 28:
+			t.pen.Attr &^= AttrHidden
+		case p == 29:
+			t.pen.Attr &^= AttrStrike
+		case p >= 30 && p <= 37:
+			t.pen.FG = IndexedColor(uint8(p - 30))
+		case p == 38:
+			t.pen.FG, i = extendedColor(params, i)
+		case p == 39:
+			t.pen.FG = colorDefault
+		case p >= 40 && p <= 47:
+			t.pen.BG = IndexedColor(uint8(p - 40))
+		case p == 48:
+			t.pen.BG, i = extendedColor(params, i)
+		case p == 49:
+			t.pen.BG = colorDefault
+		case p >= 90 && p <= 97:
+			t.pen.FG = IndexedColor(uint8(p - 90 + 8))
+		case p >= 100 && p <= 107:
+			t.pen.BG = IndexedColor(uint8(p - 100 + 8))
+		}
+	}
+}
+
+// extendedColor разбирает параметры 38/48 (5;n или 2;r;g;b) начиная с позиции i.
+// Возвращает цвет и индекс последнего использованного параметра.
+func extendedColor(params []int, i int) (Color, int) {
+	if i+1 >= len(params) {
+		return colorDefault, i
+	}
+	switch params[i+1] {
+	case 5:
+		if i+2 < len(params) {
+			return IndexedColor(uint8(params[i+2])), i + 2
+		}
+	case 2:
+		if i+4 < len(params) {
+			return RGBColor(uint8(params[i+2]), uint8(params[i+3]), uint8(params[i+4])), i + 4
+		}
+	}
+	return colorDefault, len(params)
+}
+
+// oscDispatch обрабатывает строки OSC вида "Ps;Pt".
+func (t *Terminal) oscDispatch(data []byte) {
+	cmd, arg, _ := strings.Cut(string(data), ";")
+	switch cmd {
+	case "0":
+		t.title, t.iconName = arg, arg
+	case "1":
+		t.iconName = arg
+	case "2":
+		t.title = arg
+	case "4":
+		t.paletteOSC(arg)
+	case "7":
+		t.cwdOSC(arg)
+	case "8":
+		t.hyperlinkOSC(arg)
+	case "9":
+		t.notifyOSC(arg)
+	case "10", "11", "12", "17", "19":
+		n, _ := strconv.Atoi(cmd)
+		t.dynamicColorOSC(n, arg)
+	case "52":
+		t.clipboardOSC(arg)
+	case "99":
+		t.notifyKittyOSC(arg)
+	case "104":
+		t.resetPaletteOSC(arg)
+	case "133":
+		t.promptOSC(arg)
+	case "777":
+		t.notifyRxvtOSC(arg)
+	case "110", "111", "112", "117", "119":
+		n, _ := strconv.Atoi(cmd)
+		t.resetDynamicColorOSC(n)
+	}
+}
+
+// reply добавляет ответ для дочернего процесса.
+func (t *Terminal) reply(s string) {
+	t.replies = append(t.replies, s...)
+}
+
+// param возвращает i-й параметр CSI или значение по умолчанию, если параметр
+// отсутствует или равен нулю.
+func param(params []int, i, def int) int {
+	if i >= len(params) || params[i] == 0 {
+		return def
+	}
+	return params[i]
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// runeWidth возвращает число ячеек, занимаемых символом: 0 для
+// комбинирующих символов, 2 для широких символов Восточной Азии и эмодзи.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.Is(unicode.Cf, r):
+		return 0
+	case r >= 0x1100 && r <= 0x115F,
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F,
+		r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF,
+		r >= 0xFE30 && r <= 0xFE4F,
+		r >= 0xFF00 && r <= 0xFF60,
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F,
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD:
+		return 2
+	}
+	return 1
+}
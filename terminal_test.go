@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testFrame заполняет экран rows x cols символом c, как программа,
+// перерисовывающая весь экран.
+func testFrame(c byte, rows, cols int) string {
+	line := strings.Repeat(string(c), cols)
+	return "\x1b[H" + strings.Repeat(line+"\r\n", rows-1) + line
+}
+
+// checkFrame проверяет, что снимок показывает кадр одного символа целиком.
+func checkFrame(t *testing.T, snap *Snapshot) {
+	t.Helper()
+	want := snap.Lines[0].Cells[0].Char
+	for i, line := range snap.Lines {
+		for j, cell := range line.Cells {
+			if cell.Char != want {
+				t.Fatalf("cell %d,%d = %q in frame of %q", i, j, cell.Char, want)
+			}
+		}
+	}
+}
+
+// Снимки в главном потоке берутся под тем же мьютексом, что и разбор
+// вывода в горутине чтения. Тест нужно запускать с -race.
+func TestTerminalSnapshotsDuringFlood(t *testing.T) {
+	const rows, cols = 24, 80
+	term := NewTerminal(rows, cols)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			term.Write([]byte(testFrame(byte('a'+i%26), rows, cols)))
+		}
+	}()
+
+	var snap Snapshot
+	for taken := 0; ; {
+		select {
+		case <-done:
+			if taken == 0 {
+				t.Log("no snapshot was taken during the flood")
+			}
+			return
+		default:
+		}
+		if term.Snapshot(&snap) {
+			taken++
+			if snap.Rows != rows || len(snap.Lines) != rows {
+				t.Fatalf("snapshot has %d rows, want %d", len(snap.Lines), rows)
+			}
+			// Каждый вызов Write выводит кадр целиком
+			checkFrame(t, &snap)
+		}
+	}
+}
+
+func TestSynchronizedOutputHoldsFrame(t *testing.T) {
+	const rows, cols = 4, 10
+	term := NewTerminal(rows, cols)
+	term.Write([]byte(testFrame('a', rows, cols)))
+	var snap Snapshot
+	term.Snapshot(&snap)
+
+	// Кадр приходит несколькими частями, как из PTY
+	frame := "\x1b[?2026h" + testFrame('b', rows, cols) + "\x1b[?2026l"
+	for i := 0; i < len(frame); i += 7 {
+		term.Write([]byte(frame[i:min(i+7, len(frame))]))
+		if term.Snapshot(&snap) {
+			checkFrame(t, &snap)
+		}
+	}
+	term.Snapshot(&snap)
+	checkFrame(t, &snap)
+	if got := snap.Lines[0].Cells[0].Char; got != 'b' {
+		t.Errorf("frame of %q, want b", got)
+	}
+}
+
+func TestSynchronizedOutputTimeout(t *testing.T) {
+	term := NewTerminal(4, 10)
+	term.Write([]byte("\x1b[?2026hpartial"))
+	var snap Snapshot
+	if term.Snapshot(&snap) {
+		t.Fatal("snapshot taken during synchronized output")
+	}
+	if wait := term.SyncRemaining(); wait <= 0 || wait > syncTimeout {
+		t.Fatalf("remaining = %v, want up to %v", wait, syncTimeout)
+	}
+
+	// Программа не выключила режим: по истечении таймаута кадр показывается
+	term.syncStart = term.syncStart.Add(-syncTimeout)
+	if wait := term.SyncRemaining(); wait != 0 {
+		t.Errorf("remaining after timeout = %v, want 0", wait)
+	}
+	if !term.Snapshot(&snap) {
+		t.Fatal("snapshot held after timeout")
+	}
+	if got := term.Text(false); !strings.HasPrefix(got, "partial") {
+		t.Errorf("screen = %q", got)
+	}
+
+	// Повторное включение режима начинает таймаут заново
+	term.Write([]byte("\x1b[?2026l\x1b[?2026h"))
+	if term.SyncRemaining() == 0 {
+		t.Error("synchronized output was not restarted")
+	}
+}
+
+func TestSynchronizedOutputReport(t *testing.T) {
+	term := NewTerminal(4, 10)
+	var out bytes.Buffer
+	term.out = &out
+	for _, tt := range []struct {
+		input, want string
+	}{
+		{"\x1b[?2026$p", "\x1b[?2026;2$y"},
+		{"\x1b[?2026h\x1b[?2026$p", "\x1b[?2026;1$y"},
+		{"\x1b[?2026l\x1b[?2026$p", "\x1b[?2026;2$y"},
+	} {
+		out.Reset()
+		term.Write([]byte(tt.input))
+		if got := out.String(); got != tt.want {
+			t.Errorf("reply to %q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// Широкий символ в терминале шириной в один столбец заменяется пробелом.
+func TestTerminalWideRuneInOneColumn(t *testing.T) {
+	term := NewTerminal(3, 1)
+	term.Write([]byte("漢a\r\n字"))
+	want := []rune{' ', 'a', ' '}
+	for i, r := range want {
+		if c := term.lines[i].Cells[0]; c.Char != r || c.Attr&(AttrWide|AttrWideSpacer) != 0 {
+			t.Errorf("row %d = %q (attr %#x), want %q", i, c.Char, c.Attr, r)
+		}
+	}
+
+	// После расширения широкие символы снова выводятся целиком
+	term.Resize(3, 2)
+	term.Write([]byte("\x1b[H漢"))
+	if c := term.lines[0].Cells; c[0].Char != '漢' || c[1].Attr&AttrWideSpacer == 0 {
+		t.Errorf("row 0 = %q %q after resize", c[0].Char, c[1].Char)
+	}
+}
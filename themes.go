@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Theme - цветовая схема: 16 цветов ANSI и цвета по умолчанию. Нулевые
+// Cursor и Selection* означают инверсию цветов, как без темы.
+type Theme struct {
+	Name        string
+	ANSI        [16]Color
+	Foreground  Color
+	Background  Color
+	Cursor      Color
+	SelectionBG Color
+	SelectionFG Color
+}
+
+// Palette строит палитру терминала по теме: 16 цветов темы, а остальные
+// 240 цветов - из стандартной палитры xterm.
+func (th *Theme) Palette() Palette {
+	p := defaultPalette()
+	copy(p.Colors[:16], th.ANSI[:])
+	p.Foreground, p.Background = th.Foreground, th.Background
+	p.Cursor = th.Cursor
+	p.SelectionBG, p.SelectionFG = th.SelectionBG, th.SelectionFG
+	return p
+}
+
+// hexRGB возвращает RGB-цвет, записанный числом 0xRRGGBB.
+func hexRGB(v uint32) Color {
+	return colorRGB | Color(v&0xFFFFFF)
+}
+
+// hex записывает RGB-цвет в виде #rrggbb.
+func (c Color) hex() string {
+	return fmt.Sprintf("#%06x", uint32(c&0xFFFFFF))
+}
+
+// xtermTheme - цвета xterm, которые используются без темы.
+func xtermTheme() Theme {
+	p := defaultPalette()
+	th := Theme{Name: "xterm", Foreground: p.Foreground, Background: p.Background}
+	copy(th.ANSI[:], p.Colors[:16])
+	return th
+}
+
+// builtinThemes возвращает встроенные темы. Первая из них используется по
+// умолчанию.
+func builtinThemes() []Theme {
+	return []Theme{
+		xtermTheme(),
+		{
+			Name: "solarized-dark",
+			ANSI: [16]Color{
+				hexRGB(0x073642), hexRGB(0xDC322F), hexRGB(0x859900), hexRGB(0xB58900),
+				hexRGB(0x268BD2), hexRGB(0xD33682), hexRGB(0x2AA198), hexRGB(0xEEE8D5),
+				hexRGB(0x002B36), hexRGB(0xCB4B16), hexRGB(0x586E75), hexRGB(0x657B83),
+				hexRGB(0x839496), hexRGB(0x6C71C4), hexRGB(0x93A1A1), hexRGB(0xFDF6E3),
+			},
+			Foreground:  hexRGB(0x839496),
+			Background:  hexRGB(0x002B36),
+			Cursor:      hexRGB(0x93A1A1),
+			SelectionBG: hexRGB(0x073642),
+			SelectionFG: hexRGB(0x93A1A1),
+		},
+		{
+			Name: "solarized-light",
+			ANSI: [16]Color{
+				hexRGB(0x073642), hexRGB(0xDC322F), hexRGB(0x859900), hexRGB(0xB58900),
+				hexRGB(0x268BD2), hexRGB(0xD33682), hexRGB(0x2AA198), hexRGB(0xEEE8D5),
+				hexRGB(0x002B36), hexRGB(0xCB4B16), hexRGB(0x586E75), hexRGB(0x657B83),
+				hexRGB(0x839496), hexRGB(0x6C71C4), hexRGB(0x93A1A1), hexRGB(0xFDF6E3),
+			},
+			Foreground:  hexRGB(0x657B83),
+			Background:  hexRGB(0xFDF6E3),
+			Cursor:      hexRGB(0x586E75),
+			SelectionBG: hexRGB(0xEEE8D5),
+			SelectionFG: hexRGB(0x586E75),
+		},
+		{
+			Name: "gruvbox-dark",
+			ANSI: [16]Color{
+				hexRGB(0x282828), hexRGB(0xCC241D), hexRGB(0x98971A), hexRGB(0xD79921),
+				hexRGB(0x458588), hexRGB(0xB16286), hexRGB(0x689D6A), hexRGB(0xA89984),
+				hexRGB(0x928374), hexRGB(0xFB4934), hexRGB(0xB8BB26), hexRGB(0xFABD2F),
+				hexRGB(0x83A598), hexRGB(0xD3869B), hexRGB(0x8EC07C), hexRGB(0xEBDBB2),
+			},
+			Foreground:  hexRGB(0xEBDBB2),
+			Background:  hexRGB(0x282828),
+			Cursor:      hexRGB(0xEBDBB2),
+			SelectionBG: hexRGB(0x504945),
+			SelectionFG: hexRGB(0xEBDBB2),
+		},
+		{
+			Name: "tango",
+			ANSI: [16]Color{
+				hexRGB(0x000000), hexRGB(0xCC0000), hexRGB(0x4E9A06), hexRGB(0xC4A000),
+				hexRGB(0x3465A4), hexRGB(0x75507B), hexRGB(0x06989A), hexRGB(0xD3D7CF),
+				hexRGB(0x555753), hexRGB(0xEF2929), hexRGB(0x8AE234), hexRGB(0xFCE94F),
+				hexRGB(0x729FCF), hexRGB(0xAD7FA8), hexRGB(0x34E2E2), hexRGB(0xEEEEEC),
+			},
+			Foreground: hexRGB(0xD3D7CF),
+			Background: hexRGB(0x2E3436),
+		},
+	}
+}
+
+// themeDir возвращает каталог пользовательских тем ~/.config/bareterm/themes.
+func themeDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bareterm", "themes")
+}
+
+// LoadThemes возвращает встроенные темы и темы из файлов каталога dir.
+// Тема из файла заменяет встроенную с тем же именем. Файлы с ошибками
+// пропускаются, а ошибки возвращаются вместе с остальными темами.
+func LoadThemes(dir string) ([]Theme, error) {
+	themes := builtinThemes()
+	if dir == "" {
+		return themes, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return themes, nil
+	}
+	if err != nil {
+		return themes, fmt.Errorf("failed to read theme directory: %v", err)
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		th, err := LoadThemeFile(filepath.Join(dir, e.Name()))
+		if errors.Is(err, errUnknownThemeFormat) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if i := findTheme(themes, th.Name); i >= 0 {
+			themes[i] = th
+		} else {
+			themes = append(themes, th)
+		}
+	}
+	return themes, errors.Join(errs...)
+}
+
+// findTheme возвращает индекс темы с заданным именем или -1.
+func findTheme(themes []Theme, name string) int {
+	for i := range themes {
+		if themes[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// errUnknownThemeFormat - расширение файла не похоже на тему.
+var errUnknownThemeFormat = errors.New("unknown theme format")
+
+// LoadThemeFile читает тему из файла. Формат определяется по расширению:
+// .toml - собственный формат bareterm, .itermcolors - iTerm2, .yaml и
+// .yml - base16. Имя темы - имя файла без расширения, если в файле оно не
+// задано.
+func LoadThemeFile(path string) (Theme, error) {
+	ext := filepath.Ext(path)
+	var parse func([]byte) (Theme, error)
+	switch strings.ToLower(ext) {
+	case ".toml":
+		parse = parseTheme
+	case ".itermcolors":
+		parse = parseITermColors
+	case ".yaml", ".yml":
+		parse = parseBase16
+	default:
+		return Theme{}, errUnknownThemeFormat
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, fmt.Errorf("failed to read theme: %v", err)
+	}
+	th, err := parse(data)
+	if err != nil {
+		return Theme{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if th.Name == "" {
+		th.Name = strings.TrimSuffix(filepath.Base(path), ext)
+	}
+	return th, nil
+}
+
+// parseTheme разбирает тему bareterm в формате TOML:
+//
+//	name = "my-theme"
+//	foreground = "#d0d0d0"
+//	background = "#1c1c1c"
+//	cursor = "#ffffff"
+//	selection_background = "#444444"
+//	selection_foreground = "#ffffff"
+//	color0 = "#000000"
+//	...
+//	color15 = "#ffffff"
+//
+// Не заданные цвета берутся из темы xterm.
+func parseTheme(data []byte) (Theme, error) {
+	entries, err := parseTOML(data)
+	if err != nil {
+		return Theme{}, err
+	}
+	th := xtermTheme()
+	th.Name = ""
+	for _, e := range entries {
+		value, ok := e.Value.(string)
+		if !ok {
+			return Theme{}, fmt.Errorf("line %d: %s must be a string", e.Line, e.Key)
+		}
+		if e.Key == "name" {
+			th.Name = value
+			continue
+		}
+		if err := th.setColor(e.Key, value); err != nil {
+			return Theme{}, fmt.Errorf("line %d: %v", e.Line, err)
+		}
+	}
+	return th, nil
+}
+
+// setColor задает цвет темы по ключу файла темы: foreground, background,
+// cursor, selection_background, selection_foreground или color0-color15.
+func (th *Theme) setColor(key, value string) error {
+	c, ok := parseColorSpec(value)
+	if !ok {
+		return fmt.Errorf("invalid color %q", value)
+	}
+	switch key {
+	case "foreground":
+		th.Foreground = c
+	case "background":
+		th.Background = c
+	case "cursor":
+		th.Cursor = c
+	case "selection_background":
+		th.SelectionBG = c
+	case "selection_foreground":
+		th.SelectionFG = c
+	default:
+		index, err := strconv.Atoi(strings.TrimPrefix(key, "color"))
+		if !strings.HasPrefix(key, "color") || err != nil || index < 0 || index > 15 {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		th.ANSI[index] = c
+	}
+	return nil
+}
+
+// parseITermColors разбирает тему iTerm2: plist со словарями "Ansi N Color",
+// "Foreground Color" и т.д., где компоненты заданы числами от 0 до 1.
+func parseITermColors(data []byte) (Theme, error) {
+	var components = map[string]int{"Red Component": 0, "Green Component": 1, "Blue Component": 2}
+	colors := make(map[string][3]float64)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var depth int
+	var key, component string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return Theme{}, fmt.Errorf("invalid plist: %v", err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "dict":
+				depth++
+			case "key":
+				var s string
+				if err := dec.DecodeElement(&s, &el); err != nil {
+					return Theme{}, fmt.Errorf("invalid plist: %v", err)
+				}
+				if depth == 1 {
+					key = s
+				} else {
+					component = s
+				}
+			case "real", "integer":
+				var v float64
+				if err := dec.DecodeElement(&v, &el); err != nil {
+					return Theme{}, fmt.Errorf("invalid plist: %v", err)
+				}
+				if i, ok := components[component]; ok && depth == 2 {
+					c := colors[key]
+					c[i] = v
+					colors[key] = c
+				}
+			}
+		case xml.EndElement:
+			if el.Name.Local == "dict" {
+				depth--
+			}
+		}
+	}
+
+	rgb := func(name string) (Color, bool) {
+		c, ok := colors[name]
+		if !ok {
+			return 0, false
+		}
+		var v [3]uint8
+		for i := range c {
+			v[i] = uint8(clamp(int(c[i]*255+0.5), 0, 255))
+		}
+		return RGBColor(v[0], v[1], v[2]), true
+	}
+
+	th := xtermTheme()
+	th.Name = ""
+	for i := range th.ANSI {
+		if c, ok := rgb(fmt.Sprintf("Ansi %d Color", i)); ok {
+			th.ANSI[i] = c
+		}
+	}
+	for name, dst := range map[string]*Color{
+		"Foreground Color":    &th.Foreground,
+		"Background Color":    &th.Background,
+		"Cursor Color":        &th.Cursor,
+		"Selection Color":     &th.SelectionBG,
+		"Selected Text Color": &th.SelectionFG,
+	} {
+		if c, ok := rgb(name); ok {
+			*dst = c
+		}
+	}
+	if len(colors) == 0 {
+		return Theme{}, errors.New("no colors found")
+	}
+	return th, nil
+}
+
+// base16ANSI сопоставляет цвета ANSI цветам base16, как это делает
+// base16-shell.
+var base16ANSI = [16]int{
+	0x00, 0x08, 0x0B, 0x0A, 0x0D, 0x0E, 0x0C, 0x05,
+	0x03, 0x08, 0x0B, 0x0A, 0x0D, 0x0E, 0x0C, 0x07,
+}
+
+// parseBase16 разбирает схему base16 в YAML: строки "base00: 181818"
+// (можно с кавычками, решеткой и вложенные в palette:) и "scheme:" или
+// "name:" с названием.
+func parseBase16(data []byte) (Theme, error) {
+	var base [16]Color
+	var found [16]bool
+	var name string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if v, _, ok := strings.Cut(value, " #"); ok {
+			value = v // Комментарий в конце строки
+		}
+		value = strings.Trim(value, `"'`)
+
+		switch {
+		case key == "scheme" || key == "name":
+			name = value
+		case len(key) == 6 && strings.HasPrefix(key, "base"):
+			i, err := strconv.ParseUint(key[4:], 16, 8)
+			if err != nil || i > 15 {
+				continue
+			}
+			c, ok := parseColorSpec("#" + strings.TrimPrefix(value, "#"))
+			if !ok {
+				return Theme{}, fmt.Errorf("line %d: invalid color %q", n, value)
+			}
+			base[i], found[i] = c, true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Theme{}, err
+	}
+	for i, ok := range found {
+		if !ok {
+			return Theme{}, fmt.Errorf("base%02X is missing", i)
+		}
+	}
+
+	th := Theme{
+		Name:        name,
+		Foreground:  base[0x05],
+		Background:  base[0x00],
+		Cursor:      base[0x05],
+		SelectionBG: base[0x02],
+		SelectionFG: base[0x05],
+	}
+	for i, b := range base16ANSI {
+		th.ANSI[i] = base[b]
+	}
+	return th, nil
+}
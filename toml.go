@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlValue - значение из файла TOML с номером строки для сообщений об ошибках.
+// Value имеет тип string, int64, float64, bool или []any.
+type tomlValue struct {
+	Value any
+	Line  int
+}
+
+// tomlEntry - ключ таблицы вместе со значением в порядке следования в файле.
+type tomlEntry struct {
+	Key string // Полное имя ключа: "таблица.ключ"
+	tomlValue
+}
+
+// parseTOML разбирает подмножество TOML, достаточное для конфигурации:
+// таблицы [a] и [a.b], ключи key = value (ключ может быть в кавычках),
+// строки в двойных и одинарных кавычках, целые и дробные числа, true/false
+// и однострочные массивы этих значений.
+func parseTOML(data []byte) ([]tomlEntry, error) {
+	var entries []tomlEntry
+	seen := make(map[string]bool)
+	table := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header", n)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if table == "" {
+				return nil, fmt.Errorf("line %d: empty table name", n)
+			}
+			continue
+		}
+
+		key, rest, err := tomlKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "=") {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		value, err := tomlParseValue(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		if table != "" {
+			key = table + "." + key
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		seen[key] = true
+		entries = append(entries, tomlEntry{Key: key, tomlValue: tomlValue{Value: value, Line: n}})
+	}
+	return entries, scanner.Err()
+}
+
+// stripComment отрезает комментарий от строки. Решетка внутри кавычек -
+// часть значения, например цвета "#rrggbb".
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlKey отделяет ключ от остатка строки.
+func tomlKey(line string) (key, rest string, err error) {
+	if strings.HasPrefix(line, `"`) || strings.HasPrefix(line, "'") {
+		end := strings.IndexByte(line[1:], line[0])
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated key")
+		}
+		return line[1 : end+1], line[end+2:], nil
+	}
+	key, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", fmt.Errorf("expected key = value")
+	}
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " \t\"'") {
+		return "", "", fmt.Errorf("invalid key %q", key)
+	}
+	return key, "=" + rest, nil
+}
+
+// tomlParseValue разбирает значение ключа.
+func tomlParseValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(s[1:len(s)-1], "'") {
+			return nil, fmt.Errorf("invalid string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("arrays must be written on one line")
+		}
+		var values []any
+		for _, item := range tomlSplitArray(s[1 : len(s)-1]) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue // Запятая после последнего элемента
+			}
+			v, err := tomlParseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	number := strings.ReplaceAll(s, "_", "")
+	if v, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.ParseFloat(number, 64); err == nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", s)
+}
+
+// tomlSplitArray делит содержимое массива по запятым вне кавычек.
+func tomlSplitArray(s string) []string {
+	var items []string
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
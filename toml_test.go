@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOMLStrings(t *testing.T) {
+	data := "[selection]\n" +
+		`word_separators = " \t,│` + "`" + `|:\"'()[]{}<>"   # Границы слова для двойного щелчка` + "\n" +
+		`title = "a\"#b" # комментарий` + "\n" +
+		`path = "C:\\" # обратная косая черта в конце` + "\n" +
+		`args = ["-c", "echo \"a, b\"", 'x\']` + "\n"
+	entries, err := parseTOML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tomlEntry{
+		{Key: "selection.word_separators", tomlValue: tomlValue{" \t,│`|:\"'()[]{}<>", 2}},
+		{Key: "selection.title", tomlValue: tomlValue{`a"#b`, 3}},
+		{Key: "selection.path", tomlValue: tomlValue{`C:\`, 4}},
+		{Key: "selection.args", tomlValue: tomlValue{[]any{"-c", `echo "a, b"`, `x\`}, 5}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("parseTOML = %#v, want %#v", entries, want)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// ViMotion - перемещение курсора режима vi.
+type ViMotion int
+
+const (
+	ViLeft       ViMotion = iota // h
+	ViRight                      // l
+	ViUp                         // k
+	ViDown                       // j
+	ViLineStart                  // 0
+	ViFirstChar                  // ^
+	ViLineEnd                    // $
+	ViWordNext                   // w
+	ViWordPrev                   // b
+	ViWordEnd                    // e
+	ViTop                        // gg
+	ViBottom                     // G
+	ViViewTop                    // H
+	ViViewMiddle                 // M
+	ViViewBottom                 // L
+	ViHalfUp                     // Ctrl+U
+	ViHalfDown                   // Ctrl+D
+)
+
+// viMotionKeys - перемещения по символам, набранным в режиме vi.
+var viMotionKeys = map[rune]ViMotion{
+	'h': ViLeft, 'l': ViRight, 'k': ViUp, 'j': ViDown,
+	'0': ViLineStart, '^': ViFirstChar, '$': ViLineEnd,
+	'w': ViWordNext, 'b': ViWordPrev, 'e': ViWordEnd,
+	'G': ViBottom, 'H': ViViewTop, 'M': ViViewMiddle, 'L': ViViewBottom,
+}
+
+// viKeyMotions - перемещения по клавишам без символов.
+var viKeyMotions = map[glfw.Key]ViMotion{
+	glfw.KeyLeft: ViLeft, glfw.KeyRight: ViRight, glfw.KeyUp: ViUp, glfw.KeyDown: ViDown,
+	glfw.KeyHome: ViLineStart, glfw.KeyEnd: ViLineEnd,
+}
+
+// viCursor - курсор режима vi, который ходит по экрану и истории
+// прокрутки отдельно от курсора программы.
+type viCursor struct {
+	Active bool
+	Point  Point
+}
+
+// StartVi включает режим vi. Курсор ставится на курсор программы, а если
+// тот не виден - в начало нижней строки области просмотра.
+func (t *Terminal) StartVi() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := Point{Line: len(t.history) + t.cursor[0], Col: t.cursor[1]}
+	if top := len(t.history) - t.scroll; p.Line >= top+t.rows {
+		p = Point{Line: top + t.rows - 1}
+	}
+	t.vi = viCursor{Active: true, Point: p}
+	t.sel = Selection{}
+	t.dirty = true
+}
+
+// StopVi выключает режим vi, снимает выделение и возвращает область
+// просмотра к экрану.
+func (t *Terminal) StopVi() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.vi.Active {
+		t.vi = viCursor{}
+		t.sel = Selection{}
+		t.scroll = 0
+		t.dirty = true
+	}
+}
+
+// ViMove перемещает курсор режима vi count раз и тянет за ним выделение.
+func (t *Terminal) ViMove(m ViMotion, count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.vi.Active {
+		return
+	}
+	p := t.viClamp(t.vi.Point)
+	first, last := t.viLines()
+	top := len(t.history) - t.scroll
+	switch m {
+	case ViLineStart:
+		p.Col = 0
+	case ViFirstChar:
+		p.Col = 0
+		for p.Col < t.cols-1 && t.viClass(p) == 0 {
+			p.Col++
+		}
+	case ViLineEnd:
+		p.Col = t.cols - 1
+		for p.Col > 0 && t.viClass(p) == 0 {
+			p.Col--
+		}
+	case ViTop:
+		p = Point{Line: first}
+	case ViBottom:
+		p = Point{Line: last}
+	case ViViewTop:
+		p = Point{Line: max(top, first)}
+	case ViViewMiddle:
+		p = Point{Line: max(top+t.rows/2, first)}
+	case ViViewBottom:
+		p = Point{Line: top + t.rows - 1}
+	default:
+		for i := 0; i < count; i++ {
+			p = t.viStep(p, m)
+		}
+	}
+	t.viSet(p)
+}
+
+// viStep выполняет одно перемещение, которое можно повторять.
+func (t *Terminal) viStep(p Point, m ViMotion) Point {
+	switch m {
+	case ViLeft:
+		p.Col--
+		if c := t.cellAt(p); c != nil && c.Attr&AttrWideSpacer != 0 {
+			p.Col--
+		}
+	case ViRight:
+		if c := t.cellAt(p); c != nil && c.Attr&AttrWide != 0 {
+			p.Col++
+		}
+		p.Col++
+	case ViUp:
+		p.Line--
+	case ViDown:
+		p.Line++
+	case ViHalfUp:
+		p.Line -= t.rows / 2
+	case ViHalfDown:
+		p.Line += t.rows / 2
+	case ViWordNext:
+		// Конец текущего слова, затем пробелы до следующего
+		class := t.viClass(p)
+		q, hard, ok := t.viNext(p)
+		for ok && class != 0 && !hard && t.viClass(q) == class {
+			q, hard, ok = t.viNext(q)
+		}
+		for ok && t.viClass(q) == 0 {
+			q, _, ok = t.viNext(q)
+		}
+		if ok {
+			p = q
+		}
+	case ViWordEnd:
+		q, _, ok := t.viNext(p)
+		for ok && t.viClass(q) == 0 {
+			q, _, ok = t.viNext(q)
+		}
+		if !ok {
+			break
+		}
+		for class := t.viClass(q); ; {
+			next, hard, ok := t.viNext(q)
+			if !ok || hard || t.viClass(next) != class {
+				break
+			}
+			q = next
+		}
+		p = q
+	case ViWordPrev:
+		q, _, ok := t.viPrev(p)
+		for ok && t.viClass(q) == 0 {
+			q, _, ok = t.viPrev(q)
+		}
+		if !ok {
+			break
+		}
+		for class := t.viClass(q); ; {
+			prev, hard, ok := t.viPrev(q)
+			if !ok || hard || t.viClass(prev) != class {
+				break
+			}
+			q = prev
+		}
+		p = q
+	}
+	return t.viClamp(p)
+}
+
+// viSet ставит курсор режима vi в точку p, тянет за ним выделение и
+// прокручивает область просмотра так, чтобы курсор был виден.
+func (t *Terminal) viSet(p Point) {
+	p = t.viClamp(p)
+	if c := t.cellAt(p); c != nil && c.Attr&AttrWideSpacer != 0 && p.Col > 0 {
+		p.Col--
+	}
+	t.vi.Point = p
+	if t.sel.Active {
+		t.sel.Head = p
+	}
+	if t.primary == nil {
+		top := len(t.history) - t.scroll
+		switch {
+		case p.Line < top:
+			t.scroll = len(t.history) - p.Line
+		case p.Line >= top+t.rows:
+			t.scroll = len(t.history) - (p.Line - t.rows + 1)
+		}
+	}
+	t.dirty = true
+}
+
+// viLines возвращает первую и последнюю строку текста, по которым ходит
+// курсор режима vi. На альтернативном экране истории нет.
+func (t *Terminal) viLines() (first, last int) {
+	first = 0
+	if t.primary != nil {
+		first = len(t.history)
+	}
+	return first, len(t.history) + t.rows - 1
+}
+
+// viClamp прижимает точку к тексту терминала.
+func (t *Terminal) viClamp(p Point) Point {
+	first, last := t.viLines()
+	return Point{clamp(p.Line, first, last), clamp(p.Col, 0, t.cols-1)}
+}
+
+// viClass возвращает класс ячейки для перемещения по словам: 0 - пробел,
+// 1 - символ слова, 2 - разделитель.
+func (t *Terminal) viClass(p Point) int {
+	c := t.cellAt(p)
+	if c != nil && c.Attr&AttrWideSpacer != 0 && p.Col > 0 {
+		p.Col--
+		c = t.cellAt(p)
+	}
+	switch {
+	case c == nil || c.Char == 0 || c.Char == ' ' || c.Char == '\t':
+		return 0
+	case t.isWordCell(p):
+		return 1
+	}
+	return 2
+}
+
+// viNext возвращает следующую ячейку текста. hard сообщает, что между
+// ячейками конец строки без мягкого переноса.
+func (t *Terminal) viNext(p Point) (q Point, hard, ok bool) {
+	if p.Col+1 < t.cols {
+		return Point{p.Line, p.Col + 1}, false, true
+	}
+	_, last := t.viLines()
+	if p.Line >= last {
+		return p, false, false
+	}
+	l := t.lineAt(p.Line)
+	return Point{p.Line + 1, 0}, l == nil || !l.Wrapped, true
+}
+
+// viPrev возвращает предыдущую ячейку текста.
+func (t *Terminal) viPrev(p Point) (q Point, hard, ok bool) {
+	if p.Col > 0 {
+		return Point{p.Line, p.Col - 1}, false, true
+	}
+	first, _ := t.viLines()
+	if p.Line <= first {
+		return p, false, false
+	}
+	l := t.lineAt(p.Line - 1)
+	return Point{p.Line - 1, t.cols - 1}, l == nil || !l.Wrapped, true
+}
+
+// ViVisual включает выделение в режиме mode от курсора режима vi. Повторное
+// включение того же режима снимает выделение.
+func (t *Terminal) ViVisual(mode SelectionMode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.vi.Active {
+		return
+	}
+	switch {
+	case t.sel.Active && t.sel.Mode == mode:
+		t.sel = Selection{}
+	case t.sel.Active:
+		t.sel.Mode = mode
+	default:
+		t.sel = Selection{Active: true, Mode: mode, Anchor: t.vi.Point, Head: t.vi.Point}
+	}
+	t.dirty = true
+}
+
+// ViClearSelection снимает выделение. Возвращает false, если выделения не
+// было.
+func (t *Terminal) ViClearSelection() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.sel.Active {
+		return false
+	}
+	t.sel = Selection{}
+	t.dirty = true
+	return true
+}
+
+// ViFindMatch делает текущим ближайшее к курсору режима vi совпадение
+// поиска: dir > 0 - после курсора, dir < 0 - перед ним.
+func (t *Terminal) ViFindMatch(dir int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.updateSearch()
+	n := t.searchCount()
+	if !t.vi.Active || n == 0 {
+		return
+	}
+	p := t.vi.Point
+	var i int
+	if dir < 0 {
+		i = t.searchIndex(p) - 1
+	} else {
+		i = t.searchIndex(Point{p.Line, p.Col + 1})
+	}
+	t.selectMatch((i + n) % n)
+}
+
+// ViToMatch переносит курсор режима vi на текущее совпадение поиска.
+func (t *Terminal) ViToMatch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.vi.Active && t.searchCount() > 0 {
+		t.viSet(t.currentMatch())
+	}
+}
+
+// ViInput - набор команд режима vi: счетчик повторений и префикс g.
+type ViInput struct {
+	Active    bool
+	count     int
+	prefix    bool      // Набрана g, ждем вторую g
+	searchDir int       // Направление последнего поиска для n и N
+	term      *Terminal // Терминал, в котором включен режим
+}
+
+// StartVi включает режим vi в панели с фокусом.
+func (app *App) StartVi() {
+	term := app.tab().focus.session.term
+	if app.grid.vi.Active && app.grid.vi.term == term {
+		return
+	}
+	app.closeVi()
+	app.grid.vi = ViInput{Active: true, term: term, searchDir: 1}
+	term.StartVi()
+}
+
+// closeVi выключает режим vi и убирает подсветку его поиска.
+func (app *App) closeVi() {
+	vi := &app.grid.vi
+	if !vi.Active {
+		return
+	}
+	if app.grid.search.term == vi.term {
+		app.closeSearch()
+	}
+	vi.term.ClearSearch()
+	vi.term.StopVi()
+	*vi = ViInput{}
+}
+
+// viChar обрабатывает символ, набранный в режиме vi.
+func (app *App) viChar(char rune) {
+	vi := &app.grid.vi
+	term := vi.term
+	if char >= '1' && char <= '9' || char == '0' && vi.count > 0 {
+		vi.count = min(vi.count*10+int(char-'0'), 10000)
+		return
+	}
+	count := max(vi.count, 1)
+	vi.count = 0
+	if vi.prefix {
+		vi.prefix = false
+		if char == 'g' {
+			term.ViMove(ViTop, 1)
+		}
+		return
+	}
+	if m, ok := viMotionKeys[char]; ok {
+		term.ViMove(m, count)
+		return
+	}
+	switch char {
+	case 'g':
+		vi.prefix = true
+	case 'v':
+		term.ViVisual(SelectChar)
+	case 'V':
+		term.ViVisual(SelectLine)
+	case 'y':
+		if text := term.SelectionText(); text != "" {
+			glfw.SetClipboardString(text)
+			app.closeVi()
+		}
+	case '/', '?':
+		app.closeSearch()
+		dir := 1
+		if char == '?' {
+			dir = -1
+		}
+		app.grid.search = SearchBar{Active: true, term: term, dir: dir}
+		app.grid.needsRedraw = true
+	case 'n', 'N':
+		dir := vi.searchDir
+		if char == 'N' {
+			dir = -dir
+		}
+		for i := 0; i < count; i++ {
+			term.ViFindMatch(dir)
+			term.ViToMatch()
+		}
+	case 'q', 'i':
+		app.closeVi()
+	}
+}
+
+// viKey обрабатывает клавиши режима vi, которые не дают символов: Escape
+// снимает выделение, а без выделения выключает режим. Возвращает false для
+// остальных клавиш.
+func (app *App) viKey(key glfw.Key, mods glfw.ModifierKey) bool {
+	term := app.grid.vi.term
+	if m, ok := viKeyMotions[key]; ok && mods == 0 {
+		term.ViMove(m, 1)
+		return true
+	}
+	switch {
+	case key == glfw.KeyEscape:
+		app.grid.vi.count, app.grid.vi.prefix = 0, false
+		if !term.ViClearSelection() {
+			app.closeVi()
+		}
+	case mods == glfw.ModControl && key == glfw.KeyV:
+		term.ViVisual(SelectBlock)
+	case mods == glfw.ModControl && key == glfw.KeyU:
+		term.ViMove(ViHalfUp, 1)
+	case mods == glfw.ModControl && key == glfw.KeyD:
+		term.ViMove(ViHalfDown, 1)
+	default:
+		return false
+	}
+	return true
+}
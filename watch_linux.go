@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// WatchFile вызывает notify из отдельной горутины при каждом изменении файла.
+// Следится каталог, а не сам файл: редакторы часто сохраняют файл, заменяя
+// его новым, и наблюдение за старым файлом при этом теряется.
+func WatchFile(path string, notify func()) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %v", err)
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %v", filepath.Dir(path), err)
+	}
+
+	// Неблокирующий дескриптор обслуживается планировщиком Go, поэтому Close
+	// прерывает чтение в горутине
+	f := os.NewFile(uintptr(fd), "inotify")
+	name := filepath.Base(path)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			changed := false
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(event.Len)]
+				if string(trimNUL(nameBytes)) == name {
+					changed = true
+				}
+				off += syscall.SizeofInotifyEvent + int(event.Len)
+			}
+			if changed {
+				notify()
+			}
+		}
+	}()
+	return f, nil
+}
+
+// trimNUL отрезает нулевые байты, которыми inotify дополняет имя файла.
+func trimNUL(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// WatchFile на других платформах пока не реализован: настройки читаются
+// только при запуске.
+func WatchFile(path string, notify func()) (io.Closer, error) {
+	return nil, fmt.Errorf("file watching is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Windows - окна процесса. Все окна используют общие настройки и общий кэш
+// шрифтов и текстур глифов, поэтому новое окно открывается сразу и почти не
+// занимает памяти. Методы, кроме Open, вызываются из главного потока.
+type Windows struct {
+	apps     []*App
+	cfg      Config
+	opts     Options
+	lastID   int       // Последний номер окна, вкладки или панели
+	control  *Control  // Сокет удаленного управления; nil, если его нет
+	notifier *Notifier // Уведомления рабочего стола всех окон
+
+	mu      sync.Mutex
+	pending [][]string // Команды окон, ожидающих открытия
+	calls   []func()   // Функции, ожидающие выполнения в главном потоке
+}
+
+// NewWindows создает пустой список окон с настройками cfg.
+func NewWindows(cfg Config, opts Options) *Windows {
+	return &Windows{cfg: cfg, opts: opts, notifier: NewNotifier()}
+}
+
+// Open просит открыть окно, в первой вкладке которого запущена command.
+// Окно создается в главном цикле: GLFW не разрешает создавать окна из
+// обработчиков событий и других потоков. Можно вызывать из любой горутины.
+func (w *Windows) Open(command []string) {
+	w.mu.Lock()
+	w.pending = append(w.pending, command)
+	w.mu.Unlock()
+	glfw.PostEmptyEvent()
+}
+
+// Do выполняет f в главном потоке и ждет ее завершения. Вызывается из
+// других горутин.
+func (w *Windows) Do(f func()) {
+	done := make(chan struct{})
+	w.mu.Lock()
+	w.calls = append(w.calls, func() {
+		defer close(done)
+		f()
+	})
+	w.mu.Unlock()
+	glfw.PostEmptyEvent()
+	<-done
+}
+
+// newID возвращает номер для нового окна, вкладки или панели. Номера не
+// повторяются, пока работает процесс.
+func (w *Windows) newID() int {
+	w.lastID++
+	return w.lastID
+}
+
+// publish сообщает о событии подписчикам удаленного управления.
+func (w *Windows) publish(event ControlEvent) {
+	if w.control != nil {
+		w.control.Publish(event)
+	}
+}
+
+// open создает окно, в первой вкладке которого запущена command.
+func (w *Windows) open(command []string) error {
+	return w.openWith(func(app *App) error {
+		return app.NewTab(command, app.opts.Dir)
+	})
+}
+
+// attach создает окно с вкладками, подключенными к сессиям сервера ids.
+func (w *Windows) attach(ids []int) error {
+	return w.openWith(func(app *App) error {
+		for _, id := range ids {
+			if err := app.AttachTab(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// openWith создает окно с первыми вкладками, которые открывает tabs.
+func (w *Windows) openWith(tabs func(app *App) error) error {
+	title := "Bareterm Terminal Emulator"
+	if w.opts.Title != "" {
+		title = w.opts.Title
+	}
+	// Контекст нового окна разделяет объекты OpenGL с уже открытыми окнами
+	var share *glfw.Window
+	if len(w.apps) > 0 {
+		share = w.apps[0].window
+	}
+	grid, err := NewTermGrid(w.cfg, title, share)
+	if err != nil {
+		return err
+	}
+	app, err := NewApp(w, grid, w.cfg, w.opts, tabs)
+	if err != nil {
+		grid.Destroy()
+		return err
+	}
+	w.apps = append(w.apps, app)
+	return nil
+}
+
+// ApplyConfig применяет настройки ко всем окнам.
+func (w *Windows) ApplyConfig(cfg Config) {
+	w.cfg = cfg
+	for _, app := range w.apps {
+		app.ApplyConfig(cfg)
+	}
+}
+
+// Update открывает запрошенные окна, обрабатывает события вкладок каждого
+// окна, закрывает окна, которые должны закрыться, и рисует остальные.
+// Возвращает false, когда не осталось ни одного окна.
+func (w *Windows) Update() bool {
+	w.mu.Lock()
+	pending, calls := w.pending, w.calls
+	w.pending, w.calls = nil, nil
+	w.mu.Unlock()
+	for _, command := range pending {
+		if err := w.open(command); err != nil {
+			log.Println("failed to open window:", err)
+		}
+	}
+	for _, f := range calls {
+		f()
+	}
+
+	// Окно закрывается вместе с последней вкладкой
+	w.apps = slices.DeleteFunc(w.apps, func(app *App) bool {
+		app.Update()
+		if !app.window.ShouldClose() {
+			return false
+		}
+		// Программы могут не сразу завершиться по SIGHUP, поэтому ожидание
+		// не держит главный поток
+		go app.Close()
+		app.grid.Destroy()
+		return true
+	})
+	for _, app := range w.apps {
+		app.Render()
+	}
+	return len(w.apps) > 0
+}
+
+// NextBlink возвращает время до ближайшего переключения мигающего курсора
+// во всех окнах или 0, если курсоры не мигают.
+func (w *Windows) NextBlink() time.Duration {
+	var next time.Duration
+	for _, app := range w.apps {
+		if d := app.grid.NextBlink(); d > 0 && (next == 0 || d < next) {
+			next = d
+		}
+	}
+	return next
+}
+
+// Close завершает программы во всех окнах и закрывает окна.
+func (w *Windows) Close() {
+	for _, app := range w.apps {
+		app.Close()
+		app.grid.Destroy()
+	}
+	w.apps = nil
+}